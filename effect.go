@@ -0,0 +1,102 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sprite
+
+import (
+	"image/color"
+	"math"
+
+	"golang.org/x/mobile/geom"
+)
+
+// An Effect changes the look of a Node and its descendants. They are
+// drawn together offscreen, the Node's Effects are applied in order,
+// and the result is drawn over the scene.
+//
+// The effects are Blur, DropShadow, Glow and ColorMatrix. Distances
+// are in geom.Pt of the screen, whatever the Node's Transform.
+type Effect interface {
+	effect()
+}
+
+// Blur is a Gaussian blur with standard deviation StdDev.
+type Blur struct {
+	StdDev geom.Pt
+}
+
+// DropShadow draws a shadow under the drawing: its alpha, moved by
+// Offset, blurred with a standard deviation of Blur, and filled with
+// Color. A nil Color is black.
+type DropShadow struct {
+	Offset geom.Point
+	Blur   geom.Pt
+	Color  color.Color
+}
+
+// Glow draws Color around the edges of the drawing, fading out over
+// about Radius. A nil Color is white.
+type Glow struct {
+	Radius geom.Pt
+	Color  color.Color
+}
+
+// A ColorMatrix maps each color, with channels in [0, 1] and not
+// premultiplied by alpha, from (r, g, b, a) to M·(r, g, b, a, 1).
+type ColorMatrix [4][5]float32
+
+func (Blur) effect()        {}
+func (DropShadow) effect()  {}
+func (Glow) effect()        {}
+func (ColorMatrix) effect() {}
+
+// The color matrices are those of the W3C Filter Effects specification.
+
+// Grayscale returns a ColorMatrix that removes the given amount of
+// color, from 0 for none to 1 for all.
+func Grayscale(amount float32) ColorMatrix {
+	s := 1 - amount
+	return ColorMatrix{
+		{0.2126 + 0.7874*s, 0.7152 - 0.7152*s, 0.0722 - 0.0722*s, 0, 0},
+		{0.2126 - 0.2126*s, 0.7152 + 0.2848*s, 0.0722 - 0.0722*s, 0, 0},
+		{0.2126 - 0.2126*s, 0.7152 - 0.7152*s, 0.0722 + 0.9278*s, 0, 0},
+		{0, 0, 0, 1, 0},
+	}
+}
+
+// Sepia returns a ColorMatrix that tints towards sepia by the given
+// amount, from 0 for none to 1 for all.
+func Sepia(amount float32) ColorMatrix {
+	s := 1 - amount
+	return ColorMatrix{
+		{0.393 + 0.607*s, 0.769 - 0.769*s, 0.189 - 0.189*s, 0, 0},
+		{0.349 - 0.349*s, 0.686 + 0.314*s, 0.168 - 0.168*s, 0, 0},
+		{0.272 - 0.272*s, 0.534 - 0.534*s, 0.131 + 0.869*s, 0, 0},
+		{0, 0, 0, 1, 0},
+	}
+}
+
+// HueRotate returns a ColorMatrix that rotates hues by angle radians,
+// keeping their luminance.
+func HueRotate(angle float32) ColorMatrix {
+	c := float32(math.Cos(float64(angle)))
+	s := float32(math.Sin(float64(angle)))
+	return ColorMatrix{
+		{0.213 + c*0.787 - s*0.213, 0.715 - c*0.715 - s*0.715, 0.072 - c*0.072 + s*0.928, 0, 0},
+		{0.213 - c*0.213 + s*0.143, 0.715 + c*0.285 + s*0.140, 0.072 - c*0.072 - s*0.283, 0, 0},
+		{0.213 - c*0.213 - s*0.787, 0.715 - c*0.715 + s*0.715, 0.072 + c*0.928 + s*0.072, 0, 0},
+		{0, 0, 0, 1, 0},
+	}
+}
+
+// Brightness returns a ColorMatrix that scales colors by amount: 0 is
+// black, 1 unchanged, and more is brighter.
+func Brightness(amount float32) ColorMatrix {
+	return ColorMatrix{
+		{amount, 0, 0, 0, 0},
+		{0, amount, 0, 0, 0},
+		{0, 0, amount, 0, 0},
+		{0, 0, 0, 1, 0},
+	}
+}
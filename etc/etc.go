@@ -0,0 +1,357 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package etc decodes images compressed with ETC1 and ETC2, the texture
+// compression of OpenGL ES.
+//
+// An Image holds the compressed blocks as they are given to a GPU. An
+// Engine that cannot draw them compressed decodes them when they are
+// loaded. Images in PKM files, as written by etcpack, are read by
+// image.Decode once this package is imported.
+package etc
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/crawshaw/sprite"
+)
+
+// An Image is an image compressed in blocks of 4x4 pixels, in rows from
+// the top-left of Rect. Each block is 8 bytes, or 16 for
+// sprite.FormatETC2RGBA: the alpha, then the color. Blocks on the right
+// and bottom edges may cover pixels beyond Rect.
+type Image struct {
+	Format sprite.Format // FormatETC1, FormatETC2RGB, FormatETC2RGBA or FormatETC2RGBA1
+	Rect   image.Rectangle
+	Pix    []byte
+}
+
+// BlockSize returns the bytes in each block of f, or 0 if f is not
+// compressed with ETC.
+func BlockSize(f sprite.Format) int {
+	switch f {
+	case sprite.FormatETC1, sprite.FormatETC2RGB, sprite.FormatETC2RGBA1:
+		return 8
+	case sprite.FormatETC2RGBA:
+		return 16
+	}
+	return 0
+}
+
+// DataSize returns the bytes of a w by h image in the format f.
+func DataSize(f sprite.Format, w, h int) int {
+	return BlockSize(f) * ((w + 3) / 4) * ((h + 3) / 4)
+}
+
+func (m *Image) ColorModel() color.Model { return color.NRGBAModel }
+
+func (m *Image) Bounds() image.Rectangle { return m.Rect }
+
+func (m *Image) At(x, y int) color.Color {
+	if !(image.Point{x, y}.In(m.Rect)) {
+		return color.NRGBA{}
+	}
+	bx, by := (x-m.Rect.Min.X)/4, (y-m.Rect.Min.Y)/4
+	n := BlockSize(m.Format)
+	i := (by*((m.Rect.Dx()+3)/4) + bx) * n
+	if n == 0 || i+n > len(m.Pix) {
+		return color.NRGBA{}
+	}
+	var b block
+	decodeBlock(&b, m.Format, m.Pix[i:i+n])
+	return b[(x-m.Rect.Min.X)%4][(y-m.Rect.Min.Y)%4]
+}
+
+// Decode returns the pixels of m. It reports an error if the format is
+// not ETC or Pix is too short.
+func (m *Image) Decode() (*image.NRGBA, error) {
+	n := BlockSize(m.Format)
+	if n == 0 {
+		return nil, fmt.Errorf("etc: format %d is not ETC", m.Format)
+	}
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	if size := DataSize(m.Format, w, h); len(m.Pix) < size {
+		return nil, fmt.Errorf("etc: %d bytes of data for a %dx%d image, want %d", len(m.Pix), w, h, size)
+	}
+	dst := image.NewNRGBA(m.Rect)
+	var b block
+	i := 0
+	for by := 0; by < h; by += 4 {
+		for bx := 0; bx < w; bx += 4 {
+			decodeBlock(&b, m.Format, m.Pix[i:i+n])
+			i += n
+			for x := 0; x < 4 && bx+x < w; x++ {
+				for y := 0; y < 4 && by+y < h; y++ {
+					dst.SetNRGBA(m.Rect.Min.X+bx+x, m.Rect.Min.Y+by+y, b[x][y])
+				}
+			}
+		}
+	}
+	return dst, nil
+}
+
+// A block is the pixels of a block, by column and then row.
+type block [4][4]color.NRGBA
+
+// decodeBlock decodes the block data in the format f into b.
+func decodeBlock(b *block, f sprite.Format, data []byte) {
+	if f == sprite.FormatETC2RGBA {
+		decodeColor(b, be64(data[8:]), false)
+		decodeAlpha(b, be64(data))
+		return
+	}
+	decodeColor(b, be64(data), f == sprite.FormatETC2RGBA1)
+}
+
+func be64(b []byte) uint64 {
+	return uint64(b[0])<<56 | uint64(b[1])<<48 | uint64(b[2])<<40 | uint64(b[3])<<32 |
+		uint64(b[4])<<24 | uint64(b[5])<<16 | uint64(b[6])<<8 | uint64(b[7])
+}
+
+// bits returns the bits hi down to lo of v.
+func bits(v uint64, hi, lo uint) int {
+	return int(v>>lo) & (1<<(hi-lo+1) - 1)
+}
+
+// extend widens a color channel of n bits to 8, repeating its high bits
+// in the low ones.
+func extend(c int, n uint) int {
+	c <<= 8 - n
+	return c | c>>n
+}
+
+func clamp(c int) uint8 {
+	switch {
+	case c < 0:
+		return 0
+	case c > 255:
+		return 255
+	}
+	return uint8(c)
+}
+
+// modifiers are the intensity modifiers of the individual and
+// differential modes, for pixel indices 0 and 1. Indices 2 and 3 are
+// their negations.
+var modifiers = [8][2]int{
+	{2, 8}, {5, 17}, {9, 29}, {13, 42},
+	{18, 60}, {24, 80}, {33, 106}, {47, 183},
+}
+
+// distances are the distances between paint colors in the T and H
+// modes.
+var distances = [8]int{3, 6, 11, 16, 23, 32, 41, 64}
+
+// decodeColor decodes the 64-bit color block v into b, which it makes
+// opaque. If punch is set, the block is ETC2 RGBA1, whose pixels may be
+// transparent.
+//
+// The low 32 bits of v are two bits for each pixel, the high ones
+// above the low ones, indexed by column and then row. The high 32 bits
+// choose how the index gives the color. ETC1 blocks are ETC2 blocks
+// that use only the individual and differential modes.
+func decodeColor(b *block, v uint64, punch bool) {
+	diff := v&(1<<33) != 0
+	opaque := true
+	if punch {
+		// The bit of the individual mode marks opaque blocks.
+		opaque, diff = diff, true
+	}
+
+	var c1, c2 [3]int
+	if !diff {
+		for k := 0; k < 3; k++ {
+			c1[k] = extend(bits(v, uint(63-8*k), uint(60-8*k)), 4)
+			c2[k] = extend(bits(v, uint(59-8*k), uint(56-8*k)), 4)
+		}
+	} else {
+		var base, sum [3]int
+		for k := 0; k < 3; k++ {
+			base[k] = bits(v, uint(63-8*k), uint(59-8*k))
+			d := bits(v, uint(58-8*k), uint(56-8*k))
+			if d >= 4 {
+				d -= 8
+			}
+			sum[k] = base[k] + d
+		}
+		switch {
+		case sum[0] < 0 || sum[0] > 31:
+			decodeT(b, v, opaque)
+			return
+		case sum[1] < 0 || sum[1] > 31:
+			decodeH(b, v, opaque)
+			return
+		case sum[2] < 0 || sum[2] > 31:
+			decodePlanar(b, v)
+			return
+		}
+		for k := 0; k < 3; k++ {
+			c1[k] = extend(base[k], 5)
+			c2[k] = extend(sum[k], 5)
+		}
+	}
+
+	flip := v&(1<<32) != 0
+	tables := [2]int{bits(v, 39, 37), bits(v, 36, 34)}
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 4; y++ {
+			sub, c := 0, c1
+			if flip && y >= 2 || !flip && x >= 2 {
+				sub, c = 1, c2
+			}
+			i := index(v, x, y)
+			m := modifiers[tables[sub]][i&1]
+			if i&2 != 0 {
+				m = -m
+			}
+			if !opaque {
+				// Index 0 is the base color, index 2 transparent.
+				switch i {
+				case 0:
+					m = 0
+				case 2:
+					b[x][y] = color.NRGBA{}
+					continue
+				}
+			}
+			b[x][y] = color.NRGBA{clamp(c[0] + m), clamp(c[1] + m), clamp(c[2] + m), 0xff}
+		}
+	}
+}
+
+// index returns the 2-bit index of the pixel (x, y) of the color block
+// v.
+func index(v uint64, x, y int) int {
+	i := uint(x*4 + y)
+	return int(v>>(i+16))&1<<1 | int(v>>i)&1
+}
+
+// paint fills b with the four paint colors of the T and H modes, chosen
+// by the index of each pixel. Unless opaque, index 2 is transparent.
+func paint(b *block, v uint64, p [4][3]int, opaque bool) {
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 4; y++ {
+			i := index(v, x, y)
+			if !opaque && i == 2 {
+				b[x][y] = color.NRGBA{}
+				continue
+			}
+			c := p[i]
+			b[x][y] = color.NRGBA{clamp(c[0]), clamp(c[1]), clamp(c[2]), 0xff}
+		}
+	}
+}
+
+// decodeT decodes a block of the ETC2 T mode, whose paint colors are
+// the first base color and the second moved along the gray axis.
+func decodeT(b *block, v uint64, opaque bool) {
+	c1 := [3]int{
+		extend(bits(v, 60, 59)<<2|bits(v, 57, 56), 4),
+		extend(bits(v, 55, 52), 4),
+		extend(bits(v, 51, 48), 4),
+	}
+	c2 := [3]int{
+		extend(bits(v, 47, 44), 4),
+		extend(bits(v, 43, 40), 4),
+		extend(bits(v, 39, 36), 4),
+	}
+	d := distances[bits(v, 35, 34)<<1|bits(v, 32, 32)]
+	var p [4][3]int
+	for k := 0; k < 3; k++ {
+		p[0][k] = c1[k]
+		p[1][k] = c2[k] + d
+		p[2][k] = c2[k]
+		p[3][k] = c2[k] - d
+	}
+	paint(b, v, p, opaque)
+}
+
+// decodeH decodes a block of the ETC2 H mode, whose paint colors are
+// both base colors moved either way along the gray axis.
+func decodeH(b *block, v uint64, opaque bool) {
+	r1, g1, b1 := bits(v, 62, 59), bits(v, 58, 56)<<1|bits(v, 52, 52), bits(v, 51, 51)<<3|bits(v, 49, 47)
+	r2, g2, b2 := bits(v, 46, 43), bits(v, 42, 39), bits(v, 38, 35)
+	// The order of the base colors is the lowest bit of the distance.
+	di := bits(v, 34, 34)<<2 | bits(v, 32, 32)<<1
+	if r1<<8|g1<<4|b1 >= r2<<8|g2<<4|b2 {
+		di |= 1
+	}
+	d := distances[di]
+	c1 := [3]int{extend(r1, 4), extend(g1, 4), extend(b1, 4)}
+	c2 := [3]int{extend(r2, 4), extend(g2, 4), extend(b2, 4)}
+	var p [4][3]int
+	for k := 0; k < 3; k++ {
+		p[0][k] = c1[k] + d
+		p[1][k] = c1[k] - d
+		p[2][k] = c2[k] + d
+		p[3][k] = c2[k] - d
+	}
+	paint(b, v, p, opaque)
+}
+
+// decodePlanar decodes a block of the ETC2 planar mode, a gradient
+// through the colors of its origin and of the pixels four to the right
+// of it and four below it. Planar blocks are always opaque.
+func decodePlanar(b *block, v uint64) {
+	o := [3]int{
+		extend(bits(v, 62, 57), 6),
+		extend(bits(v, 56, 56)<<6|bits(v, 54, 49), 7),
+		extend(bits(v, 48, 48)<<5|bits(v, 44, 43)<<3|bits(v, 41, 39), 6),
+	}
+	h := [3]int{
+		extend(bits(v, 38, 34)<<1|bits(v, 32, 32), 6),
+		extend(bits(v, 31, 25), 7),
+		extend(bits(v, 24, 19), 6),
+	}
+	vv := [3]int{
+		extend(bits(v, 18, 13), 6),
+		extend(bits(v, 12, 6), 7),
+		extend(bits(v, 5, 0), 6),
+	}
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 4; y++ {
+			var c [3]uint8
+			for k := range c {
+				c[k] = clamp((x*(h[k]-o[k]) + y*(vv[k]-o[k]) + 4*o[k] + 2) >> 2)
+			}
+			b[x][y] = color.NRGBA{c[0], c[1], c[2], 0xff}
+		}
+	}
+}
+
+// alphaModifiers are the modifiers of EAC alpha blocks, for each of the
+// 3-bit pixel indices.
+var alphaModifiers = [16][8]int{
+	{-3, -6, -9, -15, 2, 5, 8, 14},
+	{-3, -7, -10, -13, 2, 6, 9, 12},
+	{-2, -5, -8, -13, 1, 4, 7, 12},
+	{-2, -4, -6, -13, 1, 3, 5, 12},
+	{-3, -6, -8, -12, 2, 5, 7, 11},
+	{-3, -7, -9, -11, 2, 6, 8, 10},
+	{-4, -7, -8, -11, 3, 6, 7, 10},
+	{-3, -5, -8, -11, 2, 4, 7, 10},
+	{-2, -6, -8, -10, 1, 5, 7, 9},
+	{-2, -5, -8, -10, 1, 4, 7, 9},
+	{-2, -4, -8, -10, 1, 3, 7, 9},
+	{-2, -5, -7, -10, 1, 4, 6, 9},
+	{-3, -4, -7, -10, 2, 3, 6, 9},
+	{-1, -2, -3, -10, 0, 1, 2, 9},
+	{-4, -6, -8, -9, 3, 5, 7, 8},
+	{-3, -5, -7, -9, 2, 4, 6, 8},
+}
+
+// decodeAlpha sets the alpha of b from the 64-bit EAC block v: a base
+// value, a multiplier and a table of modifiers, then three bits for
+// each pixel, indexed by column and then row.
+func decodeAlpha(b *block, v uint64) {
+	base, mul, table := bits(v, 63, 56), bits(v, 55, 52), bits(v, 51, 48)
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 4; y++ {
+			i := uint(x*4 + y)
+			b[x][y].A = clamp(base + alphaModifiers[table][bits(v, 47-3*i, 45-3*i)]*mul)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package etc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/crawshaw/sprite"
+)
+
+// A blockBits is a 64-bit block being built. set sets its bits hi down
+// to lo to x, and index sets the 2-bit index of the pixel (x, y) to i.
+type blockBits uint64
+
+func (b *blockBits) set(hi, lo uint, x int) *blockBits {
+	mask := uint64(1)<<(hi-lo+1) - 1
+	*b = blockBits(uint64(*b)&^(mask<<lo) | (uint64(x)&mask)<<lo)
+	return b
+}
+
+func (b *blockBits) index(x, y, i int) *blockBits {
+	p := uint(x*4 + y)
+	return b.set(p, p, i&1).set(p+16, p+16, i>>1)
+}
+
+func (b blockBits) bytes() []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(b))
+	return buf[:]
+}
+
+func decode(f sprite.Format, data []byte) *block {
+	b := new(block)
+	decodeBlock(b, f, data)
+	return b
+}
+
+func checkBlock(t *testing.T, name string, b *block, want map[image.Point]color.NRGBA) {
+	for p, w := range want {
+		if got := b[p.X][p.Y]; got != w {
+			t.Errorf("%s: pixel %v = %v, want %v", name, p, got, w)
+		}
+	}
+}
+
+func TestIndividual(t *testing.T) {
+	// Red on the left, green on the right, with the tables of the
+	// smallest and largest modifiers.
+	var v blockBits
+	v.set(63, 60, 0xf).set(51, 48, 0xf).set(39, 37, 0).set(36, 34, 7)
+	v.index(0, 0, 3).index(3, 3, 1)
+	checkBlock(t, "individual", decode(sprite.FormatETC1, v.bytes()), map[image.Point]color.NRGBA{
+		{0, 0}: {247, 0, 0, 0xff},
+		{1, 3}: {255, 2, 2, 0xff},
+		{2, 0}: {47, 255, 47, 0xff},
+		{3, 3}: {183, 255, 183, 0xff},
+	})
+}
+
+func TestDifferential(t *testing.T) {
+	// Flipped, so the subblocks are the top and bottom halves.
+	var v blockBits
+	v.set(33, 32, 3)
+	v.set(63, 59, 31).set(58, 56, 7) // 31, then 30
+	v.set(47, 43, 16).set(42, 40, 3) // 16, then 19
+	v.index(3, 0, 2)
+	checkBlock(t, "differential", decode(sprite.FormatETC2RGB, v.bytes()), map[image.Point]color.NRGBA{
+		{0, 0}: {255, 2, 134, 0xff},
+		{3, 0}: {253, 0, 130, 0xff},
+		{3, 1}: {255, 2, 134, 0xff},
+		{0, 2}: {249, 2, 158, 0xff},
+		{3, 3}: {249, 2, 158, 0xff},
+	})
+}
+
+func TestT(t *testing.T) {
+	var v blockBits
+	v.set(33, 33, 1)
+	// The red of the first base color is in bits 60-59 and 57-56. The
+	// bits around them make red overflow: 30 + 2.
+	v.set(63, 61, 7).set(60, 59, 2).set(58, 58, 0).set(57, 56, 2)
+	v.set(55, 52, 5).set(51, 48, 0)
+	v.set(47, 44, 8).set(43, 40, 8).set(39, 36, 8)
+	v.set(35, 34, 2).set(32, 32, 1) // distance 5, 32
+	v.index(1, 0, 1).index(2, 0, 2).index(3, 0, 3)
+	want := map[image.Point]color.NRGBA{
+		{0, 0}: {170, 85, 0, 0xff},
+		{1, 0}: {168, 168, 168, 0xff},
+		{2, 0}: {136, 136, 136, 0xff},
+		{3, 0}: {104, 104, 104, 0xff},
+	}
+	checkBlock(t, "T", decode(sprite.FormatETC2RGB, v.bytes()), want)
+
+	// Without the opaque bit, index 2 is transparent.
+	want[image.Point{2, 0}] = color.NRGBA{}
+	checkBlock(t, "T punch-through", decode(sprite.FormatETC2RGBA1, v.set(33, 33, 0).bytes()), want)
+}
+
+func TestH(t *testing.T) {
+	var v blockBits
+	v.set(33, 33, 1)
+	v.set(62, 59, 2)                               // R1
+	v.set(58, 56, 3).set(52, 52, 0)                // G1 6
+	v.set(51, 51, 1).set(49, 47, 7)                // B1 15
+	v.set(55, 53, 7).set(50, 50, 0)                // green overflows: 29 + 3
+	v.set(46, 43, 4).set(42, 39, 4).set(38, 35, 4) // C2
+	v.set(34, 34, 1).set(32, 32, 0)                // distance 4, as C1 < C2
+	v.index(1, 1, 1).index(2, 2, 2).index(3, 3, 3)
+	checkBlock(t, "H", decode(sprite.FormatETC2RGB, v.bytes()), map[image.Point]color.NRGBA{
+		{0, 0}: {57, 125, 255, 0xff},
+		{1, 1}: {11, 79, 232, 0xff},
+		{2, 2}: {91, 91, 91, 0xff},
+		{3, 3}: {45, 45, 45, 0xff},
+	})
+}
+
+func TestPlanar(t *testing.T) {
+	// Red grows to the right, blue downwards, and green is full.
+	var v blockBits
+	v.set(33, 33, 1)
+	v.set(62, 57, 0)                                     // RO
+	v.set(56, 56, 1).set(54, 49, 0x3f)                   // GO
+	v.set(48, 48, 0).set(44, 43, 0).set(41, 39, 0)       // BO
+	v.set(47, 45, 0).set(42, 42, 1)                      // blue overflows: 0 - 4
+	v.set(38, 34, 0x1f).set(32, 32, 1)                   // RH
+	v.set(31, 25, 0x7f).set(12, 6, 0x7f).set(5, 0, 0x3f) // GH, GV, BV
+	b := decode(sprite.FormatETC2RGB, v.bytes())
+	ramp := [4]uint8{0, 64, 128, 191}
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 4; y++ {
+			if got, want := b[x][y], (color.NRGBA{ramp[x], 255, ramp[y], 0xff}); got != want {
+				t.Errorf("pixel (%d, %d) = %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestPunchThrough(t *testing.T) {
+	// A differential block, of gray 0x84, with no opaque bit: index 0
+	// is the base color and index 2 transparent.
+	var v blockBits
+	v.set(63, 59, 16).set(55, 51, 16).set(47, 43, 16).set(39, 34, 0)
+	v.index(0, 1, 1).index(0, 2, 2).index(0, 3, 3)
+	want := map[image.Point]color.NRGBA{
+		{0, 0}: {132, 132, 132, 0xff},
+		{0, 1}: {140, 140, 140, 0xff},
+		{0, 2}: {},
+		{0, 3}: {124, 124, 124, 0xff},
+	}
+	checkBlock(t, "transparent", decode(sprite.FormatETC2RGBA1, v.bytes()), want)
+
+	// With it, index 0 is modified as usual.
+	want[image.Point{0, 0}] = color.NRGBA{134, 134, 134, 0xff}
+	want[image.Point{0, 2}] = color.NRGBA{130, 130, 130, 0xff}
+	checkBlock(t, "opaque", decode(sprite.FormatETC2RGBA1, v.set(33, 33, 1).bytes()), want)
+}
+
+func TestAlpha(t *testing.T) {
+	var a blockBits
+	a.set(63, 56, 128).set(55, 52, 2).set(51, 48, 13) // {-1, -2, -3, -10, 0, 1, 2, 9}
+	for i := uint(0); i < 16; i++ {
+		a.set(47-3*i, 45-3*i, 4)
+	}
+	a.set(47, 45, 3) // pixel (0, 0)
+	a.set(44, 42, 7) // pixel (0, 1)
+	var c blockBits
+	c.set(33, 33, 1)
+	b := decode(sprite.FormatETC2RGBA, append(a.bytes(), c.bytes()...))
+	for _, tc := range []struct {
+		x, y int
+		want uint8
+	}{
+		{0, 0, 108},
+		{0, 1, 146},
+		{3, 3, 128},
+	} {
+		if got := b[tc.x][tc.y].A; got != tc.want {
+			t.Errorf("alpha (%d, %d) = %d, want %d", tc.x, tc.y, got, tc.want)
+		}
+	}
+
+	// Alpha is clamped.
+	a.set(63, 56, 250).set(55, 52, 15)
+	b = decode(sprite.FormatETC2RGBA, append(a.bytes(), c.bytes()...))
+	if got := b[0][1].A; got != 255 {
+		t.Errorf("alpha = %d, want 255", got)
+	}
+}
+
+// stripes returns an ETC1 image of w by h whose blocks are solid
+// grays, 0x00, 0x11, 0x22 and so on in order.
+func stripes(w, h int) *Image {
+	m := &Image{Format: sprite.FormatETC1, Rect: image.Rect(0, 0, w, h)}
+	for i := 0; i < DataSize(m.Format, w, h)/8; i++ {
+		var v blockBits
+		g := i % 16
+		v.set(63, 56, g<<4|g).set(55, 48, g<<4|g).set(47, 40, g<<4|g)
+		// Index 0 adds 2, so take 2 away by index 2 of table 0.
+		for x := 0; x < 4; x++ {
+			for y := 0; y < 4; y++ {
+				v.index(x, y, 2)
+			}
+		}
+		m.Pix = append(m.Pix, v.bytes()...)
+	}
+	return m
+}
+
+func TestDecode(t *testing.T) {
+	m := stripes(6, 5)
+	got, err := m.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Bounds() != m.Bounds() {
+		t.Fatalf("bounds %v, want %v", got.Bounds(), m.Bounds())
+	}
+	for _, tc := range []struct {
+		x, y int
+		gray uint8
+	}{
+		{0, 0, 0},
+		{3, 3, 0},
+		{4, 0, 0x11 - 2},
+		{5, 3, 0x11 - 2},
+		{0, 4, 0x22 - 2},
+		{5, 4, 0x33 - 2},
+	} {
+		want := color.NRGBA{tc.gray, tc.gray, tc.gray, 0xff}
+		if c := got.NRGBAAt(tc.x, tc.y); c != want {
+			t.Errorf("Decode (%d, %d) = %v, want %v", tc.x, tc.y, c, want)
+		}
+		if c := m.At(tc.x, tc.y); c != want {
+			t.Errorf("At (%d, %d) = %v, want %v", tc.x, tc.y, c, want)
+		}
+	}
+
+	m.Pix = m.Pix[:len(m.Pix)-1]
+	if _, err := m.Decode(); err == nil {
+		t.Error("Decode of short data succeeded")
+	}
+	if _, err := (&Image{Rect: m.Rect}).Decode(); err == nil {
+		t.Error("Decode of RGBA succeeded")
+	}
+}
+
+func pkm(version string, format, pw, ph, w, h uint16, data []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("PKM " + version)
+	binary.Write(&buf, binary.BigEndian, [5]uint16{format, pw, ph, w, h})
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+func TestPKM(t *testing.T) {
+	want := stripes(6, 5)
+	file := pkm("10", 0, 8, 8, 6, 5, want.Pix)
+	cfg, name, err := image.DecodeConfig(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "pkm" || cfg.Width != 6 || cfg.Height != 5 {
+		t.Errorf("DecodeConfig = %+v, %q", cfg, name)
+	}
+	m, _, err := image.Decode(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := m.(*Image)
+	if !ok {
+		t.Fatalf("decoded a %T", m)
+	}
+	if got.Format != sprite.FormatETC1 || got.Rect != want.Rect || !bytes.Equal(got.Pix, want.Pix) {
+		t.Errorf("decoded %v %v, want %v %v", got.Format, got.Rect, want.Format, want.Rect)
+	}
+
+	// Padding to more blocks than the image has is dropped.
+	wide := make([]byte, 0, DataSize(sprite.FormatETC1, 12, 8))
+	for by := 0; by < 2; by++ {
+		wide = append(wide, want.Pix[by*16:by*16+16]...)
+		wide = append(wide, make([]byte, 8)...)
+	}
+	m, err = Decode(bytes.NewReader(pkm("20", 1, 12, 8, 6, 5, wide)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.(*Image); got.Format != sprite.FormatETC2RGB || !bytes.Equal(got.Pix, want.Pix) {
+		t.Errorf("padded: %v %x, want %x", got.Format, got.Pix, want.Pix)
+	}
+	// The padding after the last block of the image may be left out.
+	m, err = Decode(bytes.NewReader(pkm("20", 1, 12, 12, 6, 5, wide[:len(wide)-8])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.(*Image); !bytes.Equal(got.Pix, want.Pix) {
+		t.Errorf("unpadded: %x, want %x", got.Pix, want.Pix)
+	}
+
+	for _, tc := range []struct {
+		name string
+		file []byte
+	}{
+		{"version", pkm("30", 0, 8, 8, 6, 5, want.Pix)},
+		{"format", pkm("20", 5, 8, 8, 6, 5, want.Pix)},
+		{"v1 format", pkm("10", 1, 8, 8, 6, 5, want.Pix)},
+		{"size", pkm("10", 0, 4, 4, 6, 5, want.Pix)},
+		{"short", pkm("10", 0, 8, 8, 6, 5, want.Pix[:10])},
+		{"header", []byte("PKM 10")},
+	} {
+		if _, err := Decode(bytes.NewReader(tc.file)); err == nil {
+			t.Errorf("%s: no error", tc.name)
+		}
+	}
+}
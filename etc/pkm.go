@@ -0,0 +1,108 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package etc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+
+	"github.com/crawshaw/sprite"
+)
+
+// A PKM file is a 16-byte header and the blocks of one image:
+//
+//	"PKM ", then the version "10" or "20"
+//	the format, as a big-endian uint16
+//	the width and height padded to blocks, as big-endian uint16s
+//	the width and height of the image, as big-endian uint16s
+type pkmHeader struct {
+	Magic         [4]byte
+	Version       [2]byte
+	Format        uint16
+	PaddedWidth   uint16
+	PaddedHeight  uint16
+	Width, Height uint16
+}
+
+// pkmFormats are the formats of PKM files, by their number. Others are
+// of single and dual channel EAC, which are not colors.
+var pkmFormats = map[uint16]sprite.Format{
+	0: sprite.FormatETC1,
+	1: sprite.FormatETC2RGB,
+	3: sprite.FormatETC2RGBA,
+	4: sprite.FormatETC2RGBA1,
+}
+
+func init() {
+	image.RegisterFormat("pkm", "PKM ", Decode, DecodeConfig)
+}
+
+func readHeader(r io.Reader) (*pkmHeader, sprite.Format, error) {
+	h := new(pkmHeader)
+	if err := binary.Read(r, binary.BigEndian, h); err != nil {
+		return nil, 0, fmt.Errorf("etc: reading PKM header: %v", err)
+	}
+	if string(h.Magic[:]) != "PKM " {
+		return nil, 0, fmt.Errorf("etc: not a PKM file")
+	}
+	v := string(h.Version[:])
+	if v != "10" && v != "20" {
+		return nil, 0, fmt.Errorf("etc: unknown PKM version %q", v)
+	}
+	f, ok := pkmFormats[h.Format]
+	if !ok || v == "10" && h.Format != 0 {
+		return nil, 0, fmt.Errorf("etc: unsupported PKM format %d", h.Format)
+	}
+	if int(h.PaddedWidth) < int(h.Width) || int(h.PaddedHeight) < int(h.Height) {
+		return nil, 0, fmt.Errorf("etc: PKM image %dx%d larger than its blocks, %dx%d", h.Width, h.Height, h.PaddedWidth, h.PaddedHeight)
+	}
+	return h, f, nil
+}
+
+// Decode reads a PKM file, returning an *Image.
+func Decode(r io.Reader) (image.Image, error) {
+	h, f, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	m := &Image{
+		Format: f,
+		Rect:   image.Rect(0, 0, int(h.Width), int(h.Height)),
+		Pix:    make([]byte, DataSize(f, int(h.Width), int(h.Height))),
+	}
+	// Only the blocks of the image are read. Padding to more blocks,
+	// at the end of each row and below the last, is skipped, and need
+	// not be in the file after the last block of the image.
+	bs := BlockSize(f)
+	bw, pbw := (m.Rect.Dx()+3)/4*bs, (int(h.PaddedWidth)+3)/4*bs
+	for y := 0; y < len(m.Pix); y += bw {
+		if y > 0 && pbw > bw {
+			if _, err := io.CopyN(ioutil.Discard, r, int64(pbw-bw)); err != nil {
+				return nil, fmt.Errorf("etc: reading PKM data: %v", err)
+			}
+		}
+		if _, err := io.ReadFull(r, m.Pix[y:y+bw]); err != nil {
+			return nil, fmt.Errorf("etc: reading PKM data: %v", err)
+		}
+	}
+	return m, nil
+}
+
+// DecodeConfig returns the color model and size of a PKM file.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	h, _, err := readHeader(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{
+		ColorModel: color.NRGBAModel,
+		Width:      int(h.Width),
+		Height:     int(h.Height),
+	}, nil
+}
@@ -159,10 +159,10 @@ func loadTextures() []sprite.SubTex {
 	}
 
 	return []sprite.SubTex{
-		texBooks:   sprite.SubTex{t, image.Rect(4, 71, 132, 182)},
-		texFire:    sprite.SubTex{t, image.Rect(330, 56, 440, 155)},
-		texGopherR: sprite.SubTex{t, image.Rect(152, 10, 152+140, 10+90)},
-		texGopherL: sprite.SubTex{t, image.Rect(162, 120, 162+140, 120+90)},
+		texBooks:   sprite.SubTex{T: t, R: image.Rect(4, 71, 132, 182)},
+		texFire:    sprite.SubTex{T: t, R: image.Rect(330, 56, 440, 155)},
+		texGopherR: sprite.SubTex{T: t, R: image.Rect(152, 10, 152+140, 10+90)},
+		texGopherL: sprite.SubTex{T: t, R: image.Rect(162, 120, 162+140, 120+90)},
 	}
 }
 
@@ -0,0 +1,491 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package glsprite
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"golang.org/x/mobile/f32"
+	"golang.org/x/mobile/gl"
+	"golang.org/x/mobile/gl/glutil"
+
+	"github.com/crawshaw/sprite"
+	"github.com/crawshaw/sprite/clock"
+)
+
+// renderEffects draws n, whose transform is m, with its Effects.
+//
+// As in the portable engine, the node and its descendants are drawn
+// offscreen, into a texture the size of the viewport, with no clip: the
+// clips of n and its ancestors apply to the result. Each effect is one
+// or more passes over the whole texture, and the result is drawn over
+// the viewport. If the texture cannot be drawn into, the node is drawn
+// without its effects.
+func (e *engine) renderEffects(n *sprite.Node, m *f32.Affine, t clock.Time) {
+	var vp [4]int32
+	gl.GetIntegerv(gl.VIEWPORT, vp[:])
+	w, h := int(vp[2]), int(vp[3])
+	l := e.target(w, h)
+	restore := bindFramebuffer(l.fb)
+	if status := gl.CheckFramebufferStatus(gl.FRAMEBUFFER); status != gl.FRAMEBUFFER_COMPLETE {
+		restore()
+		e.free = append(e.free, l)
+		e.renderContent(n, m, t)
+		return
+	}
+	gl.Viewport(0, 0, w, h)
+
+	frameScissors, frameStencils, frameDepth := e.scissors, e.stencils, e.depth
+	frameHasStencil, frameOrigin := e.hasStencil, e.origin
+	e.scissors, e.stencils, e.depth = nil, nil, 0
+	e.hasStencil, e.origin = true, image.Point{}
+	e.setScissor()
+	gl.ClearColor(0, 0, 0, 0)
+	gl.ClearStencil(0)
+	gl.Clear(gl.COLOR_BUFFER_BIT | gl.STENCIL_BUFFER_BIT)
+	e.setStencil()
+	e.renderContent(n, m, t)
+
+	// Each pass replaces what its target holds.
+	e.blend = sprite.BlendSrc
+	setBlend(e.blend)
+	for _, fx := range n.Effects {
+		l = e.applyEffect(l, fx)
+	}
+
+	restore()
+	e.scissors, e.stencils, e.depth = frameScissors, frameStencils, frameDepth
+	e.hasStencil, e.origin = frameHasStencil, frameOrigin
+	e.setScissor()
+	e.setStencil()
+	e.blend = sprite.BlendNormal
+	setBlend(e.blend)
+	p := e.effectProgram()
+	p.use(effectCopy)
+	bindTexture(p.tex, 0, l.tex)
+	p.draw()
+	e.free = append(e.free, l)
+}
+
+// blendEffects are the effect program modes that composite the blend
+// modes GL blend factors cannot do.
+var blendEffects = map[sprite.BlendMode]int{
+	sprite.BlendOverlay: effectOverlay,
+	sprite.BlendDarken:  effectDarken,
+	sprite.BlendLighten: effectLighten,
+}
+
+// renderBlend draws the SubTex and Curve of n, whose transform is m,
+// with one of the blend modes of blendEffects.
+//
+// As with effects, the node is drawn offscreen, into a texture the size
+// of the viewport. A copy of the viewport is then read by the effect
+// program with it, to composite the two as the portable engine does.
+// If the texture cannot be drawn into, the node is drawn as Normal.
+func (e *engine) renderBlend(n *sprite.Node, m *f32.Affine, t clock.Time) {
+	var vp [4]int32
+	gl.GetIntegerv(gl.VIEWPORT, vp[:])
+	w, h := int(vp[2]), int(vp[3])
+	l := e.target(w, h)
+	restore := bindFramebuffer(l.fb)
+	if status := gl.CheckFramebufferStatus(gl.FRAMEBUFFER); status != gl.FRAMEBUFFER_COMPLETE {
+		restore()
+		e.free = append(e.free, l)
+		e.blend = sprite.BlendNormal
+		setBlend(e.blend)
+		e.draw(n, m, t)
+		return
+	}
+	gl.Viewport(0, 0, w, h)
+
+	frameScissors, frameStencils, frameDepth := e.scissors, e.stencils, e.depth
+	frameHasStencil, frameOrigin := e.hasStencil, e.origin
+	e.scissors, e.stencils, e.depth = nil, nil, 0
+	e.hasStencil, e.origin = true, image.Point{}
+	e.setScissor()
+	gl.ClearColor(0, 0, 0, 0)
+	gl.ClearStencil(0)
+	gl.Clear(gl.COLOR_BUFFER_BIT | gl.STENCIL_BUFFER_BIT)
+	e.setStencil()
+	e.blend = sprite.BlendNormal
+	setBlend(e.blend)
+	e.draw(n, m, t)
+
+	restore()
+	e.scissors, e.stencils, e.depth = frameScissors, frameStencils, frameDepth
+	e.hasStencil, e.origin = frameHasStencil, frameOrigin
+	e.setScissor()
+	e.setStencil()
+
+	// A framebuffer without alpha can only be copied to a texture
+	// without alpha, which reads as opaque.
+	if e.backdrop.Value == 0 {
+		e.backdrop = gl.CreateTexture()
+		gl.BindTexture(gl.TEXTURE_2D, e.backdrop)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, int(gl.NEAREST))
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, int(gl.NEAREST))
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, int(gl.CLAMP_TO_EDGE))
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, int(gl.CLAMP_TO_EDGE))
+	}
+	format := gl.Enum(gl.RGBA)
+	if gl.GetInteger(gl.ALPHA_BITS) == 0 {
+		format = gl.RGB
+	}
+	gl.BindTexture(gl.TEXTURE_2D, e.backdrop)
+	gl.CopyTexImage2D(gl.TEXTURE_2D, 0, format, int(vp[0]), int(vp[1]), w, h, 0)
+
+	// The result replaces the destination, which it includes.
+	e.blend = sprite.BlendSrc
+	setBlend(e.blend)
+	p := e.effectProgram()
+	p.use(blendEffects[n.Blend])
+	bindTexture(p.tex, 0, l.tex)
+	bindTexture(p.under, 1, e.backdrop)
+	p.draw()
+	e.free = append(e.free, l)
+}
+
+// applyEffect applies fx to the texture of l, and returns the target
+// that holds the result, which may be l.
+func (e *engine) applyEffect(l *target, fx sprite.Effect) *target {
+	switch fx := fx.(type) {
+	case sprite.Blur:
+		e.blur(l, fx.StdDev.Px())
+	case sprite.DropShadow:
+		c := fx.Color
+		if c == nil {
+			c = color.Black
+		}
+		s := e.shadow(l, fx.Offset.X.Px(), fx.Offset.Y.Px(), c)
+		e.blur(s, fx.Blur.Px())
+		return e.under(l, s, 1)
+	case sprite.Glow:
+		c := fx.Color
+		if c == nil {
+			c = color.White
+		}
+		// As in the portable engine, the blur of the alpha is doubled
+		// so that the glow is opaque at the edge of the drawing.
+		s := e.shadow(l, 0, 0, c)
+		e.blur(s, fx.Radius.Px()/3)
+		return e.under(l, s, 2)
+	case sprite.ColorMatrix:
+		d := e.target(l.w, l.h)
+		p := e.pass(d, effectMatrix)
+		bindTexture(p.tex, 0, l.tex)
+		var mat [16]float32
+		for k := 0; k < 4; k++ {
+			for j := 0; j < 4; j++ {
+				mat[j*4+k] = fx[k][j] // column-major
+			}
+		}
+		gl.UniformMatrix4fv(p.matrix, mat[:])
+		gl.Uniform4f(p.offset, fx[0][4], fx[1][4], fx[2][4], fx[3][4])
+		p.draw()
+		e.free = append(e.free, l)
+		return d
+	}
+	return l
+}
+
+// maxTaps is the most texels a blur pass reads on each side of a texel.
+// Wider blurs space their taps further apart. It is the bound of the
+// loop in effectFragmentShader.
+const maxTaps = 32
+
+// blur applies a Gaussian blur of standard deviation sigma pixels to
+// the texture of l, as a horizontal pass and then a vertical one. The
+// texture is transparent beyond its bounds.
+func (e *engine) blur(l *target, sigma float32) {
+	if sigma <= 0 {
+		return
+	}
+	radius := math.Ceil(float64(3 * sigma))
+	spacing := math.Ceil(radius / maxTaps)
+	taps := math.Ceil(radius / spacing)
+	tmp := e.target(l.w, l.h)
+	for _, pass := range []struct {
+		src, dst *target
+		dx, dy   float64
+	}{
+		{l, tmp, spacing / float64(l.w), 0},
+		{tmp, l, 0, spacing / float64(l.h)},
+	} {
+		p := e.pass(pass.dst, effectBlur)
+		bindTexture(p.tex, 0, pass.src.tex)
+		gl.Uniform2f(p.delta, float32(pass.dx), float32(pass.dy))
+		gl.Uniform1f(p.taps, float32(taps))
+		gl.Uniform1f(p.spacing, float32(spacing))
+		gl.Uniform1f(p.sigma, sigma)
+		p.draw()
+	}
+	e.free = append(e.free, tmp)
+}
+
+// shadow returns a target holding the color c with the alpha of l,
+// moved by (dx, dy) pixels.
+func (e *engine) shadow(l *target, dx, dy float32, c color.Color) *target {
+	s := e.target(l.w, l.h)
+	p := e.pass(s, effectShadow)
+	bindTexture(p.tex, 0, l.tex)
+	// Rows of the texture go up, where y goes down.
+	gl.Uniform2f(p.delta, dx/float32(l.w), -dy/float32(l.h))
+	writeColor(p.color, c)
+	p.draw()
+	return s
+}
+
+// under returns a target holding s, its alpha scaled by strength up to
+// opaque, under l. It frees l and s.
+func (e *engine) under(l, s *target, strength float32) *target {
+	d := e.target(l.w, l.h)
+	p := e.pass(d, effectUnder)
+	bindTexture(p.tex, 0, l.tex)
+	bindTexture(p.under, 1, s.tex)
+	gl.Uniform1f(p.strength, strength)
+	p.draw()
+	e.free = append(e.free, l, s)
+	return d
+}
+
+// A target is an offscreen framebuffer, drawn into by effects. Its
+// texture is the size of the viewport.
+type target struct {
+	fb   gl.Framebuffer
+	tex  gl.Texture
+	rb   gl.Renderbuffer // the stencil buffer, for clips
+	w, h int
+}
+
+// target returns a w by h target, reusing a free one if there is one.
+// Otherwise the free targets, left from a viewport of another size, are
+// deleted.
+func (e *engine) target(w, h int) *target {
+	for i, t := range e.free {
+		if t.w == w && t.h == h {
+			e.free = append(e.free[:i], e.free[i+1:]...)
+			return t
+		}
+	}
+	for _, t := range e.free {
+		t.delete()
+	}
+	e.free = e.free[:0]
+
+	t := &target{
+		fb:  gl.CreateFramebuffer(),
+		tex: gl.CreateTexture(),
+		rb:  gl.CreateRenderbuffer(),
+		w:   w,
+		h:   h,
+	}
+	gl.BindTexture(gl.TEXTURE_2D, t.tex)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, w, h, gl.RGBA, gl.UNSIGNED_BYTE, nil)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, int(gl.LINEAR))
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, int(gl.LINEAR))
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, int(gl.CLAMP_TO_EDGE))
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, int(gl.CLAMP_TO_EDGE))
+	gl.BindRenderbuffer(gl.RENDERBUFFER, t.rb)
+	gl.RenderbufferStorage(gl.RENDERBUFFER, gl.STENCIL_INDEX8, w, h)
+	restore := bindFramebuffer(t.fb)
+	gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, t.tex, 0)
+	gl.FramebufferRenderbuffer(gl.FRAMEBUFFER, gl.STENCIL_ATTACHMENT, gl.RENDERBUFFER, t.rb)
+	restore()
+	return t
+}
+
+func (t *target) delete() {
+	gl.DeleteFramebuffer(t.fb)
+	gl.DeleteTexture(t.tex)
+	gl.DeleteRenderbuffer(t.rb)
+}
+
+// An effectProgram draws the passes of effects, each over the whole of
+// a target, reading textures of the same size.
+type effectProgram struct {
+	p    gl.Program
+	quad gl.Buffer // the corners of the unit square
+
+	pos      gl.Attrib
+	mode     gl.Uniform
+	tex      gl.Uniform
+	under    gl.Uniform
+	delta    gl.Uniform
+	taps     gl.Uniform
+	spacing  gl.Uniform
+	sigma    gl.Uniform
+	color    gl.Uniform
+	matrix   gl.Uniform
+	offset   gl.Uniform
+	strength gl.Uniform
+}
+
+// Modes of the effect fragment shader.
+const (
+	effectCopy   = iota // tex
+	effectBlur          // tex blurred along delta
+	effectShadow        // color, with the alpha of tex moved by delta
+	effectMatrix        // tex, by the color matrix
+	effectUnder         // tex over under, scaled by strength
+
+	// The blend modes of blendEffects, of tex over under.
+	effectOverlay
+	effectDarken
+	effectLighten
+)
+
+const effectVertexShader = `
+attribute vec2 pos;
+varying vec2 uv;
+
+void main() {
+	gl_Position = vec4(pos*2.0 - 1.0, 0, 1);
+	uv = pos;
+}`
+
+const effectFragmentShader = `
+precision mediump float;
+
+uniform int mode;
+uniform sampler2D tex;
+uniform sampler2D under;
+uniform vec2 delta;     // between taps of a blur, or the offset of a shadow
+uniform float taps;     // of a blur, on each side
+uniform float spacing;  // between taps, in texels
+uniform float sigma;    // of a blur, in texels
+uniform vec4 color;     // premultiplied
+uniform mat4 matrix;
+uniform vec4 offset;
+uniform float strength;
+varying vec2 uv;
+
+// read returns the texel of s at p, or transparent outside s.
+vec4 read(sampler2D s, vec2 p) {
+	if (p.x < 0.0 || p.x > 1.0 || p.y < 0.0 || p.y > 1.0) {
+		return vec4(0);
+	}
+	return texture2D(s, p);
+}
+
+void main() {
+	if (mode == 1) {
+		vec4 sum = vec4(0);
+		float total = 0.0;
+		for (int i = -32; i <= 32; i++) {
+			float d = float(i);
+			if (abs(d) > taps) {
+				continue;
+			}
+			float x = d * spacing;
+			float w = exp(-x*x / (2.0*sigma*sigma));
+			sum += read(tex, uv + delta*d) * w;
+			total += w;
+		}
+		gl_FragColor = sum / total;
+		return;
+	}
+	if (mode == 2) {
+		gl_FragColor = color * read(tex, uv - delta).a;
+		return;
+	}
+	vec4 c = texture2D(tex, uv);
+	if (mode == 3) {
+		vec4 v = vec4(0);
+		if (c.a > 0.0) {
+			v = vec4(c.rgb / c.a, c.a);
+		}
+		vec4 r = clamp(matrix*v + offset, 0.0, 1.0);
+		gl_FragColor = vec4(r.rgb * r.a, r.a);
+		return;
+	}
+	if (mode == 4) {
+		vec4 u = texture2D(under, uv);
+		float t = 1.0 - c.a;
+		if (u.a > 0.0) {
+			t *= min(strength, 1.0/u.a);
+		}
+		gl_FragColor = c + u*t;
+		return;
+	}
+	if (mode >= 5) {
+		// As in the portable engine, where both colors are opaque
+		// the result is the blend of the two, elsewhere it fades to
+		// whichever is there. b is the blend, premultiplied by the
+		// alpha of both.
+		vec4 d = texture2D(under, uv);
+		vec3 b;
+		if (mode == 5) {
+			vec3 multiply = 2.0*c.rgb*d.rgb;
+			vec3 screen = c.a*d.a - 2.0*(d.a - d.rgb)*(c.a - c.rgb);
+			b = mix(multiply, screen, step(0.5*d.a, d.rgb));
+		} else if (mode == 6) {
+			b = min(c.rgb*d.a, d.rgb*c.a);
+		} else {
+			b = max(c.rgb*d.a, d.rgb*c.a);
+		}
+		gl_FragColor = vec4(b + c.rgb*(1.0 - d.a) + d.rgb*(1.0 - c.a), c.a + d.a - c.a*d.a);
+		return;
+	}
+	gl_FragColor = c;
+}`
+
+// effectProgram returns the engine's effect program, building it when
+// first used.
+func (e *engine) effectProgram() *effectProgram {
+	if e.fx != nil {
+		return e.fx
+	}
+	p, err := glutil.CreateProgram(effectVertexShader, effectFragmentShader)
+	if err != nil {
+		panic(fmt.Sprintf("glsprite: %v", err))
+	}
+	e.fx = &effectProgram{
+		p:        p,
+		quad:     gl.CreateBuffer(),
+		pos:      gl.GetAttribLocation(p, "pos"),
+		mode:     gl.GetUniformLocation(p, "mode"),
+		tex:      gl.GetUniformLocation(p, "tex"),
+		under:    gl.GetUniformLocation(p, "under"),
+		delta:    gl.GetUniformLocation(p, "delta"),
+		taps:     gl.GetUniformLocation(p, "taps"),
+		spacing:  gl.GetUniformLocation(p, "spacing"),
+		sigma:    gl.GetUniformLocation(p, "sigma"),
+		color:    gl.GetUniformLocation(p, "color"),
+		matrix:   gl.GetUniformLocation(p, "matrix"),
+		offset:   gl.GetUniformLocation(p, "offset"),
+		strength: gl.GetUniformLocation(p, "strength"),
+	}
+	gl.BindBuffer(gl.ARRAY_BUFFER, e.fx.quad)
+	gl.BufferData(gl.ARRAY_BUFFER, gl.STATIC_DRAW, quadCoords)
+	return e.fx
+}
+
+func (p *effectProgram) delete() {
+	gl.DeleteProgram(p.p)
+	gl.DeleteBuffer(p.quad)
+}
+
+// use makes p the current program, in the given mode.
+func (p *effectProgram) use(mode int) {
+	gl.UseProgram(p.p)
+	gl.Uniform1i(p.mode, mode)
+}
+
+// pass binds the framebuffer of dst to be drawn by the effect program
+// in the given mode, which it returns.
+func (e *engine) pass(dst *target, mode int) *effectProgram {
+	gl.BindFramebuffer(gl.FRAMEBUFFER, dst.fb)
+	p := e.effectProgram()
+	p.use(mode)
+	return p
+}
+
+// draw draws over the whole viewport.
+func (p *effectProgram) draw() {
+	drawQuad(p.quad, p.pos)
+}
@@ -6,91 +6,280 @@
 package glsprite
 
 import (
+	"fmt"
 	"image"
+	"image/color"
 	"image/draw"
-	"log"
+	"math"
+	"sort"
 
 	"golang.org/x/mobile/f32"
 	"golang.org/x/mobile/geom"
+	"golang.org/x/mobile/gl"
 	"golang.org/x/mobile/gl/glutil"
 
 	"github.com/crawshaw/sprite"
 	"github.com/crawshaw/sprite/clock"
+	"github.com/crawshaw/sprite/etc"
 	"github.com/crawshaw/sprite/raster"
 )
 
 type texture struct {
-	glImage *glutil.Image
+	glImage *glutil.Image // nil once unloaded
 	b       image.Rectangle
+
+	// stale bounds the part of glImage.RGBA that RenderTexture has
+	// drawn over in the GL texture, which is read back by Download.
+	// The GL texture is always up to date.
+	stale image.Rectangle
+
+	e  *engine // that loaded it, for its inventory
+	id int     // the order it was loaded in
 }
 
-func (t *texture) Bounds() (w, h int) { return t.b.Dx(), t.b.Dy() }
+func (t *texture) Bounds() (w, h int) {
+	t.loaded()
+	return t.b.Dx(), t.b.Dy()
+}
+
+// Format is always RGBA, the format of glutil.Image.
+//
+// TODO: keep ETC textures compressed where the GL has
+// CompressedTexImage2D for them.
+func (t *texture) Format() sprite.Format {
+	t.loaded()
+	return sprite.FormatRGBA
+}
 
 func (t *texture) Download(r image.Rectangle, dst draw.Image) {
-	panic("TODO")
+	t.loaded()
+	if r.Overlaps(t.stale) {
+		t.readBack()
+	}
+	draw.Draw(dst, r.Sub(r.Min).Add(dst.Bounds().Min), t.glImage.RGBA, r.Min, draw.Src)
 }
 
 func (t *texture) Upload(r image.Rectangle, src image.Image) {
+	t.loaded()
 	draw.Draw(t.glImage.RGBA, r, src, src.Bounds().Min, draw.Src)
-	t.glImage.Upload()
+	uploadRect(t.glImage, r)
 }
 
 func (t *texture) Unload() {
-	panic("TODO")
+	t.loaded()
+	t.glImage.Delete()
+	t.glImage = nil
+	delete(t.e.textures, t)
 }
 
-func Engine() sprite.Engine {
-	return &engine{
-		curves:    make(map[sprite.Curve]raster.Path),
-		nextCurve: 1,
+// loaded returns t, and panics if it has been unloaded.
+func (t *texture) loaded() *texture {
+	if t.glImage == nil {
+		panic(sprite.ErrUnloaded)
+	}
+	return t
+}
+
+// bindFramebuffer binds fb, and returns a func that binds the
+// framebuffer and restores the viewport that were current before, as
+// the caller may itself be drawing into a texture.
+func bindFramebuffer(fb gl.Framebuffer) (restore func()) {
+	prev := gl.Framebuffer{Value: uint32(gl.GetInteger(gl.FRAMEBUFFER_BINDING))}
+	var vp [4]int32
+	gl.GetIntegerv(gl.VIEWPORT, vp[:])
+	gl.BindFramebuffer(gl.FRAMEBUFFER, fb)
+	return func() {
+		gl.BindFramebuffer(gl.FRAMEBUFFER, prev)
+		gl.Viewport(int(vp[0]), int(vp[1]), int(vp[2]), int(vp[3]))
+	}
+}
+
+// readBack copies the stale part of the GL texture to glImage.RGBA.
+func (t *texture) readBack() {
+	r := t.stale
+	if r.Empty() {
+		return
+	}
+	t.stale = image.Rectangle{}
+	fb := gl.CreateFramebuffer()
+	defer gl.DeleteFramebuffer(fb)
+	defer bindFramebuffer(fb)()
+	gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, t.glImage.Texture, 0)
+
+	// Rows of a texture are in the order of glImage.RGBA, from y = 0.
+	pix := make([]byte, r.Dx()*r.Dy()*4)
+	gl.ReadPixels(pix, r.Min.X, r.Min.Y, r.Dx(), r.Dy(), gl.RGBA, gl.UNSIGNED_BYTE)
+	m := t.glImage.RGBA
+	for y := 0; y < r.Dy(); y++ {
+		i := m.PixOffset(r.Min.X, r.Min.Y+y)
+		copy(m.Pix[i:i+r.Dx()*4], pix[y*r.Dx()*4:])
+	}
+}
+
+// uploadRect copies the region r of m to its texture.
+func uploadRect(m *glutil.Image, r image.Rectangle) {
+	r = r.Intersect(m.Bounds())
+	if r.Empty() {
+		return
+	}
+	sub := m.SubImage(r).(*image.RGBA)
+	pix := make([]byte, 0, r.Dx()*r.Dy()*4)
+	for y := 0; y < r.Dy(); y++ {
+		pix = append(pix, sub.Pix[y*sub.Stride:y*sub.Stride+r.Dx()*4]...)
 	}
+	gl.BindTexture(gl.TEXTURE_2D, m.Texture)
+	gl.TexSubImage2D(gl.TEXTURE_2D, 0, r.Min.X, r.Min.Y, r.Dx(), r.Dy(), gl.RGBA, gl.UNSIGNED_BYTE, pix)
+}
+
+func Engine() sprite.Engine {
+	return &engine{}
 }
 
 type engine struct {
-	raster        *glutil.Image
+	raster        []*glutil.Image // pages of rasterCache
 	rasterCache   *raster.Cache
 	absTransforms []f32.Affine
+	blend         sprite.BlendMode  // the mode set in GL
+	scissors      []image.Rectangle // clips of the nodes being rendered
+	stencils      []bool            // whether each clip is also in the stencil buffer
+	depth         int               // of the clips in the stencil buffer
+	hasStencil    bool              // whether the framebuffer has a stencil buffer
+	origin        image.Point       // of the viewport, in the framebuffer
 
-	curves    map[sprite.Curve]raster.Path
-	nextCurve int32
+	curves   raster.Registry
+	prog     *program // built when first used
+	fx       *effectProgram
+	free     []*target  // offscreen framebuffers for effects, not in use
+	backdrop gl.Texture // a copy of the framebuffer, for blend modes
+
+	textures    map[*texture]bool // loaded and not unloaded
+	lastTexture int               // id of the last texture loaded
 }
 
 func (e *engine) LoadTexture(src image.Image) (sprite.Texture, error) {
+	if m, ok := src.(*etc.Image); ok {
+		d, err := m.Decode()
+		if err != nil {
+			return nil, err
+		}
+		src = d
+	}
 	b := src.Bounds()
-	t := &texture{glutil.NewImage(b.Dx(), b.Dy()), b}
-	t.Upload(b, src)
-	// TODO: set "glImage.Pix = nil"?? We don't need the CPU-side image any more.
+	m := glutil.NewImage(b.Dx(), b.Dy())
+	draw.Draw(m.RGBA, m.RGBA.Bounds(), src, b.Min, draw.Src)
+	m.Upload()
+	if e.textures == nil {
+		e.textures = make(map[*texture]bool)
+	}
+	e.lastTexture++
+	t := &texture{glImage: m, b: m.RGBA.Bounds(), e: e, id: e.lastTexture}
+	e.textures[t] = true
+	// The CPU copy in glImage is kept for Download, and to upload
+	// parts of the texture.
 	return t, nil
 }
 
-func (e *engine) LoadCurve(path []geom.Pt) (sprite.Curve, error) {
-	id := sprite.Curve(e.nextCurve)
-	e.nextCurve++
-	e.curves[id] = raster.Path(path)
+func (e *engine) Inventory() sprite.Inventory {
+	ts := make([]*texture, 0, len(e.textures))
+	for t := range e.textures {
+		ts = append(ts, t)
+	}
+	sort.Sort(byID(ts))
+	var inv sprite.Inventory
+	for _, t := range ts {
+		// glutil allocates the image and its texture with sides
+		// rounded up to powers of two, of which the texture's
+		// bounds are only a part.
+		w, h := texSize(t.glImage)
+		st := sprite.TextureStats{
+			T:        t,
+			Width:    t.b.Dx(),
+			Height:   t.b.Dy(),
+			CPUBytes: w * h * 4,
+			GPUBytes: w * h * 4,
+		}
+		inv.Textures = append(inv.Textures, st)
+		inv.CPUBytes += st.CPUBytes
+		inv.GPUBytes += st.GPUBytes
+	}
+	return inv
+}
+
+type byID []*texture
+
+func (ts byID) Len() int           { return len(ts) }
+func (ts byID) Less(i, j int) bool { return ts[i].id < ts[j].id }
+func (ts byID) Swap(i, j int)      { ts[i], ts[j] = ts[j], ts[i] }
 
-	if e.raster == nil {
+func (e *engine) LoadCurve(path []geom.Pt) (sprite.Curve, error) {
+	id, err := e.curves.Load(raster.Path(path))
+	if err != nil {
+		return 0, err
+	}
+	if e.rasterCache == nil {
 		// TODO: round up to power of two.
 		// TODO: screen size is a proxy for sensible amount of memory
 		// to spend. determine a better bound.
-		w := int(geom.Width.Px()+0.5) * 2
-		h := int(geom.Height.Px()+0.5) * 2
-		e.raster = glutil.NewImage(w, h)
-		e.rasterCache = &raster.Cache{M: e.raster.RGBA}
-	}
-	// TODO there is no need to render curves now, it can be done lazily
-	// so we can have far more loaded than we have seaparate texture space
-	// for. But this gives us a nice way to propagate errors until the
-	// cache is properly built.
-	log.Printf("LoadCurve: path=%v", path)
-	_, err := e.rasterCache.Get(id, path, 0)
-	if err != nil {
-		return 0, err
+		w := int(geom.Width.Px() + 0.5)
+		h := int(geom.Height.Px() + 0.5)
+		e.rasterCache = &raster.Cache{
+			NewPage: func() draw.Image {
+				m := glutil.NewImage(w, h)
+				m.Upload()
+				e.raster = append(e.raster, m)
+				return m.RGBA
+			},
+			MaxPages: 4,
+		}
 	}
+	// Curves are rasterized as they are drawn, so far more can be
+	// loaded than fit in the cache at once.
 	return id, nil
 }
 
 func (e *engine) UnloadCurve(c sprite.Curve) {
-	delete(e.curves, c)
+	if e.curves.Unload(c) && e.rasterCache != nil {
+		e.rasterCache.Remove(c)
+	}
+}
+
+func (e *engine) Release() error {
+	for _, m := range e.raster {
+		m.Delete()
+	}
+	e.raster = nil
+	e.rasterCache = nil
+	if e.prog != nil {
+		e.prog.delete()
+		e.prog = nil
+	}
+	if e.fx != nil {
+		e.fx.delete()
+		e.fx = nil
+	}
+	for _, t := range e.free {
+		t.delete()
+	}
+	e.free = nil
+	if e.backdrop.Value != 0 {
+		gl.DeleteTexture(e.backdrop)
+		e.backdrop = gl.Texture{}
+	}
+	err := e.curves.Close()
+	if inv := e.Inventory(); len(inv.Textures) > 0 {
+		leaked := make([]string, len(inv.Textures))
+		for i, st := range inv.Textures {
+			leaked[i] = fmt.Sprintf("%dx%d", st.Width, st.Height)
+			st.T.Unload()
+		}
+		terr := fmt.Errorf("glsprite: %d textures not unloaded: %v", len(leaked), leaked)
+		if err == nil {
+			err = terr
+		} else {
+			err = fmt.Errorf("%v; %v", err, terr)
+		}
+	}
+	return err
 }
 
 func (e *engine) Render(scene *sprite.Node, t clock.Time) {
@@ -98,7 +287,155 @@ func (e *engine) Render(scene *sprite.Node, t clock.Time) {
 		{1, 0, 0},
 		{0, 1, 0},
 	})
+	gl.Enable(gl.BLEND)
+	e.blend = sprite.BlendNormal
+	setBlend(e.blend)
+	e.scissors = e.scissors[:0]
+	e.setScissor()
+	e.stencils, e.depth = e.stencils[:0], 0
+	e.hasStencil = gl.GetInteger(gl.STENCIL_BITS) > 0
+	if e.hasStencil {
+		gl.ClearStencil(0)
+		gl.Clear(gl.STENCIL_BUFFER_BIT)
+	}
+	e.setStencil()
+	e.render(scene, t)
+}
+
+func (e *engine) RenderTexture(dst sprite.Texture, r image.Rectangle, scene *sprite.Node, m *f32.Affine, t clock.Time) (_ sprite.SubTex, err error) {
+	if r.Empty() {
+		return sprite.SubTex{}, fmt.Errorf("glsprite: cannot render into empty rectangle %v", r)
+	}
+	if dst == nil {
+		b := image.Rect(0, 0, r.Max.X, r.Max.Y)
+		if !r.In(b) {
+			return sprite.SubTex{}, fmt.Errorf("glsprite: rectangle %v is outside texture %v", r, b)
+		}
+		dst, err = e.LoadTexture(image.NewRGBA(b))
+		if err != nil {
+			return sprite.SubTex{}, err
+		}
+		// The texture is the caller's only if it is returned.
+		defer func() {
+			if err != nil {
+				dst.Unload()
+			}
+		}()
+	}
+	tex, ok := dst.(*texture)
+	if !ok {
+		return sprite.SubTex{}, fmt.Errorf("glsprite: cannot render into %T, a texture of another engine", dst)
+	}
+	if tex.glImage == nil {
+		return sprite.SubTex{}, sprite.ErrUnloaded
+	}
+	if !r.In(tex.b) {
+		return sprite.SubTex{}, fmt.Errorf("glsprite: rectangle %v is outside texture %v", r, tex.b)
+	}
+	if m == nil {
+		m = &f32.Affine{
+			{geom.PixelsPerPt, 0, 0},
+			{0, geom.PixelsPerPt, 0},
+		}
+	}
+
+	// Clear r. What is drawn is only in the GL texture, and is read
+	// back into glImage if the texture is downloaded.
+	draw.Draw(tex.glImage.RGBA, r, image.Transparent, image.Point{}, draw.Src)
+	uploadRect(tex.glImage, r)
+	tex.stale = tex.stale.Union(r)
+
+	fb := gl.CreateFramebuffer()
+	defer gl.DeleteFramebuffer(fb)
+	defer bindFramebuffer(fb)()
+	gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, tex.glImage.Texture, 0)
+	// Clips that are not upright rectangles are drawn in a stencil
+	// buffer, which must be the size of the texture.
+	rb := gl.CreateRenderbuffer()
+	defer gl.DeleteRenderbuffer(rb)
+	gl.BindRenderbuffer(gl.RENDERBUFFER, rb)
+	tw, th := texSize(tex.glImage)
+	gl.RenderbufferStorage(gl.RENDERBUFFER, gl.STENCIL_INDEX8, tw, th)
+	gl.FramebufferRenderbuffer(gl.FRAMEBUFFER, gl.STENCIL_ATTACHMENT, gl.RENDERBUFFER, rb)
+	if status := gl.CheckFramebufferStatus(gl.FRAMEBUFFER); status != gl.FRAMEBUFFER_COMPLETE {
+		return sprite.SubTex{}, fmt.Errorf("glsprite: incomplete framebuffer, status %#x", status)
+	}
+
+	// glutil.Image.Draw maps geom.Width and geom.Height onto the
+	// viewport, so they are set to the size of r while drawing. Rows
+	// of a texture go up in the framebuffer, where rows of the screen
+	// go down, so the scene is also flipped.
+	width, height := geom.Width, geom.Height
+	geom.Width = geom.Pt(float32(r.Dx()) / geom.PixelsPerPt)
+	geom.Height = geom.Pt(float32(r.Dy()) / geom.PixelsPerPt)
+	gl.Viewport(r.Min.X, r.Min.Y, r.Dx(), r.Dy())
+	defer func() {
+		geom.Width, geom.Height = width, height
+	}()
+
+	// An Arranger may call RenderTexture while Render is drawing, so
+	// the frame's state is put aside.
+	frameTransforms, frameBlend, frameScissors, frameOrigin := e.absTransforms, e.blend, e.scissors, e.origin
+	frameStencils, frameDepth, frameHasStencil := e.stencils, e.depth, e.hasStencil
+	flip := f32.Affine{
+		{1 / geom.PixelsPerPt, 0, 0},
+		{0, -1 / geom.PixelsPerPt, float32(geom.Height)},
+	}
+	flip.Mul(&flip, m)
+	e.absTransforms = []f32.Affine{flip}
+	e.blend = sprite.BlendNormal
+	e.scissors, e.origin = nil, r.Min
+	e.stencils, e.depth, e.hasStencil = nil, 0, true
+	setBlend(e.blend)
+	e.setScissor()
+	gl.ClearStencil(0)
+	gl.Clear(gl.STENCIL_BUFFER_BIT)
+	e.setStencil()
 	e.render(scene, t)
+	e.absTransforms, e.blend = frameTransforms, frameBlend
+	e.scissors, e.origin = frameScissors, frameOrigin
+	e.stencils, e.depth, e.hasStencil = frameStencils, frameDepth, frameHasStencil
+	setBlend(e.blend)
+	e.setScissor()
+	e.setStencil()
+
+	return sprite.SubTex{T: tex, R: r}, nil
+}
+
+// blendFuncs are the GL source and destination factors of each
+// sprite.BlendMode, for premultiplied textures.
+//
+// Multiply leaves out the source where the destination is transparent,
+// which is only exact over an opaque destination. Overlay, Darken and
+// Lighten cannot be done by blend factors alone, and are composited by
+// renderBlend instead. Their factors are those it draws offscreen with.
+var blendFuncs = [...][2]gl.Enum{
+	sprite.BlendNormal:   {gl.ONE, gl.ONE_MINUS_SRC_ALPHA},
+	sprite.BlendAdd:      {gl.ONE, gl.ONE},
+	sprite.BlendMultiply: {gl.DST_COLOR, gl.ONE_MINUS_SRC_ALPHA},
+	sprite.BlendScreen:   {gl.ONE, gl.ONE_MINUS_SRC_COLOR},
+	sprite.BlendOverlay:  {gl.ONE, gl.ONE_MINUS_SRC_ALPHA},
+	sprite.BlendDarken:   {gl.ONE, gl.ONE_MINUS_SRC_ALPHA},
+	sprite.BlendLighten:  {gl.ONE, gl.ONE_MINUS_SRC_ALPHA},
+	sprite.BlendClear:    {gl.ZERO, gl.ZERO},
+	sprite.BlendSrc:      {gl.ONE, gl.ZERO},
+	sprite.BlendDst:      {gl.ZERO, gl.ONE},
+	sprite.BlendDstOver:  {gl.ONE_MINUS_DST_ALPHA, gl.ONE},
+	sprite.BlendSrcIn:    {gl.DST_ALPHA, gl.ZERO},
+	sprite.BlendDstIn:    {gl.ZERO, gl.SRC_ALPHA},
+	sprite.BlendSrcOut:   {gl.ONE_MINUS_DST_ALPHA, gl.ZERO},
+	sprite.BlendDstOut:   {gl.ZERO, gl.ONE_MINUS_SRC_ALPHA},
+	sprite.BlendSrcAtop:  {gl.DST_ALPHA, gl.ONE_MINUS_SRC_ALPHA},
+	sprite.BlendDstAtop:  {gl.ONE_MINUS_DST_ALPHA, gl.SRC_ALPHA},
+	sprite.BlendXor:      {gl.ONE_MINUS_DST_ALPHA, gl.ONE_MINUS_SRC_ALPHA},
+}
+
+func setBlend(mode sprite.BlendMode) {
+	if int(mode) >= len(blendFuncs) {
+		mode = sprite.BlendNormal
+	}
+	f := blendFuncs[mode]
+	gl.BlendFunc(f[0], f[1])
 }
 
 func (e *engine) render(n *sprite.Node, t clock.Time) {
@@ -113,8 +450,50 @@ func (e *engine) render(n *sprite.Node, t clock.Time) {
 		e.absTransforms = append(e.absTransforms, m)
 	}
 
-	if x := n.SubTex; x.T != nil {
-		x.T.(*texture).glImage.Draw(
+	if n.Clip != nil {
+		e.pushClip(n.Clip, &m, t)
+	}
+
+	if len(n.Effects) > 0 {
+		e.renderEffects(n, &m, t)
+	} else {
+		e.renderContent(n, &m, t)
+	}
+
+	if n.Clip != nil {
+		e.popClip()
+	}
+	if n.Transform != nil {
+		e.absTransforms = e.absTransforms[:len(e.absTransforms)-1]
+	}
+}
+
+// renderContent draws n, whose transform is m, and its children.
+func (e *engine) renderContent(n *sprite.Node, m *f32.Affine, t clock.Time) {
+	if n.SubTex.T != nil || n.Curve != 0 {
+		if blendEffects[n.Blend] != 0 {
+			e.renderBlend(n, m, t)
+		} else {
+			if n.Blend != e.blend {
+				e.blend = n.Blend
+				setBlend(e.blend)
+			}
+			e.draw(n, m, t)
+		}
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		e.render(c, t)
+	}
+}
+
+// draw draws the SubTex and Curve of n, whose transform is m.
+func (e *engine) draw(n *sprite.Node, m *f32.Affine, t clock.Time) {
+	if x := n.SubTex; x.T != nil && n.DistanceField != nil {
+		f := n.DistanceField
+		e.distanceField(m, x.T.(*texture).loaded().glImage, x.R, f, f.Spread, f.Multi)
+	} else if x.T != nil {
+		x.T.(*texture).loaded().glImage.Draw(
 			geom.Point{
 				geom.Pt(m[0][2]),
 				geom.Pt(m[1][2]),
@@ -131,43 +510,175 @@ func (e *engine) render(n *sprite.Node, t clock.Time) {
 		)
 	}
 
-	if n.Curve != 0 {
-		b, err := e.rasterCache.Get(n.Curve, e.curves[n.Curve], 0)
-		if err != nil {
-			panic(err)
+	if n.Curve != 0 && n.DistanceField != nil {
+		// The distance field has a margin around the curve, so that
+		// outlines and glows can be drawn outside it. As with
+		// coverage, a curve the cache cannot hold is left out.
+		page, b, err := e.rasterCache.GetSDF(n.Curve, e.curves.Path(n.Curve), t)
+		pad := e.rasterCache.Spread
+		dx, dy := b.Dx()-2*pad, b.Dy()-2*pad
+		if err == nil && dx > 0 && dy > 0 {
+			e.uploadDirty()
+			fm := *m
+			fm.Mul(&fm, &f32.Affine{
+				{float32(b.Dx()) / float32(dx), 0, -float32(pad) / float32(dx)},
+				{0, float32(b.Dy()) / float32(dy), -float32(pad) / float32(dy)},
+			})
+			e.distanceField(&fm, e.raster[page], b, n.DistanceField, float32(pad), true)
 		}
-		if e.rasterCache.Dirty {
-			// given the current cache design this should never happen
-			// TODO: when it does happen deliberately, delay e.raster.Draw
-			// calls so they are executed in batches with a single Upload.
-			log.Println("upload raster on draw")
-			e.raster.Upload()
-			e.rasterCache.Dirty = false
+	} else if n.Curve != 0 {
+		// m is in points, so scale it to pixels.
+		path := e.curves.Path(n.Curve)
+		page, b, err := e.rasterCache.Get(n.Curve, path, raster.UnitScale(path, m)*geom.PixelsPerPt, t)
+		// A curve the cache cannot hold, as when it is full of curves
+		// drawn at time t, is left out of the frame.
+		if err == nil {
+			e.uploadDirty()
+			// The pages hold coverage in black, which is the alpha
+			// that the program fills with the node's pattern or color.
+			if p := n.Pattern; p != nil && p.SubTex.T != nil {
+				e.fillPattern(m, e.raster[page], b, p)
+			} else {
+				fill := n.Color
+				if fill == nil {
+					fill = color.Black
+				}
+				e.fill(m, e.raster[page], b, fill)
+			}
 		}
+	}
+}
 
-		e.raster.Draw(
-			geom.Point{
-				geom.Pt(m[0][2]),
-				geom.Pt(m[1][2]),
-			},
-			geom.Point{
-				geom.Pt(m[0][2] + m[0][0]),
-				geom.Pt(m[1][2] + m[1][0]),
-			},
-			geom.Point{
-				geom.Pt(m[0][2] + m[0][1]),
-				geom.Pt(m[1][2] + m[1][1]),
-			},
-			b,
-		)
+// uploadDirty copies the parts of the cache pages drawn since it was
+// last called to their textures.
+//
+// TODO: delay e.raster Draw calls so they are executed in batches after
+// a single round of uploads.
+func (e *engine) uploadDirty() {
+	for i, rs := range e.rasterCache.TakeDirty() {
+		for _, r := range rs {
+			uploadRect(e.raster[i], r)
+		}
 	}
+}
 
-	for c := n.FirstChild; c != nil; c = c.NextSibling {
-		e.render(c, t)
+// pushClip clips drawing to c, of a node with the transform m, and the
+// clips of its ancestors.
+//
+// Each clip is bounded by the scissor test. An upright rectangle needs
+// nothing more. Other clips are also drawn in the stencil buffer, where
+// the value of a pixel is the number of nested clips it is inside, so
+// drawing is limited to the pixels at the depth of the innermost clip.
+// Without a stencil buffer, nothing is drawn within those clips.
+func (e *engine) pushClip(c *sprite.Clip, m *f32.Affine, t clock.Time) {
+	var r image.Rectangle
+	if len(e.scissors) > 0 {
+		r = e.scissors[len(e.scissors)-1]
+	} else {
+		r = image.Rect(-1<<30, -1<<30, 1<<30, 1<<30)
 	}
+	unit := geom.Rectangle{Max: geom.Point{1, 1}}
+	var stencil func() // draws the area of the clip
+	switch {
+	case c.Rect.Min.X < c.Rect.Max.X && c.Rect.Min.Y < c.Rect.Max.Y:
+		r = r.Intersect(e.bounds(c.Rect, m))
+		if upright := m[0][1] == 0 && m[1][0] == 0 || m[0][0] == 0 && m[1][1] == 0; !upright {
+			rm := *m
+			rm.Mul(&rm, &f32.Affine{
+				{float32(c.Rect.Max.X - c.Rect.Min.X), 0, float32(c.Rect.Min.X)},
+				{0, float32(c.Rect.Max.Y - c.Rect.Min.Y), float32(c.Rect.Min.Y)},
+			})
+			stencil = func() { e.solid(&rm, color.Black) }
+		}
+	case c.Curve != 0:
+		r = r.Intersect(e.bounds(unit, m))
+		path := e.curves.Path(c.Curve)
+		page, b, err := e.rasterCache.Get(c.Curve, path, raster.UnitScale(path, m)*geom.PixelsPerPt, t)
+		if err != nil {
+			// Nothing is drawn, rather than drawing unclipped.
+			r = image.Rectangle{}
+			break
+		}
+		e.uploadDirty()
+		m, img := *m, e.raster[page]
+		stencil = func() { e.cover(&m, img, b) }
+	case c.Mask.T != nil:
+		r = r.Intersect(e.bounds(unit, m))
+		m, img, b := *m, c.Mask.T.(*texture).loaded().glImage, c.Mask.R
+		stencil = func() { e.cover(&m, img, b) }
+	}
+	if stencil != nil && !e.hasStencil {
+		r, stencil = image.Rectangle{}, nil
+	}
+	e.scissors = append(e.scissors, r)
+	e.stencils = append(e.stencils, stencil != nil)
+	e.setScissor()
+	if stencil != nil {
+		// The pixels of the clip at the depth of its ancestors go
+		// one deeper.
+		gl.ColorMask(false, false, false, false)
+		gl.Enable(gl.STENCIL_TEST)
+		gl.StencilFunc(gl.EQUAL, e.depth, 0xff)
+		gl.StencilOp(gl.KEEP, gl.KEEP, gl.INCR)
+		stencil()
+		gl.ColorMask(true, true, true, true)
+		e.depth++
+		e.setStencil()
+	}
+}
 
-	if n.Transform != nil {
-		e.absTransforms = e.absTransforms[:len(e.absTransforms)-1]
+// bounds returns the pixels of the framebuffer covered by r, of a node
+// with the transform m.
+func (e *engine) bounds(r geom.Rectangle, m *f32.Affine) image.Rectangle {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, p := range [4]geom.Point{r.Min, {r.Max.X, r.Min.Y}, r.Max, {r.Min.X, r.Max.Y}} {
+		x := float64(geom.Pt(m[0][0]*float32(p.X) + m[0][1]*float32(p.Y) + m[0][2]).Px())
+		y := float64(geom.Pt(m[1][0]*float32(p.X) + m[1][1]*float32(p.Y) + m[1][2]).Px())
+		minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+		minY, maxY = math.Min(minY, y), math.Max(maxY, y)
 	}
+	// The framebuffer's rows go up from the bottom of the viewport.
+	h := float64(geom.Height.Px())
+	round := func(v float64) int { return int(math.Floor(v + 0.5)) }
+	return image.Rect(round(minX), round(h-maxY), round(maxX), round(h-minY)).Add(e.origin)
+}
+
+func (e *engine) popClip() {
+	if e.stencils[len(e.stencils)-1] {
+		// The pixels deeper than the parent clip, all within the
+		// scissor of this one, go back to its depth.
+		e.depth--
+		gl.ColorMask(false, false, false, false)
+		gl.StencilFunc(gl.LESS, e.depth, 0xff)
+		gl.StencilOp(gl.KEEP, gl.KEEP, gl.REPLACE)
+		e.solid(&f32.Affine{{float32(geom.Width), 0, 0}, {0, float32(geom.Height), 0}}, color.Black)
+		gl.ColorMask(true, true, true, true)
+		e.setStencil()
+	}
+	e.stencils = e.stencils[:len(e.stencils)-1]
+	e.scissors = e.scissors[:len(e.scissors)-1]
+	e.setScissor()
+}
 
+// setStencil limits drawing to the pixels inside all the clips in the
+// stencil buffer.
+func (e *engine) setStencil() {
+	if e.depth == 0 {
+		gl.Disable(gl.STENCIL_TEST)
+		return
+	}
+	gl.Enable(gl.STENCIL_TEST)
+	gl.StencilFunc(gl.EQUAL, e.depth, 0xff)
+	gl.StencilOp(gl.KEEP, gl.KEEP, gl.KEEP)
+}
+
+func (e *engine) setScissor() {
+	if len(e.scissors) == 0 {
+		gl.Disable(gl.SCISSOR_TEST)
+		return
+	}
+	r := e.scissors[len(e.scissors)-1]
+	gl.Enable(gl.SCISSOR_TEST)
+	gl.Scissor(int32(r.Min.X), int32(r.Min.Y), int32(r.Dx()), int32(r.Dy()))
 }
@@ -0,0 +1,402 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package glsprite
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"golang.org/x/mobile/f32"
+	"golang.org/x/mobile/geom"
+	"golang.org/x/mobile/gl"
+	"golang.org/x/mobile/gl/glutil"
+
+	"github.com/crawshaw/sprite"
+)
+
+// A program draws the unit square, transformed by mvp into clip space,
+// reading textures at the coordinates uvp maps it to.
+//
+// glutil.Image.Draw is enough to draw a SubTex. The program draws what
+// it cannot: curves, whose coverage is in the alpha of the cache pages,
+// filled with a color or a pattern, distance fields, and the areas of
+// clips in the stencil buffer.
+type program struct {
+	p    gl.Program
+	quad gl.Buffer // the corners of the unit square
+
+	pos   gl.Attrib
+	mvp   gl.Uniform
+	uvp   gl.Uniform
+	mode  gl.Uniform
+	tex   gl.Uniform
+	color gl.Uniform
+	pvp   gl.Uniform
+	pat   gl.Uniform
+	prect gl.Uniform
+	wrap  gl.Uniform
+
+	field   gl.Uniform
+	bounds  gl.Uniform
+	scale   gl.Uniform
+	outline gl.Uniform
+	glow    gl.Uniform
+}
+
+// Modes of the fragment shader.
+const (
+	modeFill    = iota // the coverage of tex, in color
+	modePattern        // the coverage of tex, in the pattern pat
+	modeSolid          // color, ignoring tex
+	modeClip           // where tex is at least half covered
+	modeField          // the distance field in tex
+)
+
+const vertexShader = `
+uniform mat3 mvp;
+uniform mat3 uvp;
+uniform mat3 pvp; // the unit square to tiles of a pattern
+attribute vec2 pos;
+varying vec2 uv;
+varying vec2 puv;
+
+void main() {
+	vec3 p = vec3(pos, 1);
+	gl_Position = vec4((mvp * p).xy, 0, 1);
+	uv = (uvp * p).xy;
+	puv = (pvp * p).xy;
+}`
+
+const fragmentShader = `
+precision mediump float;
+
+uniform int mode;
+uniform sampler2D tex;
+uniform vec4 color; // premultiplied
+uniform sampler2D pat;
+uniform vec4 prect; // the tile in pat, as its corner and size
+uniform vec2 wrap;  // the sprite.Wrap of x and y
+uniform vec4 field; // the spread, multi, outline and glow of a field
+uniform vec4 bounds; // the centers of the texels at the field's edges
+uniform float scale; // texels of the field per pixel
+uniform vec4 outline; // premultiplied
+uniform vec4 glow;    // premultiplied
+varying vec2 uv;
+varying vec2 puv;
+
+// tile maps x into the tile [0, 1] as the sprite.Wrap w does, or
+// returns -1 if nothing is drawn at x.
+float tile(float x, float w) {
+	if (w == 1.0) {
+		return fract(x);
+	}
+	if (w == 2.0) {
+		float f = mod(x, 2.0);
+		return f > 1.0 ? 2.0 - f : f;
+	}
+	if (w == 3.0 && (x < 0.0 || x >= 1.0)) {
+		return -1.0;
+	}
+	return clamp(x, 0.0, 1.0);
+}
+
+float median(float a, float b, float c) {
+	return max(min(a, b), min(max(a, b), c));
+}
+
+// coverage returns the fraction of a pixel inside an edge d texels
+// of the field away.
+float coverage(float d) {
+	return clamp(0.5 + d/scale, 0.0, 1.0);
+}
+
+vec4 over(vec4 src, vec4 dst) {
+	return src + dst*(1.0 - src.a);
+}
+
+// distanceField draws the field as the portable engine does: a glow,
+// under an outline, under the inside of the edge.
+vec4 distanceField() {
+	vec4 s = texture2D(tex, clamp(uv, bounds.xy, bounds.zw));
+	float v = field.y > 0.5 ? median(s.r, s.g, s.b) : s.a;
+	float d = (v - 0.5) * 2.0 * field.x; // texels, positive inside
+	vec4 c = vec4(0);
+	if (field.w > 0.0) {
+		float g = clamp(1.0 + (d + field.z)/field.w, 0.0, 1.0);
+		c = glow * g * g;
+	}
+	if (field.z > 0.0) {
+		c = over(outline * coverage(d + field.z), c);
+	}
+	return over(color * coverage(d), c);
+}
+
+void main() {
+	if (mode == 4) {
+		gl_FragColor = distanceField();
+		return;
+	}
+	float a = texture2D(tex, uv).a;
+	if (mode == 0) {
+		gl_FragColor = color * a;
+		return;
+	}
+	if (mode == 2) {
+		gl_FragColor = color;
+		return;
+	}
+	if (mode == 3) {
+		if (a < 0.5) {
+			discard;
+		}
+		gl_FragColor = vec4(0);
+		return;
+	}
+	vec2 t = vec2(tile(puv.x, wrap.x), tile(puv.y, wrap.y));
+	if (t.x < 0.0 || t.y < 0.0) {
+		discard;
+	}
+	gl_FragColor = texture2D(pat, prect.xy + t*prect.zw) * a;
+}`
+
+var quadCoords = f32.Bytes(binary.LittleEndian,
+	0, 0,
+	1, 0,
+	0, 1,
+	1, 1,
+)
+
+// program returns the engine's program, building it when first used.
+func (e *engine) program() *program {
+	if e.prog != nil {
+		return e.prog
+	}
+	p, err := glutil.CreateProgram(vertexShader, fragmentShader)
+	if err != nil {
+		panic(fmt.Sprintf("glsprite: %v", err))
+	}
+	e.prog = &program{
+		p:     p,
+		quad:  gl.CreateBuffer(),
+		pos:   gl.GetAttribLocation(p, "pos"),
+		mvp:   gl.GetUniformLocation(p, "mvp"),
+		uvp:   gl.GetUniformLocation(p, "uvp"),
+		mode:  gl.GetUniformLocation(p, "mode"),
+		tex:   gl.GetUniformLocation(p, "tex"),
+		color: gl.GetUniformLocation(p, "color"),
+		pvp:   gl.GetUniformLocation(p, "pvp"),
+		pat:   gl.GetUniformLocation(p, "pat"),
+		prect: gl.GetUniformLocation(p, "prect"),
+		wrap:  gl.GetUniformLocation(p, "wrap"),
+
+		field:   gl.GetUniformLocation(p, "field"),
+		bounds:  gl.GetUniformLocation(p, "bounds"),
+		scale:   gl.GetUniformLocation(p, "scale"),
+		outline: gl.GetUniformLocation(p, "outline"),
+		glow:    gl.GetUniformLocation(p, "glow"),
+	}
+	gl.BindBuffer(gl.ARRAY_BUFFER, e.prog.quad)
+	gl.BufferData(gl.ARRAY_BUFFER, gl.STATIC_DRAW, quadCoords)
+	return e.prog
+}
+
+func (p *program) delete() {
+	gl.DeleteProgram(p.p)
+	gl.DeleteBuffer(p.quad)
+}
+
+// use makes p the current program, drawing over the unit square
+// transformed by m, in points.
+func (p *program) use(m *f32.Affine) {
+	gl.UseProgram(p.p)
+	// Points are mapped onto the viewport as glutil.Image.Draw maps
+	// them, with y going down.
+	mvp := f32.Affine{
+		{2 / float32(geom.Width), 0, -1},
+		{0, -2 / float32(geom.Height), 1},
+	}
+	mvp.Mul(&mvp, m)
+	writeAffine(p.mvp, &mvp)
+}
+
+// draw draws the unit square.
+func (p *program) draw() {
+	drawQuad(p.quad, p.pos)
+}
+
+// drawQuad draws the unit square, whose corners are in quad, as the
+// attribute pos.
+func drawQuad(quad gl.Buffer, pos gl.Attrib) {
+	gl.BindBuffer(gl.ARRAY_BUFFER, quad)
+	gl.EnableVertexAttribArray(pos)
+	gl.VertexAttribPointer(pos, 2, gl.FLOAT, false, 0, 0)
+	gl.DrawArrays(gl.TRIANGLE_STRIP, 0, 4)
+	gl.DisableVertexAttribArray(pos)
+}
+
+// bindTexture binds the texture t to the sampler u, in texture unit i.
+func bindTexture(u gl.Uniform, i int, t gl.Texture) {
+	gl.ActiveTexture(gl.TEXTURE0 + gl.Enum(i))
+	gl.BindTexture(gl.TEXTURE_2D, t)
+	gl.Uniform1i(u, i)
+}
+
+// texRect returns the transform of the unit square onto the texels r
+// of m, in texture coordinates.
+func texRect(m *glutil.Image, r image.Rectangle) f32.Affine {
+	tw, th := texSize(m)
+	return f32.Affine{
+		{float32(r.Dx()) / float32(tw), 0, float32(r.Min.X) / float32(tw)},
+		{0, float32(r.Dy()) / float32(th), float32(r.Min.Y) / float32(th)},
+	}
+}
+
+// fill draws the coverage in the texels r of page, filled with c, over
+// the unit square transformed by m.
+func (e *engine) fill(m *f32.Affine, page *glutil.Image, r image.Rectangle, c color.Color) {
+	p := e.program()
+	p.use(m)
+	gl.Uniform1i(p.mode, modeFill)
+	bindTexture(p.tex, 0, page.Texture)
+	uvp := texRect(page, r)
+	writeAffine(p.uvp, &uvp)
+	writeColor(p.color, c)
+	p.draw()
+}
+
+// fillPattern draws the coverage in the texels r of page, filled with
+// the pattern pt, over the unit square transformed by m.
+//
+// As in the portable engine, the pattern is positioned in the unit
+// square by its Transform.
+func (e *engine) fillPattern(m *f32.Affine, page *glutil.Image, r image.Rectangle, pt *sprite.Pattern) {
+	p := e.program()
+	p.use(m)
+	gl.Uniform1i(p.mode, modePattern)
+	bindTexture(p.tex, 0, page.Texture)
+	uvp := texRect(page, r)
+	writeAffine(p.uvp, &uvp)
+
+	var pvp f32.Affine
+	if pt.Transform != nil {
+		pvp.Inverse(pt.Transform)
+	} else {
+		pvp.Identity()
+	}
+	writeAffine(p.pvp, &pvp)
+	src := pt.SubTex.T.(*texture).loaded().glImage
+	bindTexture(p.pat, 1, src.Texture)
+	tr := texRect(src, pt.SubTex.R)
+	gl.Uniform4f(p.prect, tr[0][2], tr[1][2], tr[0][0], tr[1][1])
+	gl.Uniform2f(p.wrap, float32(pt.SubTex.WrapX), float32(pt.SubTex.WrapY))
+	p.draw()
+}
+
+// solid draws the unit square transformed by m in the color c.
+func (e *engine) solid(m *f32.Affine, c color.Color) {
+	p := e.program()
+	p.use(m)
+	gl.Uniform1i(p.mode, modeSolid)
+	writeColor(p.color, c)
+	p.draw()
+}
+
+// cover draws the unit square transformed by m where the texels r of
+// img are at least half covered, for the stencil buffer, which cannot
+// hold fractions.
+func (e *engine) cover(m *f32.Affine, img *glutil.Image, r image.Rectangle) {
+	p := e.program()
+	p.use(m)
+	gl.Uniform1i(p.mode, modeClip)
+	bindTexture(p.tex, 0, img.Texture)
+	uvp := texRect(img, r)
+	writeAffine(p.uvp, &uvp)
+	p.draw()
+}
+
+// distanceField draws the distance field in the texels r of img, as
+// described by f, over the unit square transformed by m. The field
+// records distances up to spread texels, in red, green and blue if
+// multi is set, otherwise in alpha.
+func (e *engine) distanceField(m *f32.Affine, img *glutil.Image, r image.Rectangle, f *sprite.DistanceField, spread float32, multi bool) {
+	// Edges are antialiased over a pixel, which is scale texels.
+	px := math.Abs(float64(m[0][0]*m[1][1]-m[0][1]*m[1][0])) * float64(geom.PixelsPerPt*geom.PixelsPerPt)
+	if r.Empty() || px == 0 {
+		return
+	}
+	scale := float32(math.Sqrt(float64(r.Dx()*r.Dy()) / px))
+
+	p := e.program()
+	p.use(m)
+	gl.Uniform1i(p.mode, modeField)
+	bindTexture(p.tex, 0, img.Texture)
+	uvp := texRect(img, r)
+	writeAffine(p.uvp, &uvp)
+	// As in the portable engine, samples are clamped to the texels of
+	// the field, so that neighbors in an atlas do not bleed in.
+	tw, th := texSize(img)
+	gl.Uniform4f(p.bounds,
+		(float32(r.Min.X)+0.5)/float32(tw), (float32(r.Min.Y)+0.5)/float32(th),
+		(float32(r.Max.X)-0.5)/float32(tw), (float32(r.Max.Y)-0.5)/float32(th))
+	gl.Uniform1f(p.scale, scale)
+
+	var m1 float32
+	if multi {
+		m1 = 1
+	}
+	glow, outline := f.Glow, f.Outline
+	if f.GlowColor == nil {
+		glow = 0
+	}
+	if f.OutlineColor == nil {
+		outline = 0
+	}
+	gl.Uniform4f(p.field, spread, m1, outline, glow)
+	fill := f.Color
+	if fill == nil {
+		fill = color.Black
+	}
+	writeColor(p.color, fill)
+	if outline > 0 {
+		writeColor(p.outline, f.OutlineColor)
+	}
+	if glow > 0 {
+		writeColor(p.glow, f.GlowColor)
+	}
+	p.draw()
+}
+
+// texSize returns the size of the GL texture of m. glutil rounds the
+// sides of its textures up to powers of two, so the image may only
+// fill part of it.
+func texSize(m *glutil.Image) (w, h int) {
+	return m.Stride / 4, roundToPower2(m.Bounds().Dy())
+}
+
+func roundToPower2(x int) int {
+	x2 := 1
+	for x2 < x {
+		x2 *= 2
+	}
+	return x2
+}
+
+// writeAffine sets the mat3 uniform u to a.
+func writeAffine(u gl.Uniform, a *f32.Affine) {
+	gl.UniformMatrix3fv(u, []float32{
+		a[0][0], a[1][0], 0,
+		a[0][1], a[1][1], 0,
+		a[0][2], a[1][2], 1,
+	})
+}
+
+// writeColor sets the vec4 uniform u to c, premultiplied.
+func writeColor(u gl.Uniform, c color.Color) {
+	r, g, b, a := c.RGBA()
+	gl.Uniform4f(u, float32(r)/0xffff, float32(g)/0xffff, float32(b)/0xffff, float32(a)/0xffff)
+}
@@ -26,6 +26,14 @@ import (
 // will produce a dst that is half the size of src. To perform a
 // traditional affine transform, use the inverse of the affine matrix.
 func affine(dst *image.RGBA, src image.Image, srcb image.Rectangle, mask image.Image, a *f32.Affine, op draw.Op) {
+	if affineAxis(dst, src, srcb, mask, a, op) {
+		return
+	}
+	affineGeneral(dst, src, srcb, mask, a, op)
+}
+
+// affineGeneral is affine for any transform and images.
+func affineGeneral(dst *image.RGBA, src image.Image, srcb image.Rectangle, mask image.Image, a *f32.Affine, op draw.Op) {
 	b := dst.Bounds()
 	var maskb image.Rectangle
 	if mask != nil {
@@ -58,38 +66,63 @@ func affine(dst *image.RGBA, src image.Image, srcb image.Rectangle, mask image.I
 
 			sr, sg, sb, sa := bilinear(src, sx, sy).RGBA()
 			off := (y-dst.Rect.Min.Y)*dst.Stride + (x-dst.Rect.Min.X)*4
+			blend(dst, off, sr, sg, sb, sa, ma, op)
+		}
+	}
+}
 
-			if op == draw.Over {
-				dr := uint32(dst.Pix[off+0])
-				dg := uint32(dst.Pix[off+1])
-				db := uint32(dst.Pix[off+2])
-				da := uint32(dst.Pix[off+3])
-
-				// dr, dg, db, and da are all 8-bit color at the moment, ranging
-				// in [0,255]. We work in 16-bit color, and so would normally do:
-				//	dr |= dr << 8
-				// and similarly for the other values, but instead we multiply by 0x101
-				// to shift these to 16-bit colors, ranging in [0,65535].
-				// This yields the same result, but is fewer arithmetic operations.
-				//
-				// This logic comes from drawCopyOver in the image/draw package.
-				a := m - (sa * ma / m)
-				a *= 0x101
-
-				dst.Pix[off+0] = uint8((dr*a + sr*ma) / m >> 8)
-				dst.Pix[off+1] = uint8((dg*a + sg*ma) / m >> 8)
-				dst.Pix[off+2] = uint8((db*a + sb*ma) / m >> 8)
-				dst.Pix[off+3] = uint8((da*a + sa*ma) / m >> 8)
-			} else {
-				dst.Pix[off+0] = uint8(sr * ma / m >> 8)
-				dst.Pix[off+1] = uint8(sg * ma / m >> 8)
-				dst.Pix[off+2] = uint8(sb * ma / m >> 8)
-				dst.Pix[off+3] = uint8(sa * ma / m >> 8)
+// fillMask composites the color c onto dst through mask with mix, as
+// affine does with a uniform src. The color is as returned by colorOf.
+func fillMask(dst *image.RGBA, c [4]float32, mask *image.Alpha, mix mixer, a *f32.Affine) {
+	b := dst.Bounds()
+	mb := mask.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			ix, iy := pt(a, x-b.Min.X, y-b.Min.Y)
+			mx, my := ix+float32(mb.Min.X), iy+float32(mb.Min.Y)
+			if !inBounds(mb, mx, my) {
+				continue
 			}
+			ma := bilinearAlpha(mask, mx, my).A
+			off := (y-dst.Rect.Min.Y)*dst.Stride + (x-dst.Rect.Min.X)*4
+			mix.draw(dst, off, c, float32(ma)/0xff)
 		}
 	}
 }
 
+// blend composites the 16-bit color (sr, sg, sb, sa), scaled by the
+// mask value ma, onto the dst pixel at offset off.
+func blend(dst *image.RGBA, off int, sr, sg, sb, sa, ma uint32, op draw.Op) {
+	const m = 1<<16 - 1
+	if op == draw.Over {
+		dr := uint32(dst.Pix[off+0])
+		dg := uint32(dst.Pix[off+1])
+		db := uint32(dst.Pix[off+2])
+		da := uint32(dst.Pix[off+3])
+
+		// dr, dg, db, and da are all 8-bit color at the moment, ranging
+		// in [0,255]. We work in 16-bit color, and so would normally do:
+		//	dr |= dr << 8
+		// and similarly for the other values, but instead we multiply by 0x101
+		// to shift these to 16-bit colors, ranging in [0,65535].
+		// This yields the same result, but is fewer arithmetic operations.
+		//
+		// This logic comes from drawCopyOver in the image/draw package.
+		a := m - (sa * ma / m)
+		a *= 0x101
+
+		dst.Pix[off+0] = uint8((dr*a + sr*ma) / m >> 8)
+		dst.Pix[off+1] = uint8((dg*a + sg*ma) / m >> 8)
+		dst.Pix[off+2] = uint8((db*a + sb*ma) / m >> 8)
+		dst.Pix[off+3] = uint8((da*a + sa*ma) / m >> 8)
+	} else {
+		dst.Pix[off+0] = uint8(sr * ma / m >> 8)
+		dst.Pix[off+1] = uint8(sg * ma / m >> 8)
+		dst.Pix[off+2] = uint8(sb * ma / m >> 8)
+		dst.Pix[off+3] = uint8(sa * ma / m >> 8)
+	}
+}
+
 func inBounds(b image.Rectangle, x, y float32) bool {
 	if x < float32(b.Min.X) || x >= float32(b.Max.X) {
 		return false
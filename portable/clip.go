@@ -0,0 +1,169 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package portable
+
+import (
+	"image"
+	"image/draw"
+	"math"
+
+	"golang.org/x/mobile/f32"
+	"golang.org/x/mobile/geom"
+
+	"github.com/crawshaw/sprite"
+	"github.com/crawshaw/sprite/clock"
+	"github.com/crawshaw/sprite/raster"
+)
+
+// A clip is the area of dst that a node and its descendants may draw
+// in: the pixels of r, each covered by the fraction in mask if mask is
+// non-nil. A clip with no mask only shrinks the bounds of the drawing
+// and costs nothing while drawing.
+type clip struct {
+	r    image.Rectangle
+	mask *image.Alpha
+}
+
+// newClip returns the clip c of a node whose transform to dst pixels is
+// m, intersected with the clip of its ancestors.
+func (e *engine) newClip(c *sprite.Clip, m *f32.Affine, t clock.Time) *clip {
+	parent := &clip{r: e.area}
+	if len(e.clips) > 0 {
+		parent = e.clips[len(e.clips)-1]
+	}
+
+	var cl clip
+	switch {
+	case c.Rect.Min.X < c.Rect.Max.X && c.Rect.Min.Y < c.Rect.Max.Y:
+		cl = e.rectClip(c.Rect, m)
+	case c.Curve != 0:
+		path := e.curves.Path(c.Curve)
+		page, b, err := e.rasterCache.Get(c.Curve, path, raster.UnitScale(path, m), t)
+		if err != nil {
+			// Nothing is drawn, rather than drawing unclipped.
+			return &clip{}
+		}
+		dx, dy := b.Dx(), b.Dy()
+		cover := e.rasterCache.Pages[page].(*image.Alpha).SubImage(b)
+		cl = e.maskClip(image.Opaque, image.Rect(0, 0, dx, dy), cover, m)
+	case c.Mask.T != nil:
+		x := c.Mask
+		cl = e.maskClip(x.T.(*texture).loaded().subImage(x.R), x.R, nil, m)
+	default:
+		return parent
+	}
+
+	cl.r = cl.r.Intersect(parent.r)
+	switch {
+	case parent.mask == nil:
+	case cl.mask == nil:
+		cl.mask = image.NewAlpha(cl.r)
+		draw.Draw(cl.mask, cl.r, parent.mask, cl.r.Min, draw.Src)
+	default:
+		for y := cl.r.Min.Y; y < cl.r.Max.Y; y++ {
+			i, j := cl.mask.PixOffset(cl.r.Min.X, y), parent.mask.PixOffset(cl.r.Min.X, y)
+			for x := cl.r.Min.X; x < cl.r.Max.X; x, i, j = x+1, i+1, j+1 {
+				cl.mask.Pix[i] = uint8((uint32(cl.mask.Pix[i])*uint32(parent.mask.Pix[j]) + 127) / 255)
+			}
+		}
+	}
+	if cl.mask != nil {
+		cl.mask = cl.mask.SubImage(cl.r).(*image.Alpha)
+	}
+	return &cl
+}
+
+// rectClip returns the clip of the rectangle r of a node, where m maps
+// the node to dst pixels.
+func (e *engine) rectClip(r geom.Rectangle, m *f32.Affine) clip {
+	origin := e.area.Min
+	var pts [4][2]float32
+	minX, minY := float32(math.Inf(1)), float32(math.Inf(1))
+	maxX, maxY := float32(math.Inf(-1)), float32(math.Inf(-1))
+	for i, p := range [4]geom.Point{r.Min, {r.Max.X, r.Min.Y}, r.Max, {r.Min.X, r.Max.Y}} {
+		x := m[0][0]*float32(p.X) + m[0][1]*float32(p.Y) + m[0][2]
+		y := m[1][0]*float32(p.X) + m[1][1]*float32(p.Y) + m[1][2]
+		pts[i] = [2]float32{x, y}
+		minX, maxX = min32(minX, x), max32(maxX, x)
+		minY, maxY = min32(minY, y), max32(maxY, y)
+	}
+	if m[0][1] == 0 && m[1][0] == 0 {
+		// Not rotated, the clip is a scissor.
+		round := func(v float32) int { return int(math.Floor(float64(v) + 0.5)) }
+		return clip{r: image.Rect(round(minX), round(minY), round(maxX), round(maxY)).Add(origin)}
+	}
+
+	b := image.Rect(
+		int(math.Floor(float64(minX))),
+		int(math.Floor(float64(minY))),
+		int(math.Ceil(float64(maxX))),
+		int(math.Ceil(float64(maxY))),
+	).Add(origin).Intersect(e.area)
+	mask := image.NewAlpha(b)
+	// The path is relative to the mask, in geom.Pt.
+	var path raster.Path
+	var path0 geom.Point
+	for i, p := range pts {
+		pt := geom.Point{
+			X: geom.Pt((p[0] + float32(origin.X-b.Min.X)) / geom.PixelsPerPt),
+			Y: geom.Pt((p[1] + float32(origin.Y-b.Min.Y)) / geom.PixelsPerPt),
+		}
+		if i == 0 {
+			path.AddStart(pt)
+			path0 = pt
+		} else {
+			path.AddLine(pt)
+		}
+	}
+	path.AddLine(path0)
+	raster.DrawAlpha(mask, path)
+	return clip{r: b, mask: mask}
+}
+
+// maskClip returns the clip of the alpha of src, as drawn by affine
+// over the unit square of a node, where m maps the node to dst pixels.
+func (e *engine) maskClip(src image.Image, srcb image.Rectangle, mask image.Image, m *f32.Affine) clip {
+	dx, dy := srcb.Dx(), srcb.Dy()
+	if dx <= 0 || dy <= 0 {
+		return clip{}
+	}
+	var a f32.Affine
+	a.Scale(m, 1/float32(dx), 1/float32(dy))
+	a.Inverse(&a)
+	b := dstBounds(e.area, &a, float32(dx), float32(dy))
+
+	// As in drawTile, a is made relative to the top-left of b.
+	origin := e.area.Min
+	a.Translate(&a, float32(b.Min.X-origin.X), float32(b.Min.Y-origin.Y))
+	cover := image.NewRGBA(b)
+	affine(cover, src, srcb, mask, &a, draw.Src)
+
+	alpha := image.NewAlpha(b)
+	for i := range alpha.Pix {
+		alpha.Pix[i] = cover.Pix[4*i+3]
+	}
+	return clip{r: b, mask: alpha}
+}
+
+// drawClipped does op in the pixels r of dst, through its clip mask.
+// The op draws into a copy of r, which is then mixed back into dst by
+// the mask, so that any blend mode is clipped the same way.
+func drawClipped(dst *image.RGBA, r image.Rectangle, op *drawOp, a *f32.Affine) {
+	tmp := image.NewRGBA(r)
+	draw.Draw(tmp, r, dst, r.Min, draw.Src)
+	op.draw(tmp, a)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		i, j := dst.PixOffset(r.Min.X, y), tmp.PixOffset(r.Min.X, y)
+		k := op.mask.PixOffset(r.Min.X, y)
+		for x := r.Min.X; x < r.Max.X; x++ {
+			ma := uint32(op.mask.Pix[k])
+			for c := 0; c < 4; c++ {
+				d, s := uint32(dst.Pix[i+c]), uint32(tmp.Pix[j+c])
+				dst.Pix[i+c] = uint8((d*(255-ma) + s*ma + 127) / 255)
+			}
+			i, j, k = i+4, j+4, k+1
+		}
+	}
+}
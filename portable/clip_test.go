@@ -0,0 +1,197 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package portable
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"golang.org/x/mobile/f32"
+	"golang.org/x/mobile/geom"
+
+	"github.com/crawshaw/sprite"
+	"github.com/crawshaw/sprite/raster"
+)
+
+// clipScene returns an engine drawing onto a white 16x16 dst, and a
+// node that fills all of it with red, to be clipped.
+func clipScene(t *testing.T) (*image.RGBA, sprite.Engine, *sprite.Node, func()) {
+	geom.PixelsPerPt = 1
+	dst := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	e := Engine(dst)
+	r := raster.Rectangle{Max: geom.Point{1, 1}}
+	c, err := e.LoadCurve(r.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fill := &sprite.Node{
+		Transform: &f32.Affine{{16, 0, 0}, {0, 16, 0}},
+		Curve:     c,
+		Color:     color.RGBA{0xff, 0, 0, 0xff},
+	}
+	return dst, e, fill, func() { e.UnloadCurve(c) }
+}
+
+type pixelTest struct {
+	x, y int
+	want color.RGBA
+}
+
+var (
+	clipRed   = color.RGBA{0xff, 0, 0, 0xff}
+	clipWhite = color.RGBA{0xff, 0xff, 0xff, 0xff}
+)
+
+func checkPixels(t *testing.T, name string, dst *image.RGBA, tests []pixelTest) {
+	for _, tc := range tests {
+		if got := dst.RGBAAt(tc.x, tc.y); !colorEq(got, tc.want) {
+			t.Errorf("%s: (%d, %d) = %v, want %v", name, tc.x, tc.y, got, tc.want)
+		}
+	}
+}
+
+func TestClipRect(t *testing.T) {
+	dst, e, fill, done := clipScene(t)
+	defer done()
+	scene := &sprite.Node{
+		Clip: &sprite.Clip{Rect: geom.Rectangle{Min: geom.Point{4, 4}, Max: geom.Point{12, 8}}},
+	}
+	scene.AppendChild(fill)
+	e.Render(scene, 0)
+	checkPixels(t, "rect", dst, []pixelTest{
+		{4, 4, clipRed},
+		{11, 7, clipRed},
+		{3, 4, clipWhite},
+		{12, 4, clipWhite},
+		{8, 8, clipWhite},
+		{0, 0, clipWhite},
+	})
+
+	// Unrotated, the clip needs no mask.
+	m := f32.Affine{{1, 0, 0}, {0, 1, 0}}
+	if c := e.(*engine).newClip(scene.Clip, &m, 0); c.mask != nil || c.r != image.Rect(4, 4, 12, 8) {
+		t.Errorf("clip = %v, %v, want a scissor of (4,4)-(12,8)", c.r, c.mask != nil)
+	}
+}
+
+func TestClipRotatedRect(t *testing.T) {
+	dst, e, fill, done := clipScene(t)
+	defer done()
+	// A square diamond around the center of dst.
+	var m f32.Affine
+	m.Identity()
+	m.Translate(&m, 8, 8)
+	m.Rotate(&m, 0.785398)
+	scene := &sprite.Node{
+		Transform: &m,
+		Clip:      &sprite.Clip{Rect: geom.Rectangle{Min: geom.Point{-4, -4}, Max: geom.Point{4, 4}}},
+	}
+	child := *fill
+	var inv f32.Affine
+	inv.Inverse(&m)
+	inv.Mul(&inv, fill.Transform)
+	child.Transform = &inv
+	scene.AppendChild(&child)
+	e.Render(scene, 0)
+	checkPixels(t, "rotated", dst, []pixelTest{
+		{8, 8, clipRed},
+		{8, 4, clipRed},
+		{3, 3, clipWhite},
+		{12, 12, clipWhite},
+		{8, 1, clipWhite},
+	})
+	// The diagonal edges are antialiased.
+	if got := dst.RGBAAt(10, 5); got == clipRed || got == clipWhite {
+		t.Errorf("edge (10, 5) = %v, want partly red", got)
+	}
+}
+
+func TestClipCurve(t *testing.T) {
+	dst, e, fill, done := clipScene(t)
+	defer done()
+	circle := raster.Circle{Center: geom.Point{8, 8}, Radius: 6}
+	c, err := e.LoadCurve(circle.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.UnloadCurve(c)
+	scene := &sprite.Node{Clip: &sprite.Clip{Curve: c}}
+	scene.AppendChild(fill)
+	e.Render(scene, 0)
+	checkPixels(t, "curve", dst, []pixelTest{
+		{8, 8, clipRed},
+		{3, 8, clipRed},
+		{1, 1, clipWhite},
+		{14, 14, clipWhite},
+		{8, 15, clipWhite},
+	})
+}
+
+func TestClipMask(t *testing.T) {
+	dst, e, fill, done := clipScene(t)
+	defer done()
+	// The left half of the mask is opaque, the right half half
+	// transparent, with a clip rectangle cutting off the bottom.
+	m := image.NewAlpha(image.Rect(0, 0, 2, 1))
+	m.Pix[0], m.Pix[1] = 0xff, 0x80
+	tex, err := e.LoadTexture(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scene := &sprite.Node{
+		Clip: &sprite.Clip{Rect: geom.Rectangle{Max: geom.Point{16, 8}}},
+	}
+	masked := &sprite.Node{
+		Transform: &f32.Affine{{16, 0, 0}, {0, 16, 0}},
+		Clip:      &sprite.Clip{Mask: sprite.SubTex{T: tex, R: m.Bounds()}},
+	}
+	// The child fills dst again in its own coordinates, those of the
+	// unit square.
+	child := *fill
+	child.Transform = &f32.Affine{{1, 0, 0}, {0, 1, 0}}
+	masked.AppendChild(&child)
+	scene.AppendChild(masked)
+	e.Render(scene, 0)
+
+	pink := color.RGBA{0xff, 0x7f, 0x7f, 0xff}
+	checkPixels(t, "mask", dst, []pixelTest{
+		{1, 1, clipRed},
+		{3, 6, clipRed},
+		{14, 1, pink},
+		{12, 6, pink},
+		{3, 12, clipWhite},
+		{12, 12, clipWhite},
+	})
+}
+
+func TestClipBlend(t *testing.T) {
+	// A mode that replaces dst is still limited to the clip, with the
+	// clip's edges mixed with what was there.
+	dst, e, fill, done := clipScene(t)
+	defer done()
+	src := *fill
+	src.Color = color.RGBA{0, 0, 0x80, 0x80}
+	src.Blend = sprite.BlendSrc
+	m := image.NewAlpha(image.Rect(0, 0, 2, 1))
+	m.Pix[0], m.Pix[1] = 0xff, 0x80
+	tex, err := e.LoadTexture(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scene := &sprite.Node{
+		Transform: &f32.Affine{{16, 0, 0}, {0, 16, 0}},
+		Clip:      &sprite.Clip{Mask: sprite.SubTex{T: tex, R: m.Bounds()}},
+	}
+	src.Transform = &f32.Affine{{1, 0, 0}, {0, 1, 0}}
+	scene.AppendChild(&src)
+	e.Render(scene, 0)
+	checkPixels(t, "src", dst, []pixelTest{
+		{1, 8, color.RGBA{0, 0, 0x80, 0x80}},
+		{14, 8, color.RGBA{0x7f, 0x7f, 0xbf, 0xbf}},
+	})
+}
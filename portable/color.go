@@ -0,0 +1,257 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package portable
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/crawshaw/sprite"
+)
+
+// Colors are premultiplied by alpha everywhere in this package, as they
+// are in image.RGBA: textures are stored premultiplied, filters
+// interpolate premultiplied channels, and drawing composites
+// premultiplied colors with the Porter-Duff Over operator. Mixing
+// premultiplied colors never darkens the edges of a transparent sprite
+// with the color of its invisible texels.
+//
+// Colors are sRGB encoded. By default they are mixed as they are
+// stored. An engine made by LinearEngine instead decodes them to linear
+// light before they are interpolated or blended, and encodes the result
+// again, so that gradients, scaled textures and antialiased edges keep
+// their brightness. Colors stored in linear light are still
+// premultiplied: a channel c of alpha a holds linear(c/a) * a.
+
+// linearOf maps the sRGB encoded values [0, 255] to linear light in
+// [0, 1].
+var linearOf [256]float32
+
+// srgbOf maps linear light, quantized to srgbSteps steps, to sRGB
+// encoded values in [0, 255].
+var srgbOf [srgbSteps + 1]float32
+
+const srgbSteps = 4096
+
+func init() {
+	for i := range linearOf {
+		v := float64(i) / 255
+		if v <= 0.04045 {
+			v /= 12.92
+		} else {
+			v = math.Pow((v+0.055)/1.055, 2.4)
+		}
+		linearOf[i] = float32(v)
+	}
+	for i := range srgbOf {
+		v := float64(i) / srgbSteps
+		if v <= 0.0031308 {
+			v *= 12.92
+		} else {
+			v = 1.055*math.Pow(v, 1/2.4) - 0.055
+		}
+		srgbOf[i] = float32(v * 255)
+	}
+}
+
+// decode converts the premultiplied sRGB color c to premultiplied
+// linear light. Channels are in [0, 255].
+func decode(c [4]float32) [4]float32 {
+	a := c[3]
+	if a <= 0 {
+		return [4]float32{}
+	}
+	for k := 0; k < 3; k++ {
+		v := clampf(c[k]*255/a, 0, 255)
+		i := int(v)
+		if i == 255 {
+			c[k] = a
+			continue
+		}
+		f := v - float32(i)
+		c[k] = (linearOf[i] + (linearOf[i+1]-linearOf[i])*f) * a
+	}
+	return c
+}
+
+// encode is the inverse of decode.
+func encode(c [4]float32) [4]float32 {
+	a := c[3]
+	if a <= 0 {
+		return [4]float32{}
+	}
+	for k := 0; k < 3; k++ {
+		v := clampf(c[k]/a, 0, 1) * srgbSteps
+		i := int(v)
+		if i == srgbSteps {
+			c[k] = a
+			continue
+		}
+		f := v - float32(i)
+		c[k] = (srgbOf[i] + (srgbOf[i+1]-srgbOf[i])*f) * a / 255
+	}
+	return c
+}
+
+// colorOf returns c with channels in [0, 255], decoded to linear light
+// if linear is set.
+func colorOf(c color.Color, linear bool) [4]float32 {
+	r, g, b, a := c.RGBA()
+	f := [4]float32{float32(r) / 0x101, float32(g) / 0x101, float32(b) / 0x101, float32(a) / 0x101}
+	if linear {
+		f = decode(f)
+	}
+	return f
+}
+
+// pixel returns the color of the dst pixel at offset off.
+func pixel(dst *image.RGBA, off int) [4]float32 {
+	p := dst.Pix[off : off+4]
+	return [4]float32{float32(p[0]), float32(p[1]), float32(p[2]), float32(p[3])}
+}
+
+// over composites c, scaled by the coverage ma in [0, 1], over the dst
+// pixel at offset off. If linear is set, c is in linear light and is
+// blended with the decoded dst.
+func over(dst *image.RGBA, off int, c [4]float32, ma float32, linear bool) {
+	if ma <= 0 || c[3] <= 0 {
+		return
+	}
+	p := dst.Pix[off : off+4]
+	if c[3]*ma >= 255 {
+		if linear {
+			c = encode(c)
+		}
+		p[0], p[1], p[2], p[3] = round8(c[0]), round8(c[1]), round8(c[2]), round8(c[3])
+		return
+	}
+	d := pixel(dst, off)
+	if linear {
+		d = decode(d)
+	}
+	t := 1 - c[3]*ma/255
+	for k := range d {
+		d[k] = c[k]*ma + d[k]*t
+	}
+	if linear {
+		d = encode(d)
+	}
+	p[0], p[1], p[2], p[3] = round8(d[0]), round8(d[1]), round8(d[2]), round8(d[3])
+}
+
+// A mixer composites colors onto dst with a blend mode, in linear light
+// if linear is set.
+type mixer struct {
+	mode   sprite.BlendMode
+	linear bool
+}
+
+// draw composites c, with coverage ma in [0, 1], onto the dst pixel at
+// offset off. The color is as returned by colorOf. Where coverage is
+// partial, the result is mixed with the dst pixel as it was, so that
+// modes that replace dst still have antialiased edges.
+func (m mixer) draw(dst *image.RGBA, off int, c [4]float32, ma float32) {
+	if m.mode == sprite.BlendNormal {
+		over(dst, off, c, ma, m.linear)
+		return
+	}
+	if ma <= 0 {
+		return
+	}
+	d := pixel(dst, off)
+	if m.linear {
+		d = decode(d)
+	}
+	r := composite(m.mode, c, d)
+	for k := range r {
+		r[k] = d[k] + (r[k]-d[k])*ma
+	}
+	if m.linear {
+		r = encode(r)
+	}
+	p := dst.Pix[off : off+4]
+	p[0], p[1], p[2], p[3] = round8(r[0]), round8(r[1]), round8(r[2]), round8(r[3])
+}
+
+// composite returns the premultiplied src blended with dst by mode.
+// Channels are in [0, 255].
+//
+// The separable modes, from Add to Lighten, are those of the W3C
+// Compositing and Blending specification: where both colors are
+// opaque, the result is the blend of the two, elsewhere it fades to
+// whichever is there.
+func composite(mode sprite.BlendMode, src, dst [4]float32) (r [4]float32) {
+	var s, d [4]float32
+	for k := range s {
+		s[k], d[k] = src[k]/255, dst[k]/255
+	}
+	sa, da := s[3], d[3]
+
+	// Porter-Duff operators are fa*s + fb*d.
+	var fa, fb float32
+	switch mode {
+	case sprite.BlendClear:
+	case sprite.BlendSrc:
+		fa = 1
+	case sprite.BlendDst:
+		fb = 1
+	case sprite.BlendDstOver:
+		fa, fb = 1-da, 1
+	case sprite.BlendSrcIn:
+		fa = da
+	case sprite.BlendDstIn:
+		fb = sa
+	case sprite.BlendSrcOut:
+		fa = 1 - da
+	case sprite.BlendDstOut:
+		fb = 1 - sa
+	case sprite.BlendSrcAtop:
+		fa, fb = da, 1-sa
+	case sprite.BlendDstAtop:
+		fa, fb = 1-da, sa
+	case sprite.BlendXor:
+		fa, fb = 1-da, 1-sa
+	case sprite.BlendAdd:
+		for k := range r {
+			r[k] = min32(s[k]+d[k], 1) * 255
+		}
+		return r
+	case sprite.BlendMultiply, sprite.BlendScreen, sprite.BlendOverlay, sprite.BlendDarken, sprite.BlendLighten:
+		for k := 0; k < 3; k++ {
+			sc, dc := s[k], d[k]
+			var b float32 // the blend, premultiplied by sa*da
+			switch mode {
+			case sprite.BlendMultiply:
+				b = sc * dc
+			case sprite.BlendScreen:
+				b = sc*da + dc*sa - sc*dc
+			case sprite.BlendOverlay:
+				if 2*dc <= da {
+					b = 2 * sc * dc
+				} else {
+					b = sa*da - 2*(da-dc)*(sa-sc)
+				}
+			case sprite.BlendDarken:
+				b = min32(sc*da, dc*sa)
+			case sprite.BlendLighten:
+				b = max32(sc*da, dc*sa)
+			}
+			r[k] = (b + sc*(1-da) + dc*(1-sa)) * 255
+		}
+		r[3] = (sa + da - sa*da) * 255
+		return r
+	default:
+		fa, fb = 1, 1-sa
+	}
+	for k := range r {
+		r[k] = (fa*s[k] + fb*d[k]) * 255
+	}
+	return r
+}
+
+func round8(v float32) uint8 {
+	return uint8(clampf(v+0.5, 0, 255))
+}
@@ -0,0 +1,230 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package portable
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"golang.org/x/mobile/f32"
+	"golang.org/x/mobile/geom"
+
+	"github.com/crawshaw/sprite"
+)
+
+func TestDecodeEncode(t *testing.T) {
+	if got := linearOf[0x80]; got < 0.2158 || got > 0.2159 {
+		t.Errorf("linearOf[0x80] = %v, want 0.2158", got)
+	}
+	for _, a := range []float32{0xff, 0x80, 0x11} {
+		for v := 0; v < 256; v++ {
+			c := [4]float32{float32(v) * a / 0xff, 0, a, a}
+			got := encode(decode(c))
+			for k := range c {
+				if d := got[k] - c[k]; d < -0.01 || d > 0.01 {
+					t.Fatalf("encode(decode(%v)) = %v", c, got)
+				}
+			}
+		}
+	}
+}
+
+// drawRow draws the texture src over a row of n pixels of the color bg,
+// stretched across them.
+func drawRow(t *testing.T, engine func(*image.RGBA) sprite.Engine, src image.Image, bg color.Color, n int) *image.RGBA {
+	geom.PixelsPerPt = 1
+	dst := image.NewRGBA(image.Rect(0, 0, n, 1))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	e := engine(dst)
+	tex, err := e.LoadTexture(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Render(&sprite.Node{
+		Transform: &f32.Affine{
+			{float32(n), 0, 0},
+			{0, 1, 0},
+		},
+		SubTex: sprite.SubTex{T: tex, R: src.Bounds()},
+	}, 0)
+	return dst
+}
+
+func checkRow(t *testing.T, name string, dst *image.RGBA, want []color.RGBA) {
+	for x, w := range want {
+		got := dst.RGBAAt(x, 0)
+		if !near(got.R, w.R) || !near(got.G, w.G) || !near(got.B, w.B) || !near(got.A, w.A) {
+			t.Errorf("%s: pixel %d = %v, want %v", name, x, got, w)
+		}
+	}
+}
+
+func near(x, y uint8) bool {
+	return x-y <= 1 || y-x <= 1
+}
+
+func TestTransparentEdge(t *testing.T) {
+	// An opaque red texel next to a transparent one fades out without
+	// taking on the color of the transparent texel, here black.
+	src := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	src.SetNRGBA(0, 0, color.NRGBA{0xff, 0, 0, 0xff})
+	white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+	want := []color.RGBA{
+		{0xff, 0x00, 0x00, 0xff},
+		{0xff, 0x00, 0x00, 0xff},
+		{0xff, 0x20, 0x20, 0xff},
+		{0xff, 0x60, 0x60, 0xff},
+		{0xff, 0x9f, 0x9f, 0xff},
+		{0xff, 0xdf, 0xdf, 0xff},
+		white,
+		white,
+	}
+	checkRow(t, "fast", drawRow(t, Engine, src, white, 8), want)
+
+	// The same through the general sampler.
+	geom.PixelsPerPt = 1
+	dst := image.NewRGBA(image.Rect(0, 0, 8, 1))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(white), image.Point{}, draw.Src)
+	tex := &texture{m: image.NewRGBA(src.Bounds())}
+	tex.Upload(src.Bounds(), src)
+	a := f32.Affine{{0.25, 0, 0}, {0, 1, 0}}
+	sampleAffine(dst, newSampler(tex, sprite.SubTex{T: tex, R: src.Bounds()}, false), mixer{}, &a)
+	checkRow(t, "sampler", dst, want)
+}
+
+func TestTranslucentSprite(t *testing.T) {
+	// Half transparent blue over red, and half transparent black over
+	// white, which in linear light is brighter than halfway.
+	blue := image.NewUniform(color.NRGBA{0, 0, 0xff, 0x80})
+	black := image.NewUniform(color.NRGBA{0, 0, 0, 0x80})
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+	m := func(u *image.Uniform) image.Image {
+		m := image.NewRGBA(image.Rect(0, 0, 2, 2))
+		draw.Draw(m, m.Bounds(), u, image.Point{}, draw.Src)
+		return m
+	}
+	tests := []struct {
+		name   string
+		engine func(*image.RGBA) sprite.Engine
+		src    image.Image
+		bg     color.Color
+		want   color.RGBA
+	}{
+		{"blue", Engine, m(blue), red, color.RGBA{0x7f, 0, 0x80, 0xff}},
+		{"black", Engine, m(black), white, color.RGBA{0x7f, 0x7f, 0x7f, 0xff}},
+		{"linear black", LinearEngine, m(black), white, color.RGBA{0xbc, 0xbc, 0xbc, 0xff}},
+	}
+	for _, tc := range tests {
+		dst := drawRow(t, tc.engine, tc.src, tc.bg, 4)
+		checkRow(t, tc.name, dst, []color.RGBA{tc.want, tc.want, tc.want, tc.want})
+	}
+}
+
+func TestLinearGradient(t *testing.T) {
+	// Halfway between black and white is 50% gray in linear light,
+	// which encodes as 0xbc, where mixing sRGB gives 0x80.
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.SetRGBA(0, 0, color.RGBA{0, 0, 0, 0xff})
+	src.SetRGBA(1, 0, color.RGBA{0xff, 0xff, 0xff, 0xff})
+	bg := color.RGBA{0, 0, 0, 0xff}
+	for _, tc := range []struct {
+		name   string
+		engine func(*image.RGBA) sprite.Engine
+		want   uint8
+	}{
+		{"sRGB", Engine, 0x80},
+		{"linear", LinearEngine, 0xbc},
+	} {
+		// Pixel 3 of 7 samples exactly halfway between the texels.
+		got := drawRow(t, tc.engine, src, bg, 7).RGBAAt(3, 0)
+		if !near(got.R, tc.want) || got.R != got.G || got.G != got.B || got.A != 0xff {
+			t.Errorf("%s: middle = %v, want gray %#x", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestComposite(t *testing.T) {
+	// Opaque colors, for the separable modes.
+	s := [4]float32{128, 64, 0, 255}
+	d := [4]float32{64, 128, 255, 255}
+	// Half transparent blue and red, for the Porter-Duff operators.
+	hs := [4]float32{0, 0, 128, 128}
+	hd := [4]float32{128, 0, 0, 128}
+	tests := []struct {
+		mode sprite.BlendMode
+		s, d [4]float32
+		want [4]float32
+	}{
+		{sprite.BlendNormal, s, d, s},
+		{sprite.BlendAdd, s, d, [4]float32{192, 192, 255, 255}},
+		{sprite.BlendMultiply, s, d, [4]float32{32.13, 32.13, 0, 255}},
+		{sprite.BlendScreen, s, d, [4]float32{159.87, 159.87, 255, 255}},
+		{sprite.BlendOverlay, s, d, [4]float32{64.25, 64.75, 255, 255}},
+		{sprite.BlendDarken, s, d, [4]float32{64, 64, 0, 255}},
+		{sprite.BlendLighten, s, d, [4]float32{128, 128, 255, 255}},
+		{sprite.BlendNormal, hs, hd, [4]float32{63.75, 0, 128, 191.75}},
+		{sprite.BlendClear, hs, hd, [4]float32{}},
+		{sprite.BlendSrc, hs, hd, hs},
+		{sprite.BlendDst, hs, hd, hd},
+		{sprite.BlendDstOver, hs, hd, [4]float32{128, 0, 63.75, 191.75}},
+		{sprite.BlendSrcIn, hs, hd, [4]float32{0, 0, 64.25, 64.25}},
+		{sprite.BlendDstIn, hs, hd, [4]float32{64.25, 0, 0, 64.25}},
+		{sprite.BlendSrcOut, hs, hd, [4]float32{0, 0, 63.75, 63.75}},
+		{sprite.BlendDstOut, hs, hd, [4]float32{63.75, 0, 0, 63.75}},
+		{sprite.BlendSrcAtop, hs, hd, [4]float32{63.75, 0, 64.25, 128}},
+		{sprite.BlendDstAtop, hs, hd, [4]float32{64.25, 0, 63.75, 128}},
+		{sprite.BlendXor, hs, hd, [4]float32{63.75, 0, 63.75, 127.5}},
+	}
+	for _, tc := range tests {
+		got := composite(tc.mode, tc.s, tc.d)
+		for k := range got {
+			if d := got[k] - tc.want[k]; d < -0.5 || d > 0.5 {
+				t.Errorf("composite(%d, %v, %v) = %v, want %v", tc.mode, tc.s, tc.d, got, tc.want)
+				break
+			}
+		}
+	}
+}
+
+func TestBlendMode(t *testing.T) {
+	geom.PixelsPerPt = 1
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	glow := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	glow.SetRGBA(0, 0, color.RGBA{0, 0x40, 0x80, 0x80})
+
+	dst := image.NewRGBA(image.Rect(0, 0, 8, 1))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(red), image.Point{}, draw.Src)
+	e := Engine(dst)
+	tex, err := e.LoadTexture(glow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scene := new(sprite.Node)
+	for i, mode := range []sprite.BlendMode{sprite.BlendAdd, sprite.BlendSrc} {
+		scene.AppendChild(&sprite.Node{
+			Transform: &f32.Affine{
+				{2, 0, float32(2 * i)},
+				{0, 1, 0},
+			},
+			SubTex: sprite.SubTex{T: tex, R: glow.Bounds()},
+			Blend:  mode,
+		})
+	}
+	e.Render(scene, 0)
+
+	// Additive light brightens the red, and Src replaces it, leaving
+	// the rest of dst untouched.
+	want := []color.RGBA{
+		{0xff, 0x40, 0x80, 0xff},
+		{0xff, 0x40, 0x80, 0xff},
+		{0, 0x40, 0x80, 0x80},
+		{0, 0x40, 0x80, 0x80},
+		red, red, red, red,
+	}
+	checkRow(t, "blend", dst, want)
+}
@@ -0,0 +1,319 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package portable
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"runtime"
+	"sync"
+
+	"golang.org/x/mobile/f32"
+	"golang.org/x/mobile/geom"
+
+	"github.com/crawshaw/sprite"
+	"github.com/crawshaw/sprite/clock"
+)
+
+// renderEffects records the drawing of n, whose transform to dst pixels
+// is m, with its Effects.
+//
+// The node and its descendants are drawn offscreen, with no clip: the
+// clips of n and its ancestors apply to the result, as they would to any
+// drawing. The image drawn into only covers the ops of the subtree. The
+// effects are applied to it, grown by as far as they spread, and the
+// result is recorded as a single drawing over dst.
+func (e *engine) renderEffects(n *sprite.Node, m f32.Affine, t clock.Time) {
+	// What was recorded before is drawn first, so that only the ops of
+	// the node are pending should its Arrangers change their sources.
+	e.flush()
+	frameDst, frameOps, frameClips, frameGrow := e.dst, e.ops, e.clips, e.grow
+	e.dst, e.ops, e.clips, e.grow = new(image.RGBA), nil, nil, true
+	e.renderContent(n, m, t)
+	e.flush()
+	img := e.dst
+	e.dst, e.ops, e.clips, e.grow = frameDst, frameOps, frameClips, frameGrow
+	if img.Rect.Empty() {
+		return
+	}
+
+	margin := 0
+	for _, fx := range n.Effects {
+		margin += effectMargin(fx)
+	}
+	l := newLayer(img, img.Rect.Inset(-margin).Intersect(e.area), e.linear)
+	for _, fx := range n.Effects {
+		e.applyEffect(l, fx)
+	}
+
+	// The layer has the pixels of dst, so it is drawn pixel for pixel.
+	origin := e.area.Min
+	a := f32.Affine{
+		{1, 0, float32(origin.X - l.r.Min.X)},
+		{0, 1, float32(origin.Y - l.r.Min.Y)},
+	}
+	linear := e.linear
+	e.addOp(&a, l.r.Dx(), l.r.Dy(), func(dst *image.RGBA, _ *f32.Affine) {
+		l.draw(dst, linear)
+	})
+}
+
+// A layer is a premultiplied image with float32 channels in [0, 255],
+// in linear light if the engine mixes colors in linear light. Effects
+// work on layers, so that their passes lose no precision.
+type layer struct {
+	r   image.Rectangle
+	pix [][4]float32 // the pixels of r, row by row
+}
+
+// newLayer returns the pixels r of img as a layer, transparent outside
+// the bounds of img.
+func newLayer(img *image.RGBA, r image.Rectangle, linear bool) *layer {
+	l := &layer{r: r, pix: make([][4]float32, r.Dx()*r.Dy())}
+	b := r.Intersect(img.Rect)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		i := (y-r.Min.Y)*r.Dx() + b.Min.X - r.Min.X
+		off := img.PixOffset(b.Min.X, y)
+		for x := b.Min.X; x < b.Max.X; x, i, off = x+1, i+1, off+4 {
+			c := pixel(img, off)
+			if linear && c[3] > 0 {
+				c = decode(c)
+			}
+			l.pix[i] = c
+		}
+	}
+	return l
+}
+
+// draw composites the layer over the pixels of dst that it covers.
+func (l *layer) draw(dst *image.RGBA, linear bool) {
+	r := dst.Bounds().Intersect(l.r)
+	w := l.r.Dx()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		i := (y-l.r.Min.Y)*w + r.Min.X - l.r.Min.X
+		off := dst.PixOffset(r.Min.X, y)
+		for x := r.Min.X; x < r.Max.X; x, i, off = x+1, i+1, off+4 {
+			over(dst, off, l.pix[i], 1, linear)
+		}
+	}
+}
+
+// effectMargin returns how many pixels beyond the drawing fx may
+// change.
+func effectMargin(fx sprite.Effect) int {
+	switch fx := fx.(type) {
+	case sprite.Blur:
+		return blurRadius(pixels(fx.StdDev))
+	case sprite.DropShadow:
+		dx, dy := pixels(fx.Offset.X), pixels(fx.Offset.Y)
+		return blurRadius(pixels(fx.Blur)) + int(math.Ceil(float64(max32(abs32(dx), abs32(dy)))))
+	case sprite.Glow:
+		return blurRadius(pixels(fx.Radius) / 3)
+	}
+	return 0
+}
+
+// applyEffect applies fx to the layer l.
+func (e *engine) applyEffect(l *layer, fx sprite.Effect) {
+	switch fx := fx.(type) {
+	case sprite.Blur:
+		e.blur(l, pixels(fx.StdDev))
+	case sprite.DropShadow:
+		c := fx.Color
+		if c == nil {
+			c = color.Black
+		}
+		s := e.shadow(l, pixels(fx.Offset.X), pixels(fx.Offset.Y), colorOf(c, e.linear))
+		e.blur(s, pixels(fx.Blur))
+		e.under(l, s, 1)
+	case sprite.Glow:
+		c := fx.Color
+		if c == nil {
+			c = color.White
+		}
+		// The blur of the alpha is half covered at the edge of the
+		// drawing. Doubling it makes the glow opaque there, fading out
+		// over about three standard deviations.
+		s := e.shadow(l, 0, 0, colorOf(c, e.linear))
+		e.blur(s, pixels(fx.Radius)/3)
+		e.under(l, s, 2)
+	case sprite.ColorMatrix:
+		e.colorMatrix(l, &fx)
+	}
+}
+
+// pixels converts a distance on the screen to pixels.
+func pixels(v geom.Pt) float32 {
+	return float32(v) * geom.PixelsPerPt
+}
+
+func abs32(v float32) float32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// parallel calls f for the rows [lo, hi) of n rows, split among the
+// engine's workers.
+func (e *engine) parallel(n int, f func(lo, hi int)) {
+	workers := e.workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		f(0, n)
+		return
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(lo, hi int) {
+			defer wg.Done()
+			f(lo, hi)
+		}(n*i/workers, n*(i+1)/workers)
+	}
+	wg.Wait()
+}
+
+// blurRadius returns how far a Gaussian kernel of standard deviation
+// sigma is wide enough to matter.
+func blurRadius(sigma float32) int {
+	if sigma <= 0 {
+		return 0
+	}
+	return int(math.Ceil(float64(3 * sigma)))
+}
+
+// blur applies a Gaussian blur of standard deviation sigma to l. The
+// kernel is separable, so it is a horizontal pass and then a vertical
+// one, each parallel over the rows. The layer is transparent beyond its
+// bounds.
+func (e *engine) blur(l *layer, sigma float32) {
+	radius := blurRadius(sigma)
+	if radius == 0 {
+		return
+	}
+	kernel := make([]float32, 2*radius+1)
+	var sum float32
+	for i := range kernel {
+		d := float64(i - radius)
+		kernel[i] = float32(math.Exp(-d * d / (2 * float64(sigma*sigma))))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+
+	w, h := l.r.Dx(), l.r.Dy()
+	tmp := make([][4]float32, len(l.pix))
+	e.parallel(h, func(lo, hi int) {
+		for y := lo; y < hi; y++ {
+			row := l.pix[y*w : (y+1)*w]
+			for x := 0; x < w; x++ {
+				var c [4]float32
+				for i, k := range kernel {
+					if sx := x + i - radius; sx >= 0 && sx < w {
+						s := &row[sx]
+						c[0] += s[0] * k
+						c[1] += s[1] * k
+						c[2] += s[2] * k
+						c[3] += s[3] * k
+					}
+				}
+				tmp[y*w+x] = c
+			}
+		}
+	})
+	e.parallel(h, func(lo, hi int) {
+		for y := lo; y < hi; y++ {
+			for x := 0; x < w; x++ {
+				var c [4]float32
+				for i, k := range kernel {
+					if sy := y + i - radius; sy >= 0 && sy < h {
+						s := &tmp[sy*w+x]
+						c[0] += s[0] * k
+						c[1] += s[1] * k
+						c[2] += s[2] * k
+						c[3] += s[3] * k
+					}
+				}
+				l.pix[y*w+x] = c
+			}
+		}
+	})
+}
+
+// shadow returns a layer of the color c, premultiplied, with the alpha
+// of l moved by (dx, dy) pixels.
+func (e *engine) shadow(l *layer, dx, dy float32, c [4]float32) *layer {
+	w, h := l.r.Dx(), l.r.Dy()
+	s := &layer{r: l.r, pix: make([][4]float32, len(l.pix))}
+	alpha := func(x, y int) float32 {
+		if x < 0 || x >= w || y < 0 || y >= h {
+			return 0
+		}
+		return l.pix[y*w+x][3]
+	}
+	// A fractional offset interpolates between the alphas of the four
+	// pixels around it.
+	ix, iy := int(math.Floor(float64(dx))), int(math.Floor(float64(dy)))
+	fx, fy := dx-float32(ix), dy-float32(iy)
+	e.parallel(h, func(lo, hi int) {
+		for y := lo; y < hi; y++ {
+			for x := 0; x < w; x++ {
+				sx, sy := x-ix, y-iy
+				a := (alpha(sx, sy)*(1-fx)+alpha(sx-1, sy)*fx)*(1-fy) +
+					(alpha(sx, sy-1)*(1-fx)+alpha(sx-1, sy-1)*fx)*fy
+				a /= 255
+				s.pix[y*w+x] = [4]float32{c[0] * a, c[1] * a, c[2] * a, c[3] * a}
+			}
+		}
+	})
+	return s
+}
+
+// under composites s, its alpha scaled by strength up to opaque, under
+// l, into l.
+func (e *engine) under(l, s *layer, strength float32) {
+	e.parallel(l.r.Dy(), func(lo, hi int) {
+		w := l.r.Dx()
+		for i := lo * w; i < hi*w; i++ {
+			d, u := &l.pix[i], &s.pix[i]
+			t := 1 - d[3]/255
+			if u[3] > 0 {
+				t *= min32(strength, 255/u[3])
+			}
+			d[0] += u[0] * t
+			d[1] += u[1] * t
+			d[2] += u[2] * t
+			d[3] += u[3] * t
+		}
+	})
+}
+
+// colorMatrix applies the matrix m to the unpremultiplied colors of l.
+func (e *engine) colorMatrix(l *layer, m *sprite.ColorMatrix) {
+	e.parallel(l.r.Dy(), func(lo, hi int) {
+		w := l.r.Dx()
+		for i := lo * w; i < hi*w; i++ {
+			p := &l.pix[i]
+			var v [4]float32
+			if p[3] > 0 {
+				v = [4]float32{p[0] / p[3], p[1] / p[3], p[2] / p[3], p[3] / 255}
+			}
+			var r [4]float32
+			for k := range r {
+				r[k] = clampf(m[k][0]*v[0]+m[k][1]*v[1]+m[k][2]*v[2]+m[k][3]*v[3]+m[k][4], 0, 1)
+			}
+			a := r[3] * 255
+			*p = [4]float32{r[0] * a, r[1] * a, r[2] * a, a}
+		}
+	})
+}
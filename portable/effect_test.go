@@ -0,0 +1,187 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package portable
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"golang.org/x/mobile/f32"
+	"golang.org/x/mobile/geom"
+
+	"github.com/crawshaw/sprite"
+)
+
+// effectScene returns an engine drawing onto a 24x24 dst of the color
+// bg, and a node that fills the square (8, 8)-(16, 16) with red.
+func effectScene(t *testing.T, bg color.Color) (*image.RGBA, sprite.Engine, *sprite.Node) {
+	geom.PixelsPerPt = 1
+	dst := image.NewRGBA(image.Rect(0, 0, 24, 24))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	e := Engine(dst)
+	m := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	m.SetRGBA(0, 0, clipRed)
+	tex, err := e.LoadTexture(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	square := &sprite.Node{
+		Transform: &f32.Affine{{8, 0, 8}, {0, 8, 8}},
+		SubTex:    sprite.SubTex{T: tex, R: m.Bounds()},
+	}
+	return dst, e, square
+}
+
+func TestBlur(t *testing.T) {
+	dst, e, square := effectScene(t, color.Transparent)
+	square.Effects = []sprite.Effect{sprite.Blur{StdDev: 2}}
+	e.Render(square, 0)
+
+	// The blur spreads the square without losing any of it.
+	sum := 0
+	for i := 3; i < len(dst.Pix); i += 4 {
+		sum += int(dst.Pix[i])
+	}
+	if want := 64 * 255; sum < want-64*4 || sum > want+64*4 {
+		t.Errorf("total alpha %d, want %d", sum, want)
+	}
+	if got := dst.RGBAAt(11, 11); got.A < 0xe0 || got.R != got.A {
+		t.Errorf("center = %v, want nearly opaque red", got)
+	}
+	if got := dst.RGBAAt(8, 11); got.A < 0x60 || got.A > 0xa0 {
+		t.Errorf("edge = %v, want about half covered", got)
+	}
+	if got := dst.RGBAAt(5, 11); got.A == 0 || got.A > 0x20 {
+		t.Errorf("outside = %v, want faintly covered", got)
+	}
+	if got := dst.RGBAAt(1, 11); got.A != 0 {
+		t.Errorf("far = %v, want transparent", got)
+	}
+	// Blurring premultiplied colors fades the red without darkening it.
+	if got := dst.RGBAAt(6, 11); got.R != got.A || got.G != 0 {
+		t.Errorf("fade = %v, want translucent red", got)
+	}
+}
+
+func TestDropShadow(t *testing.T) {
+	dst, e, square := effectScene(t, color.White)
+	square.Effects = []sprite.Effect{sprite.DropShadow{Offset: geom.Point{4, 4}}}
+	e.Render(square, 0)
+	black := color.RGBA{0, 0, 0, 0xff}
+	checkPixels(t, "shadow", dst, []pixelTest{
+		{9, 9, clipRed},
+		{15, 15, clipRed},
+		{17, 17, black},
+		{19, 13, black},
+		{13, 19, black},
+		{9, 17, clipWhite},
+		{17, 9, clipWhite},
+		{20, 20, clipWhite},
+		{4, 4, clipWhite},
+	})
+
+	// A blurred, colored shadow.
+	dst, e, square = effectScene(t, color.White)
+	square.Effects = []sprite.Effect{sprite.DropShadow{
+		Offset: geom.Point{4, 4},
+		Blur:   1,
+		Color:  color.RGBA{0, 0, 0x80, 0x80},
+	}}
+	e.Render(square, 0)
+	checkPixels(t, "blurred", dst, []pixelTest{
+		{9, 9, clipRed},
+		{17, 17, color.RGBA{0x7f, 0x7f, 0xff, 0xff}},
+		{23, 23, clipWhite},
+	})
+	if got := dst.RGBAAt(20, 17); got.B != 0xff || got.R <= 0x80 || got.R == 0xff {
+		t.Errorf("blurred edge = %v, want partly shadowed", got)
+	}
+}
+
+func TestGlow(t *testing.T) {
+	dst, e, square := effectScene(t, color.Black)
+	square.Effects = []sprite.Effect{sprite.Glow{Radius: 6}}
+	e.Render(square, 0)
+	if got := dst.RGBAAt(11, 11); got != clipRed {
+		t.Errorf("center = %v, want %v", got, clipRed)
+	}
+	// Just outside the square the glow is bright, and it fades out
+	// further away.
+	near, far := dst.RGBAAt(7, 11), dst.RGBAAt(4, 11)
+	if near.G < 0xc0 || near.G != near.B || near.R != near.G {
+		t.Errorf("near = %v, want bright white", near)
+	}
+	if far.G == 0 || far.G >= near.G {
+		t.Errorf("far = %v, want fainter than %v", far, near)
+	}
+	if got := dst.RGBAAt(0, 0); got != (color.RGBA{0, 0, 0, 0xff}) {
+		t.Errorf("corner = %v, want black", got)
+	}
+}
+
+func TestColorMatrix(t *testing.T) {
+	tests := []struct {
+		name string
+		fx   []sprite.Effect
+		want color.RGBA
+	}{
+		{"grayscale", []sprite.Effect{sprite.Grayscale(1)}, color.RGBA{0x36, 0x36, 0x36, 0xff}},
+		{"half grayscale", []sprite.Effect{sprite.Grayscale(0.5)}, color.RGBA{0x9a, 0x1b, 0x1b, 0xff}},
+		{"sepia", []sprite.Effect{sprite.Sepia(1)}, color.RGBA{0x64, 0x59, 0x45, 0xff}},
+		{"hue", []sprite.Effect{sprite.HueRotate(0)}, clipRed},
+		{"brightness", []sprite.Effect{sprite.Brightness(0)}, color.RGBA{0, 0, 0, 0xff}},
+		{"both", []sprite.Effect{sprite.Brightness(0.5), sprite.Grayscale(1)}, color.RGBA{0x1b, 0x1b, 0x1b, 0xff}},
+	}
+	for _, tc := range tests {
+		dst, e, square := effectScene(t, color.White)
+		square.Effects = tc.fx
+		e.Render(square, 0)
+		checkPixels(t, tc.name, dst, []pixelTest{
+			{12, 12, tc.want},
+			{4, 4, clipWhite},
+		})
+	}
+}
+
+func TestEffectClip(t *testing.T) {
+	// The clip of the node applies to the result of its effects.
+	dst, e, square := effectScene(t, color.White)
+	scene := &sprite.Node{
+		Clip:    &sprite.Clip{Rect: geom.Rectangle{Max: geom.Point{24, 18}}},
+		Effects: []sprite.Effect{sprite.DropShadow{Offset: geom.Point{4, 4}}},
+	}
+	scene.AppendChild(square)
+	e.Render(scene, 0)
+	checkPixels(t, "clip", dst, []pixelTest{
+		{9, 9, clipRed},
+		{17, 17, color.RGBA{0, 0, 0, 0xff}},
+		{17, 18, clipWhite},
+		{13, 19, clipWhite},
+	})
+}
+
+func TestEffectGrows(t *testing.T) {
+	// The offscreen image of an effect covers the first square, until
+	// the uploader has it drawn and the second square grows it.
+	dst, e, square := effectScene(t, color.White)
+	src := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	src.SetRGBA(0, 0, clipRed)
+	scene := &sprite.Node{Effects: []sprite.Effect{sprite.Brightness(1)}}
+	scene.AppendChild(square)
+	scene.AppendChild(&sprite.Node{
+		Transform: &f32.Affine{{4, 0, 0}, {0, 4, 0}},
+		SubTex:    square.SubTex,
+		Arranger:  &uploader{src},
+	})
+	e.Render(scene, 0)
+	checkPixels(t, "grown", dst, []pixelTest{
+		{1, 1, clipRed},
+		{12, 12, clipRed},
+		{6, 6, clipWhite},
+		{20, 20, clipWhite},
+	})
+}
@@ -0,0 +1,274 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package portable
+
+import (
+	"image"
+	"image/draw"
+
+	"golang.org/x/mobile/f32"
+)
+
+// Most sprites are neither rotated nor sheared, so each row of dst
+// samples a single row of src, and each column a single column. The
+// interpolation is then the same along a whole row or column and can
+// be worked out once, rather than for every pixel.
+//
+// Two cases of an RGBA src with no mask need no interpolation at all.
+// When, as in an unscaled translation by whole pixels or an odd integer
+// downscale, every pixel center lands on a texel center, texels are
+// read directly, and runs of them copied whole. When every pixel center
+// lands between two texels along each axis, as in a downscale by two,
+// bilinear interpolation is the average of a 2x2 box of texels.
+
+// affineAxis draws as affine does, for a that neither rotates nor
+// shears. It reports false, drawing nothing, if a or the images are
+// not ones it handles.
+//
+// The src must be an *image.RGBA, or an *image.Uniform with a mask.
+// The mask, if any, must be an *image.Alpha, and srcb must then be at
+// the origin.
+func affineAxis(dst *image.RGBA, src image.Image, srcb image.Rectangle, mask image.Image, a *f32.Affine, op draw.Op) bool {
+	if a[0][1] != 0 || a[1][0] != 0 {
+		return false
+	}
+	var m *image.Alpha
+	if mask != nil {
+		var ok bool
+		if m, ok = mask.(*image.Alpha); !ok || srcb.Min != (image.Point{}) {
+			return false
+		}
+	}
+	var rgba *image.RGBA
+	var ur, ug, ub, ua uint32
+	switch src := src.(type) {
+	case *image.RGBA:
+		rgba = src
+	case *image.Uniform:
+		if m == nil {
+			return false
+		}
+		ur, ug, ub, ua = src.C.RGBA()
+	default:
+		return false
+	}
+
+	b := dst.Bounds()
+	// As in bilinear, samples are clamped to the whole of src, not
+	// just srcb.
+	sb := src.Bounds()
+	xs := taps(b.Dx(), a[0][0], a[0][2]+float32(srcb.Min.X), srcb.Min.X, srcb.Max.X, sb.Min.X, sb.Max.X)
+	ys := taps(b.Dy(), a[1][1], a[1][2]+float32(srcb.Min.Y), srcb.Min.Y, srcb.Max.Y, sb.Min.Y, sb.Max.Y)
+	var mxs, mys []tap
+	if m != nil {
+		// The mask is sampled at the same place as src, offset by its
+		// origin.
+		mb := m.Bounds()
+		mxs = taps(b.Dx(), a[0][0], a[0][2]+float32(mb.Min.X), mb.Min.X, mb.Max.X, mb.Min.X, mb.Max.X)
+		mys = taps(b.Dy(), a[1][1], a[1][2]+float32(mb.Min.Y), mb.Min.Y, mb.Max.Y, mb.Min.Y, mb.Max.Y)
+	}
+
+	if m == nil && rgba != nil {
+		switch {
+		case exact(xs) && exact(ys):
+			drawExact(dst, rgba, xs, ys, op)
+			return true
+		case halves(xs) && halves(ys):
+			drawBox(dst, rgba, xs, ys, op)
+			return true
+		}
+	}
+
+	const mx = 1<<16 - 1
+	for j, ty := range ys {
+		if !ty.ok || m != nil && !mys[j].ok {
+			continue
+		}
+		off := (b.Min.Y+j-dst.Rect.Min.Y)*dst.Stride + (b.Min.X-dst.Rect.Min.X)*4
+		for i, tx := range xs {
+			if !tx.ok || m != nil && !mxs[i].ok {
+				off += 4
+				continue
+			}
+			ma := uint32(mx)
+			if m != nil {
+				ma = sampleAlpha(m, mxs[i], mys[j]) * 0x101
+			}
+			if rgba == nil {
+				blend(dst, off, ur, ug, ub, ua, ma, op)
+				off += 4
+				continue
+			}
+			c := sampleRGBA(rgba, tx, ty)
+			if ma == mx {
+				put(dst, off, c[:], op)
+			} else {
+				blend(dst, off, uint32(c[0])*0x101, uint32(c[1])*0x101, uint32(c[2])*0x101, uint32(c[3])*0x101, ma, op)
+			}
+			off += 4
+		}
+	}
+	return true
+}
+
+// put draws the 8-bit color c at off in dst.
+func put(dst *image.RGBA, off int, c []uint8, op draw.Op) {
+	if op == draw.Src || c[3] == 0xff {
+		// An opaque texel replaces dst.
+		copy(dst.Pix[off:off+4], c)
+		return
+	}
+	blend(dst, off, uint32(c[0])*0x101, uint32(c[1])*0x101, uint32(c[2])*0x101, uint32(c[3])*0x101, 1<<16-1, op)
+}
+
+// exact reports whether the taps ts are all on texel centers.
+func exact(ts []tap) bool {
+	for _, t := range ts {
+		if t.ok && t.w != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// halves reports whether the taps ts are all halfway between two
+// texels, or on a texel center at the edge of src.
+func halves(ts []tap) bool {
+	for _, t := range ts {
+		if t.ok && t.w != 0.5 && t.low != t.high {
+			return false
+		}
+	}
+	return true
+}
+
+// drawExact draws the texels of src at the taps xs and ys, which are
+// exact, onto dst.
+func drawExact(dst, src *image.RGBA, xs, ys []tap, op draw.Op) {
+	b := dst.Bounds()
+	for j, ty := range ys {
+		if !ty.ok {
+			continue
+		}
+		off := (b.Min.Y+j-dst.Rect.Min.Y)*dst.Stride + (b.Min.X-dst.Rect.Min.X)*4
+		for i := 0; i < len(xs); {
+			tx := xs[i]
+			if !tx.ok {
+				i, off = i+1, off+4
+				continue
+			}
+			// Consecutive texels, as in a translation, make a run.
+			n := 1
+			for i+n < len(xs) && xs[i+n].ok && xs[i+n].low == tx.low+n {
+				n++
+			}
+			soff := src.PixOffset(tx.low, ty.low)
+			if op == draw.Src {
+				copy(dst.Pix[off:off+4*n], src.Pix[soff:soff+4*n])
+			} else {
+				for k := 0; k < 4*n; k += 4 {
+					put(dst, off+k, src.Pix[soff+k:soff+k+4], op)
+				}
+			}
+			i, off = i+n, off+4*n
+		}
+	}
+}
+
+// drawBox draws the averages of the texels of src either side of the
+// taps xs and ys, which are halves, onto dst.
+func drawBox(dst, src *image.RGBA, xs, ys []tap, op draw.Op) {
+	b := dst.Bounds()
+	var c [4]uint8
+	for j, ty := range ys {
+		if !ty.ok {
+			continue
+		}
+		off := (b.Min.Y+j-dst.Rect.Min.Y)*dst.Stride + (b.Min.X-dst.Rect.Min.X)*4
+		for _, tx := range xs {
+			if !tx.ok {
+				off += 4
+				continue
+			}
+			off00, off01 := src.PixOffset(tx.low, ty.low), src.PixOffset(tx.high, ty.low)
+			off10, off11 := src.PixOffset(tx.low, ty.high), src.PixOffset(tx.high, ty.high)
+			for k := range c {
+				// Rounded as sampleRGBA rounds.
+				sum := uint32(src.Pix[off00+k]) + uint32(src.Pix[off01+k]) + uint32(src.Pix[off10+k]) + uint32(src.Pix[off11+k])
+				c[k] = uint8((sum + 2) / 4)
+			}
+			put(dst, off, c[:], op)
+			off += 4
+		}
+	}
+}
+
+// A tap is where one row or column of dst samples src.
+type tap struct {
+	low, high int     // the texels either side of the sample
+	w         float32 // the weight of high; low has 1-w
+	ok        bool    // whether the sample is inside the source
+}
+
+// taps returns the samples, along one axis, of n pixels of dst, where
+// pixel i is at scale*(i+0.5)+off in src. Samples outside [min, max)
+// are not ok, and texels are clamped to [cmin, cmax). They are those
+// found by findLinearSrc.
+func taps(n int, scale, off float32, min, max, cmin, cmax int) []tap {
+	ts := make([]tap, n)
+	for i := range ts {
+		s := scale*(float32(i)+0.5) + off
+		if s < float32(min) || s >= float32(max) {
+			continue
+		}
+		low, high := floor(s-0.5), ceil(s-0.5)
+		if low < float32(cmin) {
+			low = float32(cmin)
+		}
+		if high >= float32(cmax) {
+			high = float32(cmax - 1)
+		}
+		t := tap{low: int(low), high: int(high), ok: true}
+		if t.low != t.high {
+			t.w = s - (low + 0.5)
+		}
+		ts[i] = t
+	}
+	return ts
+}
+
+// sampleRGBA returns the 8-bit color of src at the taps x and y.
+func sampleRGBA(src *image.RGBA, x, y tap) [4]uint8 {
+	off00 := src.PixOffset(x.low, y.low)
+	if x.w == 0 && y.w == 0 {
+		var c [4]uint8
+		copy(c[:], src.Pix[off00:off00+4])
+		return c
+	}
+	off01 := src.PixOffset(x.high, y.low)
+	off10 := src.PixOffset(x.low, y.high)
+	off11 := src.PixOffset(x.high, y.high)
+	var c [4]uint8
+	for k := range c {
+		top := float32(src.Pix[off00+k])*(1-x.w) + float32(src.Pix[off01+k])*x.w
+		bot := float32(src.Pix[off10+k])*(1-x.w) + float32(src.Pix[off11+k])*x.w
+		c[k] = uint8(top*(1-y.w) + bot*y.w + 0.5)
+	}
+	return c
+}
+
+// sampleAlpha returns the 8-bit alpha of m at the taps x and y.
+func sampleAlpha(m *image.Alpha, x, y tap) uint32 {
+	off00 := m.PixOffset(x.low, y.low)
+	if x.w == 0 && y.w == 0 {
+		return uint32(m.Pix[off00])
+	}
+	off01 := m.PixOffset(x.high, y.low)
+	off10 := m.PixOffset(x.low, y.high)
+	off11 := m.PixOffset(x.high, y.high)
+	top := float32(m.Pix[off00])*(1-x.w) + float32(m.Pix[off01])*x.w
+	bot := float32(m.Pix[off10])*(1-x.w) + float32(m.Pix[off11])*x.w
+	return uint32(top*(1-y.w) + bot*y.w + 0.5)
+}
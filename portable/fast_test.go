@@ -0,0 +1,145 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package portable
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"golang.org/x/mobile/f32"
+)
+
+func fastTestSrc() *image.RGBA {
+	src := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	for y := 0; y < 30; y++ {
+		for x := 0; x < 40; x++ {
+			a := uint8(0xff)
+			if (x+y)%7 == 0 {
+				a = 0x80
+			}
+			// Premultiplied, so no channel exceeds alpha.
+			src.SetRGBA(x, y, color.RGBA{uint8(x*6) & a, uint8(y*8) & a, uint8(x*y) & a, a})
+		}
+	}
+	return src
+}
+
+func fastTestDst() *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, 100, 80))
+	for i := range dst.Pix {
+		dst.Pix[i] = uint8(i * 7)
+	}
+	for i := 3; i < len(dst.Pix); i += 4 {
+		dst.Pix[i] = 0xff
+	}
+	return dst.SubImage(image.Rect(5, 7, 95, 75)).(*image.RGBA)
+}
+
+func TestAffineAxis(t *testing.T) {
+	src := fastTestSrc()
+	mask := image.NewAlpha(image.Rect(0, 0, 40, 30))
+	for i := range mask.Pix {
+		mask.Pix[i] = uint8(i * 13)
+	}
+	tests := []struct {
+		desc string
+		a    f32.Affine // maps dst to src
+		srcb image.Rectangle
+		mask bool
+	}{
+		{"translate", f32.Affine{{1, 0, -10}, {0, 1, -5}}, src.Bounds(), false},
+		{"translate sub-rect", f32.Affine{{1, 0, -10}, {0, 1, -5}}, image.Rect(5, 5, 30, 20), false},
+		{"translate fractional", f32.Affine{{1, 0, -10.25}, {0, 1, -5.5}}, src.Bounds(), false},
+		{"upscale 2", f32.Affine{{0.5, 0, -3}, {0, 0.5, -2}}, src.Bounds(), false},
+		{"upscale 3", f32.Affine{{1. / 3, 0, 0}, {0, 1. / 3, 0}}, image.Rect(4, 4, 36, 26), false},
+		{"downscale 2", f32.Affine{{2, 0, 0}, {0, 2, 0}}, src.Bounds(), false},
+		{"downscale 2 sub-rect", f32.Affine{{2, 0, -1}, {0, 2, 3}}, image.Rect(3, 2, 37, 29), false},
+		{"downscale 3", f32.Affine{{3, 0, 1}, {0, 3, 0}}, src.Bounds(), false},
+		{"stretch", f32.Affine{{0.37, 0, -2.2}, {0, 1.6, 3.1}}, src.Bounds(), false},
+		{"flip", f32.Affine{{-0.5, 0, 40}, {0, 1, 0}}, src.Bounds(), false},
+		{"mask", f32.Affine{{0.5, 0, -3}, {0, 0.5, -2}}, src.Bounds(), true},
+	}
+	for _, test := range tests {
+		for _, op := range []draw.Op{draw.Over, draw.Src} {
+			var m image.Image
+			var s image.Image = src
+			if test.mask {
+				m = mask
+				s = image.NewUniform(color.RGBA{0x40, 0x20, 0, 0x80})
+			}
+			want := fastTestDst()
+			affineGeneral(want, s, test.srcb, m, &test.a, op)
+			got := fastTestDst()
+			if !affineAxis(got, s, test.srcb, m, &test.a, op) {
+				t.Errorf("%s: not handled", test.desc)
+				continue
+			}
+			// Interpolating along each axis in turn rounds a
+			// little differently.
+			for i := range got.Pix {
+				if d := int(got.Pix[i]) - int(want.Pix[i]); d < -1 || d > 1 {
+					t.Errorf("%s, op %v: differs from the general path at %d: %d, want %d", test.desc, op, i, got.Pix[i], want.Pix[i])
+					break
+				}
+			}
+		}
+	}
+
+	rotated := f32.Affine{{0, 1, 0}, {1, 0, 0}}
+	if affineAxis(fastTestDst(), src, src.Bounds(), nil, &rotated, draw.Over) {
+		t.Error("rotation handled")
+	}
+}
+
+func TestTapKinds(t *testing.T) {
+	tests := []struct {
+		desc          string
+		scale, off    float32
+		exact, halves bool
+	}{
+		// Exact taps are halves too, averaging a texel with itself.
+		{"translate", 1, -3, true, true},
+		{"translate fractional", 1, -3.25, false, false},
+		{"downscale 2", 2, 0, false, true},
+		{"downscale 3", 3, 1, true, true},
+		{"upscale 2", 0.5, 0, false, false},
+	}
+	for _, test := range tests {
+		ts := taps(16, test.scale, test.off, 0, 20, 0, 20)
+		if got := exact(ts); got != test.exact {
+			t.Errorf("%s: exact = %v, want %v", test.desc, got, test.exact)
+		}
+		if got := halves(ts); got != test.halves {
+			t.Errorf("%s: halves = %v, want %v", test.desc, got, test.halves)
+		}
+	}
+}
+
+func benchmarkAffine(b *testing.B, a f32.Affine, fn func(*image.RGBA, image.Image, image.Rectangle, image.Image, *f32.Affine, draw.Op)) {
+	src := image.NewRGBA(image.Rect(0, 0, 128, 128))
+	for i := range src.Pix {
+		src.Pix[i] = 0xff
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, 256, 256))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fn(dst, src, src.Bounds(), nil, &a, draw.Over)
+	}
+}
+
+var (
+	translate = f32.Affine{{1, 0, 0}, {0, 1, 0}}
+	upscale   = f32.Affine{{0.5, 0, 0}, {0, 0.5, 0}}
+	downscale = f32.Affine{{2, 0, 0}, {0, 2, 0}}
+)
+
+func BenchmarkAffineTranslate(b *testing.B)        { benchmarkAffine(b, translate, affine) }
+func BenchmarkAffineTranslateGeneral(b *testing.B) { benchmarkAffine(b, translate, affineGeneral) }
+func BenchmarkAffineUpscale(b *testing.B)          { benchmarkAffine(b, upscale, affine) }
+func BenchmarkAffineUpscaleGeneral(b *testing.B)   { benchmarkAffine(b, upscale, affineGeneral) }
+func BenchmarkAffineDownscale(b *testing.B)        { benchmarkAffine(b, downscale, affine) }
+func BenchmarkAffineDownscaleGeneral(b *testing.B) { benchmarkAffine(b, downscale, affineGeneral) }
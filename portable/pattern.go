@@ -0,0 +1,101 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package portable
+
+import (
+	"image"
+
+	"golang.org/x/mobile/f32"
+
+	"github.com/crawshaw/sprite"
+)
+
+// pattern fills dst with the pattern p wherever the coverage mask
+// maskb, a sub-image of mask, is drawn by the affine transform a. The
+// tile is read by s, with the filter and wrap modes of p.SubTex, and
+// composited by mix. The wrap modes also repeat the tile.
+//
+// As with the affine function, a maps dst pixels to the unit square of
+// the node. The mask covers the unit square, and the pattern is
+// positioned in it by p.Transform.
+func pattern(dst *image.RGBA, mask image.Image, maskb image.Rectangle, p *sprite.Pattern, s *sampler, mix mixer, a *f32.Affine) {
+	srcb := p.SubTex.R
+	if srcb.Empty() {
+		return
+	}
+
+	// inv maps the unit square of the node to the unit square of a tile.
+	var inv f32.Affine
+	if p.Transform != nil {
+		inv.Inverse(p.Transform)
+	} else {
+		inv.Identity()
+	}
+
+	b := dst.Bounds()
+	mdx, mdy := float32(maskb.Dx()), float32(maskb.Dy())
+	sdx, sdy := float32(srcb.Dx()), float32(srcb.Dy())
+
+	// ta maps dst pixels to texels of the tile, choosing its mipmap.
+	var ta f32.Affine
+	ta.Mul(&inv, a)
+	for i := 0; i < 3; i++ {
+		ta[0][i] *= sdx
+		ta[1][i] *= sdy
+	}
+	l := lod(&ta)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			u, v := pt(a, x-b.Min.X, y-b.Min.Y)
+			mx := u*mdx + float32(maskb.Min.X)
+			my := v*mdy + float32(maskb.Min.Y)
+			if !inBounds(maskb, mx, my) {
+				continue
+			}
+			_, _, _, ma := bilinear(mask, mx, my).RGBA()
+			if ma == 0 {
+				continue
+			}
+
+			tx := u*inv[0][0] + v*inv[0][1] + inv[0][2]
+			ty := u*inv[1][0] + v*inv[1][1] + inv[1][2]
+			tx, okx := wrap(p.SubTex.WrapX, tx)
+			ty, oky := wrap(p.SubTex.WrapY, ty)
+			if !okx || !oky {
+				continue
+			}
+
+			c := s.at(tx*sdx+float32(srcb.Min.X), ty*sdy+float32(srcb.Min.Y), l)
+			off := (y-dst.Rect.Min.Y)*dst.Stride + (x-dst.Rect.Min.X)*4
+			mix.draw(dst, off, c, float32(ma)/0xffff)
+		}
+	}
+}
+
+// wrap maps the tile coordinate x into [0, 1] according to w.
+// It reports false if nothing is drawn at x.
+func wrap(w sprite.Wrap, x float32) (float32, bool) {
+	switch w {
+	case sprite.WrapRepeat:
+		return x - floor(x), true
+	case sprite.WrapMirror:
+		f := floor(x)
+		x -= f
+		if int(f)&1 != 0 {
+			x = 1 - x
+		}
+		return x, true
+	case sprite.WrapNone:
+		return x, 0 <= x && x < 1
+	default:
+		if x < 0 {
+			return 0, true
+		}
+		if x > 1 {
+			return 1, true
+		}
+		return x, true
+	}
+}
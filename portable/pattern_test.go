@@ -0,0 +1,115 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package portable
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"golang.org/x/mobile/f32"
+	"golang.org/x/mobile/geom"
+
+	"github.com/crawshaw/sprite"
+	"github.com/crawshaw/sprite/raster"
+)
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		w    sprite.Wrap
+		x    float32
+		want float32
+		ok   bool
+	}{
+		{sprite.WrapClamp, 0.25, 0.25, true},
+		{sprite.WrapClamp, -0.5, 0, true},
+		{sprite.WrapClamp, 1.5, 1, true},
+		{sprite.WrapRepeat, 1.25, 0.25, true},
+		{sprite.WrapRepeat, -0.25, 0.75, true},
+		{sprite.WrapMirror, 0.25, 0.25, true},
+		{sprite.WrapMirror, 1.25, 0.75, true},
+		{sprite.WrapMirror, -0.25, 0.25, true},
+		{sprite.WrapNone, 0.25, 0.25, true},
+		{sprite.WrapNone, 1.25, 0, false},
+		{sprite.WrapNone, -0.25, 0, false},
+	}
+	for _, test := range tests {
+		got, ok := wrap(test.w, test.x)
+		if ok != test.ok || (ok && got != test.want) {
+			t.Errorf("wrap(%d, %.2f) = %.2f, %v; want %.2f, %v", test.w, test.x, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestPattern(t *testing.T) {
+	geom.PixelsPerPt = 1
+
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	blue := color.RGBA{0, 0, 0xff, 0xff}
+	white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+
+	// Each texel of the tile is drawn onto exactly one dst pixel.
+	tile := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		tile.SetRGBA(0, y, red)
+		tile.SetRGBA(1, y, red)
+		tile.SetRGBA(2, y, blue)
+		tile.SetRGBA(3, y, blue)
+	}
+
+	tests := []struct {
+		wrap sprite.Wrap
+		want [8]color.RGBA // a row of dst
+	}{
+		{sprite.WrapRepeat, [8]color.RGBA{red, red, blue, blue, red, red, blue, blue}},
+		{sprite.WrapMirror, [8]color.RGBA{red, red, blue, blue, blue, blue, red, red}},
+		{sprite.WrapNone, [8]color.RGBA{red, red, blue, blue, white, white, white, white}},
+	}
+
+	for _, test := range tests {
+		dst := image.NewRGBA(image.Rect(0, 0, 8, 8))
+		for i := range dst.Pix {
+			dst.Pix[i] = 0xff
+		}
+		e := Engine(dst)
+		tex, err := e.LoadTexture(tile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := raster.Rectangle{Max: geom.Point{8, 8}}
+		c, err := e.LoadCurve(r.Path())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		n := &sprite.Node{
+			Transform: &f32.Affine{
+				{8, 0, 0},
+				{0, 8, 0},
+			},
+			Curve: c,
+			Pattern: &sprite.Pattern{
+				SubTex: sprite.SubTex{
+					T:     tex,
+					R:     tile.Bounds(),
+					WrapX: test.wrap,
+					WrapY: test.wrap,
+				},
+				Transform: &f32.Affine{
+					{0.5, 0, 0},
+					{0, 0.5, 0},
+				},
+			},
+		}
+		e.Render(n, 0)
+
+		for x, want := range test.want {
+			got := dst.RGBAAt(x, 1)
+			if !colorEq(got, want) {
+				t.Errorf("wrap %d: pixel (%d, 1) = %v, want %v", test.wrap, x, got, want)
+			}
+		}
+	}
+}
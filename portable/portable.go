@@ -10,56 +10,292 @@
 package portable
 
 import (
+	"fmt"
 	"image"
+	"image/color"
 	"image/draw"
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
 
 	"golang.org/x/mobile/f32"
 	"golang.org/x/mobile/geom"
 
 	"github.com/crawshaw/sprite"
 	"github.com/crawshaw/sprite/clock"
+	"github.com/crawshaw/sprite/etc"
+	"github.com/crawshaw/sprite/raster"
 )
 
 // Engine builds a sprite Engine that renders onto dst.
 func Engine(dst *image.RGBA) sprite.Engine {
-	return &engine{
-		dst: dst,
-	}
+	return &engine{dst: dst, area: dst.Bounds()}
+}
+
+// LinearEngine builds a sprite Engine that renders onto dst, mixing
+// colors in linear light rather than as they are encoded in sRGB.
+// It is slower than Engine, but gamma-correct.
+func LinearEngine(dst *image.RGBA) sprite.Engine {
+	return &engine{dst: dst, area: dst.Bounds(), linear: true}
 }
 
 type texture struct {
-	m *image.RGBA
+	// m is the texels, an *image.RGBA, *image.Alpha, *image.Gray or
+	// *image.Paletted. It is nil once unloaded.
+	m          draw.Image
+	palette    [][4]float32                      // of an *image.Paletted, as colorOf
+	rgba       *image.RGBA                       // m converted, built by expand
+	mips       map[image.Rectangle][]image.Image // by SubTex.R, built by mipmaps
+	linearMips map[image.Rectangle][]image.Image
+
+	e  *engine // that loaded it, for its inventory
+	id int     // the order it was loaded in
 }
 
 func (t *texture) Bounds() (w, h int) {
-	b := t.m.Bounds()
+	b := t.loaded().m.Bounds()
 	return b.Dx(), b.Dy()
 }
 
+func (t *texture) Format() sprite.Format {
+	switch t.loaded().m.(type) {
+	case *image.Alpha:
+		return sprite.FormatAlpha
+	case *image.Gray:
+		return sprite.FormatGray
+	case *image.Paletted:
+		return sprite.FormatPaletted
+	}
+	return sprite.FormatRGBA
+}
+
 func (t *texture) Download(r image.Rectangle, dst draw.Image) {
-	draw.Draw(dst, r, t.m, t.m.Bounds().Min, draw.Src)
+	t.loaded()
+	draw.Draw(dst, r.Sub(r.Min).Add(dst.Bounds().Min), t.m, r.Min, draw.Src)
 }
 
 func (t *texture) Upload(r image.Rectangle, src image.Image) {
+	t.loaded()
+	if t.e != nil {
+		// Drawing recorded earlier in the frame reads the texels
+		// as they were.
+		t.e.flush()
+	}
 	draw.Draw(t.m, r, src, src.Bounds().Min, draw.Src)
+	t.rgba, t.mips, t.linearMips = nil, nil, nil
 }
 
-func (t *texture) Unload() { panic("TODO") }
+func (t *texture) Unload() {
+	t.loaded()
+	t.m, t.palette, t.rgba, t.mips, t.linearMips = nil, nil, nil, nil, nil
+	if t.e != nil {
+		delete(t.e.textures, t)
+	}
+}
+
+// loaded returns t, and panics if it has been unloaded.
+func (t *texture) loaded() *texture {
+	if t.m == nil {
+		panic(sprite.ErrUnloaded)
+	}
+	return t
+}
+
+// subImage returns the texels r of t.
+func (t *texture) subImage(r image.Rectangle) image.Image {
+	return t.m.(interface {
+		SubImage(image.Rectangle) image.Image
+	}).SubImage(r)
+}
+
+// expand returns the texels of t as RGBA, for drawing that reads them
+// directly. A texture stored in another format is converted when first
+// needed, and the result kept until Upload.
+func (t *texture) expand() *image.RGBA {
+	if m, ok := t.m.(*image.RGBA); ok {
+		return m
+	}
+	if t.rgba == nil {
+		t.rgba = image.NewRGBA(t.m.Bounds())
+		draw.Draw(t.rgba, t.rgba.Rect, t.m, t.rgba.Rect.Min, draw.Src)
+	}
+	return t.rgba
+}
+
+// cpuBytes returns the memory held by the texels of t, its palette, and
+// any conversions and mipmaps of it.
+func (t *texture) cpuBytes() int {
+	var n int
+	switch m := t.m.(type) {
+	case *image.RGBA:
+		n = len(m.Pix)
+	case *image.Alpha:
+		n = len(m.Pix)
+	case *image.Gray:
+		n = len(m.Pix)
+	case *image.Paletted:
+		n = len(m.Pix) + len(m.Palette)*4 + len(t.palette)*16
+	}
+	if t.rgba != nil {
+		n += len(t.rgba.Pix)
+	}
+	for _, mips := range []map[image.Rectangle][]image.Image{t.mips, t.linearMips} {
+		for _, levels := range mips {
+			for i := 1; i < len(levels); i++ {
+				n += len(levels[i].(*image.RGBA).Pix)
+			}
+		}
+	}
+	return n
+}
 
 type engine struct {
 	dst           *image.RGBA
 	absTransforms []f32.Affine
-}
 
-func (e *engine) LoadTexture(m image.Image) (sprite.Texture, error) {
-	b := m.Bounds()
-	w, h := b.Dx(), b.Dy()
+	// area is the part of the frame that nodes are drawn in, the bounds
+	// of dst unless grow is set. An effect is drawn offscreen, into a
+	// dst that is grown by flush to cover the ops it draws.
+	area image.Rectangle
+	grow bool
+
+	// ops are the drawings of the scene's nodes, in order. They are
+	// recorded by render and done by flush.
+	ops     []drawOp
+	clips   []*clip // of the nodes being rendered, innermost last
+	workers int     // goroutines drawing tiles, if not GOMAXPROCS
+	linear  bool
+
+	textures    map[*texture]bool // loaded and not unloaded
+	lastTexture int               // id of the last texture loaded
 
-	t := &texture{m: image.NewRGBA(image.Rect(0, 0, w, h))}
-	t.Upload(b, m)
+	rasterCache *raster.Cache // coverage of curves
+	sdfCache    *raster.Cache // distance fields of curves
+	curves      raster.Registry
+}
+
+// LoadTexture keeps the texels of an *image.Alpha, *image.Gray or
+// *image.Paletted in that format, which takes a quarter of the memory of
+// RGBA, and those of any other image as RGBA. An *etc.Image is decoded.
+func (e *engine) LoadTexture(src image.Image) (sprite.Texture, error) {
+	if m, ok := src.(*etc.Image); ok {
+		d, err := m.Decode()
+		if err != nil {
+			return nil, err
+		}
+		src = d
+	}
+	b := src.Bounds()
+	r := image.Rect(0, 0, b.Dx(), b.Dy())
+	var m draw.Image
+	switch src := src.(type) {
+	case *image.Alpha:
+		m = image.NewAlpha(r)
+	case *image.Gray:
+		m = image.NewGray(r)
+	case *image.Paletted:
+		m = image.NewPaletted(r, append(color.Palette(nil), src.Palette...))
+	default:
+		m = image.NewRGBA(r)
+	}
+	t := e.newTexture(m)
+	t.Upload(r, src)
 	return t, nil
 }
 
+// newTexture returns a texture of the texels m, in the inventory.
+func (e *engine) newTexture(m draw.Image) *texture {
+	if e.textures == nil {
+		e.textures = make(map[*texture]bool)
+	}
+	e.lastTexture++
+	t := &texture{m: m, palette: paletteOf(m), e: e, id: e.lastTexture}
+	e.textures[t] = true
+	return t
+}
+
+func (e *engine) Inventory() sprite.Inventory {
+	ts := make([]*texture, 0, len(e.textures))
+	for t := range e.textures {
+		ts = append(ts, t)
+	}
+	sort.Sort(byID(ts))
+	var inv sprite.Inventory
+	for _, t := range ts {
+		b := t.m.Bounds()
+		st := sprite.TextureStats{T: t, Width: b.Dx(), Height: b.Dy(), CPUBytes: t.cpuBytes()}
+		inv.Textures = append(inv.Textures, st)
+		inv.CPUBytes += st.CPUBytes
+	}
+	return inv
+}
+
+type byID []*texture
+
+func (ts byID) Len() int           { return len(ts) }
+func (ts byID) Less(i, j int) bool { return ts[i].id < ts[j].id }
+func (ts byID) Swap(i, j int)      { ts[i], ts[j] = ts[j], ts[i] }
+
+func (e *engine) LoadCurve(path []geom.Pt) (sprite.Curve, error) {
+	id, err := e.curves.Load(raster.Path(path))
+	if err != nil {
+		return 0, err
+	}
+	if e.rasterCache == nil {
+		// As in glsprite, the destination size is a proxy for a
+		// sensible amount of memory to spend on curves.
+		// Coverage is kept in alpha pages, and tinted as it is
+		// drawn. Distance fields need all four channels.
+		b := e.area
+		e.rasterCache = &raster.Cache{
+			NewPage: func() draw.Image {
+				return image.NewAlpha(image.Rect(0, 0, b.Dx(), b.Dy()))
+			},
+			MaxPages: 4,
+		}
+		e.sdfCache = &raster.Cache{
+			NewPage: func() draw.Image {
+				return image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+			},
+			MaxPages: 4,
+		}
+	}
+	return id, nil
+}
+
+func (e *engine) UnloadCurve(c sprite.Curve) {
+	if e.curves.Unload(c) && e.rasterCache != nil {
+		// The space of the curve may be reused in this frame, so
+		// drawing recorded from it is done first. After Release
+		// there is no cache to remove it from.
+		e.flush()
+		e.rasterCache.Remove(c)
+		e.sdfCache.Remove(c)
+	}
+}
+
+func (e *engine) Release() error {
+	e.rasterCache = nil
+	e.sdfCache = nil
+	err := e.curves.Close()
+	if inv := e.Inventory(); len(inv.Textures) > 0 {
+		leaked := make([]string, len(inv.Textures))
+		for i, st := range inv.Textures {
+			leaked[i] = fmt.Sprintf("%dx%d", st.Width, st.Height)
+			st.T.Unload()
+		}
+		terr := fmt.Errorf("portable: %d textures not unloaded: %v", len(leaked), leaked)
+		if err == nil {
+			err = terr
+		} else {
+			err = fmt.Errorf("%v; %v", err, terr)
+		}
+	}
+	return err
+}
+
 func (e *engine) Render(scene *sprite.Node, t clock.Time) {
 	// Affine transforms are done in geom.Pt. When finally drawing
 	// the geom.Pt onto an image.Image we need to convert to system
@@ -68,7 +304,9 @@ func (e *engine) Render(scene *sprite.Node, t clock.Time) {
 		{geom.PixelsPerPt, 0, 0},
 		{0, geom.PixelsPerPt, 0},
 	})
+	e.area = e.dst.Bounds()
 	e.render(scene, t)
+	e.flush()
 }
 
 func (e *engine) render(n *sprite.Node, t clock.Time) {
@@ -83,7 +321,33 @@ func (e *engine) render(n *sprite.Node, t clock.Time) {
 		e.absTransforms = append(e.absTransforms, m)
 	}
 
+	if n.Clip != nil {
+		e.clips = append(e.clips, e.newClip(n.Clip, &m, t))
+	}
+
+	if len(n.Effects) > 0 {
+		e.renderEffects(n, m, t)
+	} else {
+		e.renderContent(n, m, t)
+	}
+
+	if n.Clip != nil {
+		e.clips = e.clips[:len(e.clips)-1]
+	}
+	if n.Transform != nil {
+		e.absTransforms = e.absTransforms[:len(e.absTransforms)-1]
+	}
+}
+
+// renderContent records the drawing of n, whose transform to dst pixels
+// is m, and of its children.
+func (e *engine) renderContent(n *sprite.Node, m f32.Affine, t clock.Time) {
+	// The fast paths only composite source over, in sRGB.
+	mix := mixer{n.Blend, e.linear}
+	fast := mix == mixer{}
+
 	if x := n.SubTex; x.T != nil {
+		m := m
 		// Affine transforms work in geom.Pt, which is entirely
 		// independent of the number of pixels in a texture. A texture
 		// of any image.Rectangle bounds rendered with
@@ -98,15 +362,289 @@ func (e *engine) render(n *sprite.Node, t clock.Time) {
 		if dx > 0 && dy > 0 {
 			m.Scale(&m, 1/float32(dx), 1/float32(dy))
 			m.Inverse(&m) // See the documentation on the affine function.
-			affine(e.dst, x.T.(*texture).m, x.R, nil, &m, draw.Over)
+			t := x.T.(*texture).loaded()
+			if f := n.DistanceField; f != nil {
+				src := t.expand()
+				e.addOp(&m, dx, dy, func(dst *image.RGBA, a *f32.Affine) {
+					distanceField(dst, src, x.R, f, f.Spread, f.Multi, mix, a)
+				})
+			} else if fast && t.Format() == sprite.FormatRGBA && x.Filter == sprite.FilterBilinear && x.WrapX == sprite.WrapClamp && x.WrapY == sprite.WrapClamp {
+				// The common case, which affine does quickest.
+				// Clamping to R keeps neighbors in an atlas
+				// from bleeding in.
+				src := t.subImage(x.R)
+				e.addOp(&m, dx, dy, func(dst *image.RGBA, a *f32.Affine) {
+					affine(dst, src, x.R, nil, a, draw.Over)
+				})
+			} else {
+				s := newSampler(t, x, e.linear)
+				e.addOp(&m, dx, dy, func(dst *image.RGBA, a *f32.Affine) {
+					sampleAffine(dst, s, mix, a)
+				})
+			}
+		}
+	}
+
+	if n.Curve != 0 && n.DistanceField != nil {
+		// The distance field has a margin around the curve, so that
+		// outlines and glows can be drawn outside it.
+		// A curve the cache cannot hold, as when it is full of curves
+		// drawn at time t, is left out of the frame.
+		page, b, err := e.sdfCache.GetSDF(n.Curve, e.curves.Path(n.Curve), t)
+		pad := e.sdfCache.Spread
+		dx, dy := b.Dx()-2*pad, b.Dy()-2*pad
+		if err == nil && dx > 0 && dy > 0 {
+			m.Scale(&m, 1/float32(dx), 1/float32(dy))
+			m.Translate(&m, -float32(pad), -float32(pad))
+			m.Inverse(&m)
+			src, f := e.sdfCache.Pages[page].(*image.RGBA), n.DistanceField
+			e.addOp(&m, b.Dx(), b.Dy(), func(dst *image.RGBA, a *f32.Affine) {
+				distanceField(dst, src, b, f, float32(pad), true, mix, a)
+			})
+		}
+	} else if n.Curve != 0 {
+		// A curve is rasterized into the cache at about the size it is
+		// drawn, and then drawn like a SubTex of the cache. As with
+		// distance fields, one the cache cannot hold is left out.
+		path := e.curves.Path(n.Curve)
+		page, b, err := e.rasterCache.Get(n.Curve, path, raster.UnitScale(path, &m), t)
+		dx, dy := b.Dx(), b.Dy()
+		if err == nil && dx > 0 && dy > 0 {
+			if p := n.Pattern; p != nil && p.SubTex.T != nil {
+				m.Inverse(&m)
+				mask := e.rasterCache.Pages[page]
+				s := newSampler(p.SubTex.T.(*texture).loaded(), p.SubTex, e.linear)
+				e.addOp(&m, 1, 1, func(dst *image.RGBA, a *f32.Affine) {
+					pattern(dst, mask, b, p, s, mix, a)
+				})
+			} else {
+				// The coverage is a mask over a source of the
+				// node's color, both of the size of the curve.
+				fill := n.Color
+				if fill == nil {
+					fill = color.Black
+				}
+				mask := e.rasterCache.Pages[page].(*image.Alpha).SubImage(b).(*image.Alpha)
+				m.Scale(&m, 1/float32(dx), 1/float32(dy))
+				m.Inverse(&m)
+				if fast {
+					src := image.NewUniform(fill)
+					e.addOp(&m, dx, dy, func(dst *image.RGBA, a *f32.Affine) {
+						affine(dst, src, image.Rect(0, 0, dx, dy), mask, a, draw.Over)
+					})
+				} else {
+					c := colorOf(fill, e.linear)
+					e.addOp(&m, dx, dy, func(dst *image.RGBA, a *f32.Affine) {
+						fillMask(dst, c, mask, mix, a)
+					})
+				}
+			}
 		}
 	}
 
 	for c := n.FirstChild; c != nil; c = c.NextSibling {
 		e.render(c, t)
 	}
+}
 
-	if n.Transform != nil {
-		e.absTransforms = e.absTransforms[:len(e.absTransforms)-1]
+func (e *engine) RenderTexture(dst sprite.Texture, r image.Rectangle, scene *sprite.Node, m *f32.Affine, t clock.Time) (sprite.SubTex, error) {
+	if r.Empty() {
+		return sprite.SubTex{}, fmt.Errorf("portable: cannot render into empty rectangle %v", r)
+	}
+	if dst == nil {
+		b := image.Rect(0, 0, r.Max.X, r.Max.Y)
+		if !r.In(b) {
+			return sprite.SubTex{}, fmt.Errorf("portable: rectangle %v is outside texture %v", r, b)
+		}
+		dst = e.newTexture(image.NewRGBA(b))
+	}
+	tex, ok := dst.(*texture)
+	if !ok {
+		return sprite.SubTex{}, fmt.Errorf("portable: cannot render into %T, a texture of another engine", dst)
+	}
+	if tex.m == nil {
+		return sprite.SubTex{}, sprite.ErrUnloaded
+	}
+	if !r.In(tex.m.Bounds()) {
+		return sprite.SubTex{}, fmt.Errorf("portable: rectangle %v is outside texture %v", r, tex.m.Bounds())
+	}
+	if m == nil {
+		m = &f32.Affine{
+			{geom.PixelsPerPt, 0, 0},
+			{0, geom.PixelsPerPt, 0},
+		}
+	}
+
+	// The scene is drawn as Render draws it, into an image that then
+	// replaces r of the texture. An Arranger may call RenderTexture
+	// while Render is drawing, so the frame's state is put aside. What
+	// the frame recorded is drawn first, as the scene may be drawn at
+	// another time, evicting curves from the caches that it reads.
+	e.flush()
+	img := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	frameDst, frameArea, frameGrow := e.dst, e.area, e.grow
+	frameTransforms, frameOps, frameClips := e.absTransforms, e.ops, e.clips
+	e.dst, e.area, e.grow = img, img.Bounds(), false
+	e.absTransforms, e.ops, e.clips = []f32.Affine{*m}, nil, nil
+	e.render(scene, t)
+	e.flush()
+	e.dst, e.area, e.grow = frameDst, frameArea, frameGrow
+	e.absTransforms, e.ops, e.clips = frameTransforms, frameOps, frameClips
+
+	tex.Upload(r, img)
+	return sprite.SubTex{T: tex, R: r}, nil
+}
+
+// A drawOp draws a node, or the part of it within dst. As with the
+// affine function, a maps dst pixels to the node's source image.
+type drawOp struct {
+	a    f32.Affine
+	b    image.Rectangle // the pixels of e.dst drawn
+	mask *image.Alpha    // the clip of the pixels, if any
+	draw func(dst *image.RGBA, a *f32.Affine)
+}
+
+// addOp records the drawing of a node whose source is w by h, mapped
+// onto dst by the inverse of a, within the current clip.
+func (e *engine) addOp(a *f32.Affine, w, h int, draw func(dst *image.RGBA, a *f32.Affine)) {
+	b := dstBounds(e.area, a, float32(w), float32(h))
+	var mask *image.Alpha
+	if len(e.clips) > 0 {
+		c := e.clips[len(e.clips)-1]
+		b = b.Intersect(c.r)
+		mask = c.mask
+	}
+	if b.Empty() {
+		return
+	}
+	e.ops = append(e.ops, drawOp{*a, b, mask, draw})
+}
+
+// dstBounds returns the pixels of dst whose centers may be drawn from
+// the source rectangle (0, 0)-(w, h), where a maps pixels of dst,
+// relative to its top-left, to the source.
+func dstBounds(dst image.Rectangle, a *f32.Affine, w, h float32) image.Rectangle {
+	var inv f32.Affine
+	inv.Inverse(a)
+	minX, minY := float32(math.Inf(1)), float32(math.Inf(1))
+	maxX, maxY := float32(math.Inf(-1)), float32(math.Inf(-1))
+	for _, p := range [4][2]float32{{0, 0}, {w, 0}, {0, h}, {w, h}} {
+		x := inv[0][0]*p[0] + inv[0][1]*p[1] + inv[0][2]
+		y := inv[1][0]*p[0] + inv[1][1]*p[1] + inv[1][2]
+		minX, maxX = min32(minX, x), max32(maxX, x)
+		minY, maxY = min32(minY, y), max32(maxY, y)
+	}
+	if !(minX <= maxX && minY <= maxY) {
+		// A degenerate transform, with NaNs.
+		return image.Rectangle{}
+	}
+	// Rounding outwards by an extra pixel keeps the pixels that
+	// float32 error might otherwise lose.
+	r := image.Rect(
+		int(math.Floor(float64(minX)))-1,
+		int(math.Floor(float64(minY)))-1,
+		int(math.Ceil(float64(maxX)))+1,
+		int(math.Ceil(float64(maxY)))+1,
+	)
+	return r.Add(dst.Min).Intersect(dst)
+}
+
+func min32(x, y float32) float32 {
+	if x < y {
+		return x
+	}
+	return y
+}
+
+func max32(x, y float32) float32 {
+	if x > y {
+		return x
+	}
+	return y
+}
+
+// tileSize is the width and height of the tiles that flush draws
+// concurrently.
+const tileSize = 64
+
+// flush does the recorded drawing. The frame is split into tiles, which
+// are drawn by a pool of goroutines. Every tile draws the nodes that
+// touch it in order, so the result does not depend on the scheduling.
+func (e *engine) flush() {
+	if len(e.ops) > 0 {
+		if e.grow {
+			e.growDst()
+		}
+		b := e.dst.Bounds()
+		var tiles []image.Rectangle
+		for y := b.Min.Y; y < b.Max.Y; y += tileSize {
+			for x := b.Min.X; x < b.Max.X; x += tileSize {
+				tiles = append(tiles, image.Rect(x, y, x+tileSize, y+tileSize).Intersect(b))
+			}
+		}
+		workers := e.workers
+		if workers <= 0 {
+			workers = runtime.GOMAXPROCS(0)
+		}
+		if workers > len(tiles) {
+			workers = len(tiles)
+		}
+		next := int32(-1)
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					t := int(atomic.AddInt32(&next, 1))
+					if t >= len(tiles) {
+						return
+					}
+					e.drawTile(tiles[t])
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	// Drop the references to sources until the next frame.
+	for i := range e.ops {
+		e.ops[i] = drawOp{}
+	}
+	e.ops = e.ops[:0]
+}
+
+// growDst grows dst to cover the ops, keeping what it holds.
+func (e *engine) growDst() {
+	b := e.dst.Rect
+	for i := range e.ops {
+		b = b.Union(e.ops[i].b)
+	}
+	if b == e.dst.Rect {
+		return
+	}
+	m := image.NewRGBA(b)
+	draw.Draw(m, e.dst.Rect, e.dst, e.dst.Rect.Min, draw.Src)
+	e.dst = m
+}
+
+func (e *engine) drawTile(tile image.Rectangle) {
+	// The ops are relative to the area, of which dst may be part.
+	origin := e.area.Min
+	for i := range e.ops {
+		op := &e.ops[i]
+		r := tile.Intersect(op.b)
+		if r.Empty() {
+			continue
+		}
+		// The drawing functions work relative to the top-left of
+		// their dst, here the part of the tile the node covers.
+		a := op.a
+		a.Translate(&a, float32(r.Min.X-origin.X), float32(r.Min.Y-origin.Y))
+		if op.mask != nil {
+			drawClipped(e.dst, r, op, &a)
+			continue
+		}
+		op.draw(e.dst.SubImage(r).(*image.RGBA), &a)
 	}
 }
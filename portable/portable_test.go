@@ -0,0 +1,607 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package portable
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"reflect"
+	"testing"
+
+	"golang.org/x/mobile/f32"
+	"golang.org/x/mobile/geom"
+
+	"github.com/crawshaw/sprite"
+	"github.com/crawshaw/sprite/clock"
+	"github.com/crawshaw/sprite/etc"
+	"github.com/crawshaw/sprite/raster"
+)
+
+func TestCurveColor(t *testing.T) {
+	geom.PixelsPerPt = 1
+
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	blue := color.RGBA{0, 0, 0xff, 0xff}
+	white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+	black := color.RGBA{0, 0, 0, 0xff}
+
+	dst := image.NewRGBA(image.Rect(0, 0, 96, 32))
+	for i := range dst.Pix {
+		dst.Pix[i] = 0xff
+	}
+	e := Engine(dst)
+	r := raster.Rectangle{Max: geom.Point{16, 16}}
+	c, err := e.LoadCurve(r.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// One cached curve is drawn in many colors.
+	scene := new(sprite.Node)
+	for i, fill := range []color.Color{red, blue, nil} {
+		scene.AppendChild(&sprite.Node{
+			Transform: &f32.Affine{
+				{16, 0, float32(8 + 32*i)},
+				{0, 16, 8},
+			},
+			Curve: c,
+			Color: fill,
+		})
+	}
+	e.Render(scene, 0)
+
+	tests := []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{16, 16, red},
+		{8, 8, red},
+		{48, 16, blue},
+		{80, 16, black},
+		{4, 16, white},
+		{28, 28, white},
+	}
+	for _, test := range tests {
+		if got := dst.RGBAAt(test.x, test.y); !colorEq(got, test.want) {
+			t.Errorf("pixel (%d, %d) = %v, want %v", test.x, test.y, got, test.want)
+		}
+	}
+	if n := e.(*engine).rasterCache.Stats().Entries; n != 1 {
+		t.Errorf("%d cache entries, want 1", n)
+	}
+}
+
+func TestUnloadCurve(t *testing.T) {
+	geom.PixelsPerPt = 1
+	e := Engine(image.NewRGBA(image.Rect(0, 0, 32, 32)))
+	r := raster.Rectangle{Max: geom.Point{16, 16}}
+	c1, _ := e.LoadCurve(r.Path())
+	c2, _ := e.LoadCurve(r.Path())
+	if c1 != c2 {
+		t.Fatalf("the same path loaded as %d and %d", c1, c2)
+	}
+	e.Render(&sprite.Node{Curve: c1, Transform: &f32.Affine{{16, 0, 0}, {0, 16, 0}}}, 0)
+	cache := e.(*engine).rasterCache
+
+	e.UnloadCurve(c1)
+	if n := cache.Stats().Entries; n != 1 {
+		t.Errorf("%d cache entries while the curve is loaded, want 1", n)
+	}
+	if err := e.Release(); err == nil {
+		t.Error("Release did not report the loaded curve")
+	}
+	// A leaked curve may still be unloaded after Release.
+	e.UnloadCurve(c2)
+
+	e = Engine(image.NewRGBA(image.Rect(0, 0, 32, 32)))
+	c, _ := e.LoadCurve(r.Path())
+	e.Render(&sprite.Node{Curve: c, Transform: &f32.Affine{{16, 0, 0}, {0, 16, 0}}}, 0)
+	cache = e.(*engine).rasterCache
+	e.UnloadCurve(c)
+	if n := cache.Stats().Entries; n != 0 {
+		t.Errorf("%d cache entries after unloading, want 0", n)
+	}
+	if err := e.Release(); err != nil {
+		t.Errorf("Release: %v", err)
+	}
+}
+
+func TestCurveCacheFull(t *testing.T) {
+	geom.PixelsPerPt = 1
+	dst := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	e := Engine(dst)
+
+	// Each curve fills a page of the cache, which has four.
+	scene := new(sprite.Node)
+	var last *sprite.Node
+	for i := 0; i < 5; i++ {
+		r := raster.Rectangle{Min: geom.Point{geom.Pt(i), 0}, Max: geom.Point{geom.Pt(16 + i), 16}}
+		c, err := e.LoadCurve(r.Path())
+		if err != nil {
+			t.Fatal(err)
+		}
+		last = &sprite.Node{Curve: c, Transform: &f32.Affine{{16, 0, 0}, {0, 16, 0}}}
+		scene.AppendChild(last)
+	}
+
+	// The last curve does not fit, and is left out.
+	e.Render(scene, 0)
+	if n := e.(*engine).rasterCache.Stats().Entries; n != 4 {
+		t.Errorf("%d cache entries, want 4", n)
+	}
+
+	// In the next frame, the space of the others is reused.
+	scene.RemoveChild(last)
+	for i := range dst.Pix {
+		dst.Pix[i] = 0
+	}
+	e.Render(last, 1)
+	if got := dst.RGBAAt(8, 8); got != (color.RGBA{0, 0, 0, 0xff}) {
+		t.Errorf("pixel (8, 8) = %v, want black", got)
+	}
+}
+
+// testScene returns a scene of n overlapping, rotated, translucent
+// sprites and curves on a w by h dst.
+func testScene(e sprite.Engine, n, w, h int) (*sprite.Node, error) {
+	m := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			m.SetRGBA(x, y, color.RGBA{uint8(x * 8), uint8(y * 8), 0x40, 0xc0})
+		}
+	}
+	tex, err := e.LoadTexture(m)
+	if err != nil {
+		return nil, err
+	}
+	c, err := e.LoadCurve((&raster.Circle{Center: geom.Point{8, 8}, Radius: 8}).Path())
+	if err != nil {
+		return nil, err
+	}
+	scene := new(sprite.Node)
+	for i := 0; i < n; i++ {
+		var a f32.Affine
+		a.Identity()
+		a.Translate(&a, float32(i*37%w), float32(i*53%h))
+		a.Rotate(&a, float32(i)*0.3)
+		a.Scale(&a, float32(20+i%5*10), float32(20+i%7*10))
+		node := &sprite.Node{Transform: &a}
+		if i%2 == 0 {
+			node.SubTex = sprite.SubTex{T: tex, R: m.Bounds()}
+		} else {
+			node.Curve = c
+			node.Color = color.RGBA{0, 0x40, 0x80, 0x80}
+		}
+		scene.AppendChild(node)
+	}
+	return scene, nil
+}
+
+func TestTiledRender(t *testing.T) {
+	geom.PixelsPerPt = 1
+	const w, h = 200, 150
+	var want *image.RGBA
+	for _, workers := range []int{1, 3, 8} {
+		dst := image.NewRGBA(image.Rect(0, 0, w, h))
+		e := Engine(dst)
+		e.(*engine).workers = workers
+		scene, err := testScene(e, 40, w, h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.Render(scene, 0)
+		if want == nil {
+			want = dst
+			continue
+		}
+		if !reflect.DeepEqual(dst.Pix, want.Pix) {
+			t.Errorf("%d workers drew a different frame than one", workers)
+		}
+	}
+}
+
+func TestRenderBounds(t *testing.T) {
+	geom.PixelsPerPt = 1
+	src := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	draw.Draw(src, src.Bounds(), image.NewUniform(color.RGBA{0xff, 0, 0, 0xff}), image.Point{}, draw.Src)
+
+	// Drawing only the node's bounds, a tile at a time, is the same as
+	// drawing the whole dst, including for a dst not at the origin.
+	var m f32.Affine
+	m.Identity()
+	m.Translate(&m, 30, 10)
+	m.Rotate(&m, 0.7)
+	m.Scale(&m, 40, 25)
+
+	want := image.NewRGBA(image.Rect(10, 20, 150, 120))
+	a := m
+	a.Scale(&a, 1.0/16, 1.0/16)
+	a.Inverse(&a)
+	affine(want, src, src.Bounds(), nil, &a, draw.Over)
+
+	got := image.NewRGBA(want.Bounds())
+	e := Engine(got)
+	tex, _ := e.LoadTexture(src)
+	e.Render(&sprite.Node{Transform: &m, SubTex: sprite.SubTex{T: tex, R: src.Bounds()}}, 0)
+	if !imageEq(got, want) {
+		t.Error("tiled drawing differs from drawing the whole dst")
+	}
+
+	if b := dstBounds(want.Bounds(), &a, 16, 16); b.Dx() >= want.Bounds().Dx() && b.Dy() >= want.Bounds().Dy() {
+		t.Errorf("dstBounds = %v, the whole dst", b)
+	}
+}
+
+func benchmarkRender(b *testing.B, workers int) {
+	geom.PixelsPerPt = 1
+	const w, h = 512, 512
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	e := Engine(dst)
+	e.(*engine).workers = workers
+	scene, err := testScene(e, 200, w, h)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e.Render(scene, 0)
+	}
+}
+
+func BenchmarkRenderSerial(b *testing.B)   { benchmarkRender(b, 1) }
+func BenchmarkRenderParallel(b *testing.B) { benchmarkRender(b, 0) }
+
+// thumbnail is an Arranger that renders scene into a texture and draws
+// it as its node's SubTex.
+type thumbnail struct {
+	scene *sprite.Node
+	m     f32.Affine
+	err   error
+}
+
+func (a *thumbnail) Arrange(e sprite.Engine, n *sprite.Node, t clock.Time) {
+	n.SubTex, a.err = e.RenderTexture(n.SubTex.T, image.Rect(0, 0, 4, 4), a.scene, &a.m, t)
+}
+
+func TestRenderTexture(t *testing.T) {
+	geom.PixelsPerPt = 1
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	blue := color.RGBA{0, 0, 0xff, 0xff}
+	white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+
+	dst := image.NewRGBA(image.Rect(0, 0, 16, 8))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(white), image.Point{}, draw.Src)
+	e := Engine(dst)
+	r := raster.Rectangle{Max: geom.Point{1, 1}}
+	c, err := e.LoadCurve(r.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.UnloadCurve(c)
+
+	// A red square in the left half of a 4x4 texture.
+	square := &sprite.Node{
+		Transform: &f32.Affine{{2, 0, 0}, {0, 4, 0}},
+		Curve:     c,
+		Color:     red,
+	}
+	x, err := e.RenderTexture(nil, image.Rect(0, 0, 4, 4), square, &f32.Affine{{1, 0, 0}, {0, 1, 0}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.R != image.Rect(0, 0, 4, 4) {
+		t.Errorf("R = %v, want 4x4", x.R)
+	}
+	got := image.NewRGBA(x.R)
+	x.T.Download(x.R, got)
+	if c := got.RGBAAt(0, 2); !colorEq(c, red) {
+		t.Errorf("texture (0, 2) = %v, want red", c)
+	}
+	if c := got.RGBAAt(3, 2); c != (color.RGBA{}) {
+		t.Errorf("texture (3, 2) = %v, want transparent", c)
+	}
+
+	// Rendering into part of an existing texture replaces only that
+	// part. The scene is scaled by m.
+	big := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	draw.Draw(big, big.Bounds(), image.NewUniform(blue), image.Point{}, draw.Src)
+	tex, err := e.LoadTexture(big)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.RenderTexture(tex, image.Rect(4, 4, 8, 8), square, &f32.Affine{{0.5, 0, 0}, {0, 0.5, 0}}, 0); err != nil {
+		t.Fatal(err)
+	}
+	tex.Download(big.Bounds(), big)
+	for _, tc := range []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{0, 0, blue},
+		{7, 3, blue},
+		{4, 4, red},
+		{4, 5, red},
+		{5, 4, color.RGBA{}},
+		{4, 6, color.RGBA{}},
+	} {
+		if c := big.RGBAAt(tc.x, tc.y); !colorEq(c, tc.want) {
+			t.Errorf("texture (%d, %d) = %v, want %v", tc.x, tc.y, c, tc.want)
+		}
+	}
+
+	if _, err := e.RenderTexture(tex, image.Rect(4, 4, 12, 12), square, nil, 0); err == nil {
+		t.Error("rendering outside the texture succeeded")
+	}
+	if _, err := e.RenderTexture(nil, image.Rectangle{}, square, nil, 0); err == nil {
+		t.Error("rendering into an empty rectangle succeeded")
+	}
+	if _, err := e.RenderTexture(nil, image.Rect(-1, 0, 4, 4), square, nil, 0); err == nil {
+		t.Error("rendering into a new texture at a negative offset succeeded")
+	}
+	if n := len(e.Inventory().Textures); n != 2 {
+		t.Errorf("%d textures loaded, want 2", n)
+	}
+
+	// An Arranger can render a texture while the frame is drawn,
+	// without disturbing the frame.
+	arr := &thumbnail{scene: square, m: f32.Affine{{1, 0, 0}, {0, 1, 0}}}
+	scene := new(sprite.Node)
+	scene.AppendChild(&sprite.Node{
+		Transform: &f32.Affine{{8, 0, 0}, {0, 8, 0}},
+		Curve:     c,
+		Color:     blue,
+	})
+	scene.AppendChild(&sprite.Node{
+		Transform: &f32.Affine{{8, 0, 8}, {0, 8, 0}},
+		Arranger:  arr,
+	})
+	e.Render(scene, 0)
+	if arr.err != nil {
+		t.Fatal(arr.err)
+	}
+	for _, tc := range []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{2, 4, blue},
+		{9, 4, red},
+		{14, 4, white},
+	} {
+		if c := dst.RGBAAt(tc.x, tc.y); !colorEq(c, tc.want) {
+			t.Errorf("dst (%d, %d) = %v, want %v", tc.x, tc.y, c, tc.want)
+		}
+	}
+}
+
+// uploader is an Arranger that uploads src into its node's SubTex.
+type uploader struct {
+	src image.Image
+}
+
+func (a *uploader) Arrange(e sprite.Engine, n *sprite.Node, t clock.Time) {
+	n.SubTex.T.Upload(a.src.Bounds(), a.src)
+}
+
+func TestUploadDuringFrame(t *testing.T) {
+	geom.PixelsPerPt = 1
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	blue := color.RGBA{0, 0, 0xff, 0xff}
+
+	dst := image.NewRGBA(image.Rect(0, 0, 8, 4))
+	e := Engine(dst)
+	m := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	m.SetRGBA(0, 0, red)
+	tex, err := e.LoadTexture(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tex.Unload()
+	m = image.NewRGBA(image.Rect(0, 0, 1, 1))
+	m.SetRGBA(0, 0, blue)
+
+	// The first node is drawn with the texels it had when it was
+	// reached, not those the second node uploads.
+	x := sprite.SubTex{T: tex, R: image.Rect(0, 0, 1, 1)}
+	scene := new(sprite.Node)
+	scene.AppendChild(&sprite.Node{
+		Transform: &f32.Affine{{4, 0, 0}, {0, 4, 0}},
+		SubTex:    x,
+	})
+	scene.AppendChild(&sprite.Node{
+		Transform: &f32.Affine{{4, 0, 4}, {0, 4, 0}},
+		SubTex:    x,
+		Arranger:  &uploader{m},
+	})
+	e.Render(scene, 0)
+	if c := dst.RGBAAt(1, 1); c != red {
+		t.Errorf("dst (1, 1) = %v, want red", c)
+	}
+	if c := dst.RGBAAt(6, 1); c != blue {
+		t.Errorf("dst (6, 1) = %v, want blue", c)
+	}
+}
+
+// unloaded reports whether f panics with sprite.ErrUnloaded.
+func unloaded(f func()) (ok bool) {
+	defer func() {
+		ok = recover() == sprite.ErrUnloaded
+	}()
+	f()
+	return false
+}
+
+func TestTextureLifecycle(t *testing.T) {
+	geom.PixelsPerPt = 1
+	e := Engine(image.NewRGBA(image.Rect(0, 0, 8, 8)))
+	src := image.NewRGBA(image.Rect(2, 2, 6, 4))
+	src.SetRGBA(3, 2, color.RGBA{0xff, 0, 0, 0xff})
+	a, err := e.LoadTexture(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := e.LoadTexture(image.NewRGBA(image.Rect(0, 0, 8, 8)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w, h := a.Bounds(); w != 4 || h != 2 {
+		t.Errorf("Bounds = %d, %d, want 4, 2", w, h)
+	}
+
+	// Download copies a part of the texture to the top-left of dst.
+	got := image.NewRGBA(image.Rect(10, 10, 12, 11))
+	a.Download(image.Rect(1, 0, 3, 1), got)
+	if c := got.RGBAAt(10, 10); c != (color.RGBA{0xff, 0, 0, 0xff}) {
+		t.Errorf("downloaded %v, want red", c)
+	}
+
+	// Drawing b scaled down builds its mipmaps, which count.
+	e.Render(&sprite.Node{
+		Transform: &f32.Affine{{2, 0, 0}, {0, 2, 0}},
+		SubTex:    sprite.SubTex{T: b, R: image.Rect(0, 0, 8, 8), Filter: sprite.FilterTrilinear},
+	}, 0)
+	inv := e.Inventory()
+	if len(inv.Textures) != 2 || inv.Textures[0].T != a || inv.Textures[1].T != b {
+		t.Fatalf("inventory %+v, want a and b", inv.Textures)
+	}
+	if st := inv.Textures[0]; st.Width != 4 || st.Height != 2 || st.CPUBytes != 4*2*4 {
+		t.Errorf("a: %+v", st)
+	}
+	mips := (8*8 + 4*4 + 2*2 + 1) * 4
+	if st := inv.Textures[1]; st.CPUBytes != mips {
+		t.Errorf("b: %d bytes, want %d", st.CPUBytes, mips)
+	}
+	if inv.CPUBytes != 4*2*4+mips || inv.GPUBytes != 0 {
+		t.Errorf("total %d, %d bytes", inv.CPUBytes, inv.GPUBytes)
+	}
+
+	a.Unload()
+	if inv := e.Inventory(); len(inv.Textures) != 1 || inv.Textures[0].T != b {
+		t.Errorf("inventory after Unload %+v, want b", inv.Textures)
+	}
+	uses := map[string]func(){
+		"Bounds":   func() { a.Bounds() },
+		"Download": func() { a.Download(image.Rect(0, 0, 1, 1), got) },
+		"Upload":   func() { a.Upload(image.Rect(0, 0, 1, 1), src) },
+		"Unload":   func() { a.Unload() },
+		"Render": func() {
+			e.Render(&sprite.Node{SubTex: sprite.SubTex{T: a, R: image.Rect(0, 0, 4, 2)}}, 0)
+		},
+	}
+	for name, f := range uses {
+		if !unloaded(f) {
+			t.Errorf("%s after Unload did not panic with ErrUnloaded", name)
+		}
+	}
+	if _, err := e.RenderTexture(a, image.Rect(0, 0, 1, 1), new(sprite.Node), nil, 0); err != sprite.ErrUnloaded {
+		t.Errorf("RenderTexture after Unload: %v, want ErrUnloaded", err)
+	}
+
+	// A texture made by RenderTexture is loaded too, and Release
+	// reports and unloads the textures left.
+	x, err := e.RenderTexture(nil, image.Rect(0, 0, 2, 2), new(sprite.Node), nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(e.Inventory().Textures); n != 2 {
+		t.Errorf("%d textures after RenderTexture, want 2", n)
+	}
+	if err := e.Release(); err == nil {
+		t.Error("Release did not report the loaded textures")
+	}
+	if !unloaded(func() { x.T.Bounds() }) {
+		t.Error("texture usable after Release")
+	}
+	if err := e.Release(); err != nil {
+		t.Errorf("second Release: %v", err)
+	}
+}
+
+func TestTextureFormats(t *testing.T) {
+	gray := image.NewGray(image.Rect(0, 0, 2, 2))
+	for i := range gray.Pix {
+		gray.Pix[i] = 0x40
+	}
+	alpha := image.NewAlpha(image.Rect(0, 0, 2, 2))
+	for i := range alpha.Pix {
+		alpha.Pix[i] = 0x80
+	}
+	paletted := image.NewPaletted(image.Rect(0, 0, 2, 2), color.Palette{
+		color.Transparent,
+		color.NRGBA{0, 0, 0xff, 0x80},
+	})
+	for i := range paletted.Pix {
+		paletted.Pix[i] = 1
+	}
+	// An ETC1 block of red less 2, by index 2 of the first table.
+	block := []byte{0xff, 0, 0, 0, 0xff, 0xff, 0, 0}
+	compressed := &etc.Image{Format: sprite.FormatETC1, Rect: image.Rect(0, 0, 4, 4), Pix: block}
+
+	black := color.RGBA{0, 0, 0, 0xff}
+	tests := []struct {
+		name   string
+		src    image.Image
+		format sprite.Format
+		bytes  int
+		want   color.RGBA
+	}{
+		{"gray", gray, sprite.FormatGray, 4, color.RGBA{0x40, 0x40, 0x40, 0xff}},
+		{"alpha", alpha, sprite.FormatAlpha, 4, color.RGBA{0x80, 0x80, 0x80, 0xff}},
+		{"paletted", paletted, sprite.FormatPaletted, 4 + 2*4 + 2*16, color.RGBA{0, 0, 0x80, 0xff}},
+		{"etc", compressed, sprite.FormatRGBA, 4 * 4 * 4, color.RGBA{0xfd, 0, 0, 0xff}},
+	}
+	for _, tc := range tests {
+		e := Engine(image.NewRGBA(image.Rect(0, 0, 1, 1)))
+		tex, err := e.LoadTexture(tc.src)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if f := tex.Format(); f != tc.format {
+			t.Errorf("%s: format %d, want %d", tc.name, f, tc.format)
+		}
+		if n := e.Inventory().CPUBytes; n != tc.bytes {
+			t.Errorf("%s: %d bytes, want %d", tc.name, n, tc.bytes)
+		}
+		checkRow(t, tc.name, drawRow(t, func(dst *image.RGBA) sprite.Engine {
+			e.(*engine).dst = dst
+			return e
+		}, tc.src, black, 4), []color.RGBA{tc.want, tc.want, tc.want, tc.want})
+
+		// Filters other than bilinear read the format too.
+		for _, f := range []sprite.Filter{sprite.FilterNearest, sprite.FilterTrilinear} {
+			dst := image.NewRGBA(image.Rect(0, 0, 1, 1))
+			draw.Draw(dst, dst.Bounds(), image.NewUniform(black), image.Point{}, draw.Src)
+			e.(*engine).dst = dst
+			b := tc.src.Bounds()
+			e.Render(&sprite.Node{
+				Transform: &f32.Affine{{1, 0, 0}, {0, 1, 0}},
+				SubTex:    sprite.SubTex{T: tex, R: image.Rect(0, 0, b.Dx(), b.Dy()), Filter: f},
+			}, 0)
+			checkRow(t, fmt.Sprintf("%s, filter %d", tc.name, f), dst, []color.RGBA{tc.want})
+		}
+	}
+
+	// Uploading converts to the format of the texture.
+	e := Engine(image.NewRGBA(image.Rect(0, 0, 1, 1)))
+	tex, err := e.LoadTexture(alpha)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	src.SetRGBA(0, 0, color.RGBA{0x20, 0, 0, 0x20})
+	tex.Upload(image.Rect(1, 1, 2, 2), src)
+	got := image.NewAlpha(image.Rect(0, 0, 2, 2))
+	tex.Download(got.Bounds(), got)
+	if a := got.AlphaAt(1, 1).A; a != 0x20 {
+		t.Errorf("uploaded alpha %#x, want 0x20", a)
+	}
+
+	compressed.Pix = block[:7]
+	if _, err := e.LoadTexture(compressed); err == nil {
+		t.Error("loading short ETC data succeeded")
+	}
+}
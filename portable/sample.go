@@ -0,0 +1,330 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package portable
+
+import (
+	"image"
+	"math"
+
+	"golang.org/x/mobile/f32"
+
+	"github.com/crawshaw/sprite"
+)
+
+// A sampler reads the texels of a SubTex with its filter and wrap
+// modes. Colors are premultiplied, with channels in [0, 255], and in
+// linear light if linear is set.
+type sampler struct {
+	levels  []image.Image // the texture, then the mipmaps of r if trilinear
+	palette [][4]float32  // of the texture, if paletted
+	r       image.Rectangle
+	filter  sprite.Filter
+	wrapX   sprite.Wrap
+	wrapY   sprite.Wrap
+	linear  bool
+}
+
+func newSampler(t *texture, x sprite.SubTex, linear bool) *sampler {
+	s := &sampler{
+		levels:  []image.Image{t.m},
+		palette: t.palette,
+		r:       x.R,
+		filter:  x.Filter,
+		wrapX:   x.WrapX,
+		wrapY:   x.WrapY,
+		linear:  linear,
+	}
+	if x.Filter == sprite.FilterTrilinear {
+		s.levels = t.mipmaps(x.R, linear)
+	}
+	return s
+}
+
+// mipmaps returns the texture and the chain of mipmaps of its texels
+// r, each half the size of the last, down to 1x1, averaged in linear
+// light if linear is set. Each SubTex of an atlas has its own chain, so
+// that its neighbors do not bleed into it. The mipmaps have their
+// origin at r.Min. They are built when first needed and dropped by
+// Upload. The mipmaps are RGBA, whatever the format of the texture.
+func (t *texture) mipmaps(r image.Rectangle, linear bool) []image.Image {
+	mips := &t.mips
+	if linear {
+		mips = &t.linearMips
+	}
+	if *mips == nil {
+		*mips = make(map[image.Rectangle][]image.Image)
+	}
+	levels := (*mips)[r]
+	if levels == nil {
+		levels = []image.Image{t.m}
+		m := t.subImage(r)
+		for b := m.Bounds(); b.Dx() > 1 || b.Dy() > 1; b = m.Bounds() {
+			m = halve(m, linear)
+			levels = append(levels, m)
+		}
+		(*mips)[r] = levels
+	}
+	return levels
+}
+
+// halve returns m scaled down by half, each texel the average of the
+// 2x2 texels of m it covers. An odd last row or column is averaged
+// with itself.
+func halve(m image.Image, linear bool) *image.RGBA {
+	rgba, _ := m.(*image.RGBA)
+	palette := paletteOf(m)
+	b := m.Bounds()
+	w, h := (b.Dx()+1)/2, (b.Dy()+1)/2
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0 := b.Min.Y + 2*y
+		y1 := y0 + 1
+		if y1 >= b.Max.Y {
+			y1 = y0
+		}
+		for x := 0; x < w; x++ {
+			x0 := b.Min.X + 2*x
+			x1 := x0 + 1
+			if x1 >= b.Max.X {
+				x1 = x0
+			}
+			off := dst.PixOffset(x, y)
+			if rgba != nil && !linear {
+				o00, o01 := rgba.PixOffset(x0, y0), rgba.PixOffset(x1, y0)
+				o10, o11 := rgba.PixOffset(x0, y1), rgba.PixOffset(x1, y1)
+				for k := 0; k < 4; k++ {
+					sum := uint32(rgba.Pix[o00+k]) + uint32(rgba.Pix[o01+k]) + uint32(rgba.Pix[o10+k]) + uint32(rgba.Pix[o11+k])
+					dst.Pix[off+k] = uint8((sum + 2) / 4)
+				}
+				continue
+			}
+			var c [4]float32
+			for _, p := range [4]image.Point{{x0, y0}, {x1, y0}, {x0, y1}, {x1, y1}} {
+				t := texelOf(m, palette, p.X, p.Y)
+				if linear {
+					t = decode(t)
+				}
+				for k := range c {
+					c[k] += t[k] / 4
+				}
+			}
+			if linear {
+				c = encode(c)
+			}
+			for k := range c {
+				dst.Pix[off+k] = round8(c[k])
+			}
+		}
+	}
+	return dst
+}
+
+// paletteOf returns the colors of the palette of m, as colorOf, if m is
+// paletted.
+func paletteOf(m image.Image) [][4]float32 {
+	p, ok := m.(*image.Paletted)
+	if !ok {
+		return nil
+	}
+	colors := make([][4]float32, len(p.Palette))
+	for i, c := range p.Palette {
+		colors[i] = colorOf(c, false)
+	}
+	return colors
+}
+
+// texelOf returns the color of the texel (x, y) of m, premultiplied,
+// with channels in [0, 255]. The palette is the colors of m as returned
+// by paletteOf.
+func texelOf(m image.Image, palette [][4]float32, x, y int) [4]float32 {
+	switch m := m.(type) {
+	case *image.RGBA:
+		return pixel(m, m.PixOffset(x, y))
+	case *image.Alpha:
+		// Alpha textures are white.
+		a := float32(m.Pix[m.PixOffset(x, y)])
+		return [4]float32{a, a, a, a}
+	case *image.Gray:
+		v := float32(m.Pix[m.PixOffset(x, y)])
+		return [4]float32{v, v, v, 255}
+	case *image.Paletted:
+		if i := int(m.Pix[m.PixOffset(x, y)]); i < len(palette) {
+			return palette[i]
+		}
+		return [4]float32{}
+	}
+	return colorOf(m.At(x, y), false)
+}
+
+// wrapTexel maps the texel index i into [min, max) according to w. It
+// reports false if the texel is empty.
+func wrapTexel(w sprite.Wrap, i, min, max int) (int, bool) {
+	if min <= i && i < max {
+		return i, true
+	}
+	n := max - min
+	switch w {
+	case sprite.WrapRepeat:
+		i = (i - min) % n
+		if i < 0 {
+			i += n
+		}
+		return min + i, true
+	case sprite.WrapMirror:
+		i = (i - min) % (2 * n)
+		if i < 0 {
+			i += 2 * n
+		}
+		if i >= n {
+			i = 2*n - 1 - i
+		}
+		return min + i, true
+	case sprite.WrapNone:
+		return 0, false
+	default:
+		if i < min {
+			return min, true
+		}
+		return max - 1, true
+	}
+}
+
+// texel returns the texel (x, y) of level l, where r is the texels of
+// the SubTex in the level.
+func (s *sampler) texel(l int, r image.Rectangle, x, y int) (c [4]float32) {
+	x, okx := wrapTexel(s.wrapX, x, r.Min.X, r.Max.X)
+	y, oky := wrapTexel(s.wrapY, y, r.Min.Y, r.Max.Y)
+	if !okx || !oky {
+		return c
+	}
+	c = texelOf(s.levels[l], s.palette, x, y)
+	if s.linear {
+		c = decode(c)
+	}
+	return c
+}
+
+// at returns the color at (x, y) of the texture. lod is the base 2 log
+// of the number of texels covered by a pixel, used to choose mipmaps.
+func (s *sampler) at(x, y, lod float32) [4]float32 {
+	switch s.filter {
+	case sprite.FilterNearest:
+		return s.texel(0, s.r, int(floor(x)), int(floor(y)))
+	case sprite.FilterBicubic:
+		return s.bicubic(x, y)
+	case sprite.FilterTrilinear:
+		last := float32(len(s.levels) - 1)
+		if lod > last {
+			lod = last
+		}
+		if lod <= 0 {
+			return s.bilinear(0, x, y)
+		}
+		l := floor(lod)
+		c := s.bilinear(int(l), x, y)
+		if f := lod - l; f > 0 {
+			c1 := s.bilinear(int(l)+1, x, y)
+			for k := range c {
+				c[k] += (c1[k] - c[k]) * f
+			}
+		}
+		return c
+	default:
+		return s.bilinear(0, x, y)
+	}
+}
+
+// bilinear returns the color at (x, y), in texture coordinates,
+// interpolated from the texels of level l.
+func (s *sampler) bilinear(l int, x, y float32) (c [4]float32) {
+	// Mipmaps hold only the SubTex, from their origin.
+	r := s.r
+	if l > 0 {
+		r = s.levels[l].Bounds()
+	}
+	scale := 1 / float32(int(1)<<uint(l))
+	x = (x-float32(s.r.Min.X))*scale + float32(r.Min.X) - 0.5
+	y = (y-float32(s.r.Min.Y))*scale + float32(r.Min.Y) - 0.5
+	x0, y0 := floor(x), floor(y)
+	fx, fy := x-x0, y-y0
+	ix, iy := int(x0), int(y0)
+	c00 := s.texel(l, r, ix, iy)
+	c01 := s.texel(l, r, ix+1, iy)
+	c10 := s.texel(l, r, ix, iy+1)
+	c11 := s.texel(l, r, ix+1, iy+1)
+	for k := range c {
+		top := c00[k] + (c01[k]-c00[k])*fx
+		bot := c10[k] + (c11[k]-c10[k])*fx
+		c[k] = top + (bot-top)*fy
+	}
+	return c
+}
+
+// bicubic returns the color at (x, y) on the Catmull-Rom spline
+// through the nearest 4x4 texels. The spline overshoots at sharp edges,
+// so the result is clamped to a valid premultiplied color.
+func (s *sampler) bicubic(x, y float32) (c [4]float32) {
+	x, y = x-0.5, y-0.5
+	x0, y0 := floor(x), floor(y)
+	wx, wy := catmullRom(x-x0), catmullRom(y-y0)
+	ix, iy := int(x0)-1, int(y0)-1
+	for j := 0; j < 4; j++ {
+		var row [4]float32
+		for i := 0; i < 4; i++ {
+			t := s.texel(0, s.r, ix+i, iy+j)
+			for k := range row {
+				row[k] += t[k] * wx[i]
+			}
+		}
+		for k := range c {
+			c[k] += row[k] * wy[j]
+		}
+	}
+	c[3] = clampf(c[3], 0, 255)
+	for k := 0; k < 3; k++ {
+		c[k] = clampf(c[k], 0, c[3])
+	}
+	return c
+}
+
+// catmullRom returns the weights of the four texels around a sample at
+// t in [0, 1) between the middle two.
+func catmullRom(t float32) [4]float32 {
+	t2, t3 := t*t, t*t*t
+	return [4]float32{
+		(-t3 + 2*t2 - t) / 2,
+		(3*t3 - 5*t2 + 2) / 2,
+		(-3*t3 + 4*t2 + t) / 2,
+		(t3 - t2) / 2,
+	}
+}
+
+// lod returns the base 2 log of the number of texels along the longer
+// side of the area that a, mapping dst pixels to texels, samples for
+// each pixel.
+func lod(a *f32.Affine) float32 {
+	dx := a[0][0]*a[0][0] + a[1][0]*a[1][0]
+	dy := a[0][1]*a[0][1] + a[1][1]*a[1][1]
+	return float32(math.Log2(float64(max32(dx, dy))) / 2)
+}
+
+// sampleAffine draws the SubTex read by s onto dst with mix, as affine
+// does, where a maps dst pixels to texels relative to s.r.Min.
+func sampleAffine(dst *image.RGBA, s *sampler, mix mixer, a *f32.Affine) {
+	b := dst.Bounds()
+	l := lod(a)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			ix, iy := pt(a, x-b.Min.X, y-b.Min.Y)
+			sx := ix + float32(s.r.Min.X)
+			sy := iy + float32(s.r.Min.Y)
+			if !inBounds(s.r, sx, sy) {
+				continue
+			}
+			off := (y-dst.Rect.Min.Y)*dst.Stride + (x-dst.Rect.Min.X)*4
+			mix.draw(dst, off, s.at(sx, sy, l), 1)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package portable
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"golang.org/x/mobile/f32"
+	"golang.org/x/mobile/geom"
+
+	"github.com/crawshaw/sprite"
+)
+
+func TestWrapTexel(t *testing.T) {
+	tests := []struct {
+		w    sprite.Wrap
+		i    int
+		want int
+		ok   bool
+	}{
+		{sprite.WrapClamp, 3, 3, true},
+		{sprite.WrapClamp, 0, 2, true},
+		{sprite.WrapClamp, 9, 5, true},
+		{sprite.WrapRepeat, 1, 5, true},
+		{sprite.WrapRepeat, 6, 2, true},
+		{sprite.WrapRepeat, -3, 5, true},
+		{sprite.WrapMirror, 1, 2, true},
+		{sprite.WrapMirror, 0, 3, true},
+		{sprite.WrapMirror, 6, 5, true},
+		{sprite.WrapMirror, 7, 4, true},
+		{sprite.WrapMirror, 11, 3, true},
+		{sprite.WrapNone, 1, 0, false},
+		{sprite.WrapNone, 4, 4, true},
+	}
+	for _, tc := range tests {
+		got, ok := wrapTexel(tc.w, tc.i, 2, 6)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("wrapTexel(%d, %d, 2, 6) = %d, %v, want %d, %v", tc.w, tc.i, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestHalve(t *testing.T) {
+	m := image.NewRGBA(image.Rect(0, 0, 3, 1))
+	copy(m.Pix, []uint8{
+		0, 0, 0, 0,
+		200, 100, 40, 255,
+		80, 80, 80, 80,
+	})
+	got := halve(m, false)
+	if b := got.Bounds(); b != image.Rect(0, 0, 2, 1) {
+		t.Fatalf("bounds %v, want 2x1", b)
+	}
+	want := []uint8{
+		100, 50, 20, 128,
+		80, 80, 80, 80,
+	}
+	for i := range want {
+		if got.Pix[i] != want[i] {
+			t.Fatalf("Pix = %v, want %v", got.Pix, want)
+		}
+	}
+
+	tex := &texture{m: image.NewRGBA(image.Rect(0, 0, 5, 3))}
+	if n := len(tex.mipmaps(tex.m.Bounds(), false)); n != 4 {
+		t.Errorf("5x3 texture has %d levels, want 4", n)
+	}
+	tex.Upload(image.Rect(0, 0, 1, 1), m)
+	if tex.mips != nil {
+		t.Error("Upload kept stale mipmaps")
+	}
+}
+
+// checker returns an n by n checkerboard of black and white texels,
+// with a border of red texels around it.
+func checker(n int) (*image.RGBA, image.Rectangle) {
+	m := image.NewRGBA(image.Rect(0, 0, n+2, n+2))
+	draw.Draw(m, m.Bounds(), image.NewUniform(color.RGBA{0xff, 0, 0, 0xff}), image.Point{}, draw.Src)
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			c := color.RGBA{0, 0, 0, 0xff}
+			if (x+y)%2 == 0 {
+				c = color.RGBA{0xff, 0xff, 0xff, 0xff}
+			}
+			m.SetRGBA(x+1, y+1, c)
+		}
+	}
+	return m, image.Rect(1, 1, n+1, n+1)
+}
+
+// renderFilter draws r of src with filter f and wrap w into a new
+// size by size dst.
+func renderFilter(t *testing.T, src image.Image, r image.Rectangle, f sprite.Filter, w sprite.Wrap, size int) *image.RGBA {
+	geom.PixelsPerPt = 1
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	e := Engine(dst)
+	tex, err := e.LoadTexture(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Render(&sprite.Node{
+		Transform: &f32.Affine{
+			{float32(size), 0, 0},
+			{0, float32(size), 0},
+		},
+		SubTex: sprite.SubTex{T: tex, R: r, Filter: f, WrapX: w, WrapY: w},
+	}, 0)
+	return dst
+}
+
+func TestFilterNearest(t *testing.T) {
+	src, r := checker(4)
+	dst := renderFilter(t, src, r, sprite.FilterNearest, sprite.WrapClamp, 32)
+
+	// Every pixel is exactly black or white, even at the edges
+	// between texels.
+	for i := 0; i < len(dst.Pix); i += 4 {
+		if p := dst.Pix[i]; p != 0 && p != 0xff {
+			t.Fatalf("pixel %d is %d, want 0 or 255", i/4, p)
+		}
+	}
+	if got := dst.RGBAAt(7, 7); got.R != 0xff {
+		t.Errorf("(7, 7) = %v, want white", got)
+	}
+	if got := dst.RGBAAt(8, 7); got.R != 0 {
+		t.Errorf("(8, 7) = %v, want black", got)
+	}
+}
+
+func TestFilterClampToSubTex(t *testing.T) {
+	// The red border outside R must not bleed into any edge, with any
+	// filter.
+	src, r := checker(4)
+	for _, f := range []sprite.Filter{sprite.FilterBilinear, sprite.FilterNearest, sprite.FilterBicubic, sprite.FilterTrilinear} {
+		dst := renderFilter(t, src, r, f, sprite.WrapClamp, 32)
+		for i := 0; i < len(dst.Pix); i += 4 {
+			if r, g := int(dst.Pix[i]), int(dst.Pix[i+1]); r > g+1 {
+				t.Errorf("filter %d: pixel %d is %v, red bled in", f, i/4, dst.Pix[i:i+4])
+				break
+			}
+		}
+	}
+}
+
+func TestFilterWrapRepeat(t *testing.T) {
+	// Magnified, the top edge of a tile is interpolated towards the
+	// texels above it. Clamped, they are the top row, so (12, 0) is
+	// nearly black. Repeated, they are the bottom row, which is
+	// nearly white there.
+	src, r := checker(4)
+	clamped := renderFilter(t, src, r, sprite.FilterBilinear, sprite.WrapClamp, 32)
+	if got := clamped.RGBAAt(12, 0); got.R > 0x40 {
+		t.Errorf("clamped top edge = %v, want nearly black", got)
+	}
+	repeated := renderFilter(t, src, r, sprite.FilterBilinear, sprite.WrapRepeat, 32)
+	if got := repeated.RGBAAt(12, 0); got.R < 0x60 {
+		t.Errorf("repeated top edge = %v, want blended with the bottom row", got)
+	}
+}
+
+func TestFilterBicubic(t *testing.T) {
+	// A flat texture is reproduced exactly.
+	src := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	gray := color.RGBA{0x40, 0x50, 0x60, 0x80}
+	draw.Draw(src, src.Bounds(), image.NewUniform(gray), image.Point{}, draw.Src)
+	dst := renderFilter(t, src, src.Bounds(), sprite.FilterBicubic, sprite.WrapClamp, 13)
+	for y := 0; y < 13; y++ {
+		for x := 0; x < 13; x++ {
+			if got := dst.RGBAAt(x, y); got != gray {
+				t.Fatalf("(%d, %d) = %v, want %v", x, y, got, gray)
+			}
+		}
+	}
+
+	// Overshoot at a sharp edge stays a valid premultiplied color.
+	edge := image.NewRGBA(image.Rect(0, 0, 4, 1))
+	copy(edge.Pix, []uint8{0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	dst = renderFilter(t, edge, edge.Bounds(), sprite.FilterBicubic, sprite.WrapClamp, 16)
+	for i := 0; i < len(dst.Pix); i += 4 {
+		if a := dst.Pix[i+3]; dst.Pix[i] > a || dst.Pix[i+1] > a || dst.Pix[i+2] > a {
+			t.Fatalf("pixel %d is %v, not premultiplied", i/4, dst.Pix[i:i+4])
+		}
+	}
+}
+
+func TestFilterTrilinear(t *testing.T) {
+	// A fine checkerboard drawn at a sixth of its size averages to gray with
+	// mipmaps. Bilinear sampling instead picks out a few texels.
+	src, r := checker(64)
+	const size = 10
+	tri := renderFilter(t, src, r, sprite.FilterTrilinear, sprite.WrapClamp, size)
+	bil := renderFilter(t, src, r, sprite.FilterBilinear, sprite.WrapClamp, size)
+	var spreadTri, spreadBil int
+	for i := 0; i < len(tri.Pix); i += 4 {
+		spreadTri += abs(int(tri.Pix[i+1]) - 0x80)
+		spreadBil += abs(int(bil.Pix[i+1]) - 0x80)
+	}
+	if n := size * size; spreadTri > 8*n {
+		t.Errorf("trilinear is %d from gray on average, want under 8", spreadTri/n)
+	}
+	if spreadBil <= spreadTri {
+		t.Errorf("bilinear (%d) is no further from gray than trilinear (%d)", spreadBil, spreadTri)
+	}
+
+	// The mipmaps of the SubTex hold none of the red border around it,
+	// even where the pattern repeats.
+	for _, w := range []sprite.Wrap{sprite.WrapClamp, sprite.WrapRepeat} {
+		small := renderFilter(t, src, r, sprite.FilterTrilinear, w, 3)
+		for i := 0; i < len(small.Pix); i += 4 {
+			if d := int(small.Pix[i]) - int(small.Pix[i+1]); d > 4 {
+				t.Fatalf("wrap %d: pixel %d is %v, tinted by the border", w, i/4, small.Pix[i:i+4])
+			}
+		}
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
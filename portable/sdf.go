@@ -0,0 +1,115 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package portable
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"golang.org/x/mobile/f32"
+
+	"github.com/crawshaw/sprite"
+)
+
+// distanceField draws the distance field in srcb of src onto dst, as
+// described by f. As with the affine function, a maps dst pixels to
+// src pixels relative to srcb.Min. The field records distances up to
+// spread texels, in red, green and blue if multi is set, otherwise in
+// alpha. Colors are composited by mix.
+func distanceField(dst, src *image.RGBA, srcb image.Rectangle, f *sprite.DistanceField, spread float32, multi bool, mix mixer, a *f32.Affine) {
+	if srcb.Empty() {
+		return
+	}
+	// Distances in the field are in texels. Coverage of a dst pixel
+	// needs them in dst pixels, so divide by the texels per pixel.
+	scale := float32(math.Sqrt(math.Abs(float64(a[0][0]*a[1][1] - a[0][1]*a[1][0]))))
+	if scale == 0 {
+		return
+	}
+	fill := colorOf(color.Black, mix.linear)
+	if f.Color != nil {
+		fill = colorOf(f.Color, mix.linear)
+	}
+	var glow, outline [4]float32
+	if f.GlowColor != nil {
+		glow = colorOf(f.GlowColor, mix.linear)
+	}
+	if f.OutlineColor != nil {
+		outline = colorOf(f.OutlineColor, mix.linear)
+	}
+
+	b := dst.Bounds()
+	minX, minY := float32(srcb.Min.X)+0.5, float32(srcb.Min.Y)+0.5
+	maxX, maxY := float32(srcb.Max.X)-0.5, float32(srcb.Max.Y)-0.5
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			ix, iy := pt(a, x-b.Min.X, y-b.Min.Y)
+			sx := clampf(ix+float32(srcb.Min.X), minX, maxX)
+			sy := clampf(iy+float32(srcb.Min.Y), minY, maxY)
+			d := (sampleDistance(src, srcb, sx, sy, multi) - 0.5) * 2 * spread
+
+			off := (y-dst.Rect.Min.Y)*dst.Stride + (x-dst.Rect.Min.X)*4
+			if f.Glow > 0 && f.GlowColor != nil {
+				g := clampf(1+(d+f.Outline)/f.Glow, 0, 1)
+				mix.draw(dst, off, glow, g*g)
+			}
+			if f.Outline > 0 && f.OutlineColor != nil {
+				mix.draw(dst, off, outline, coverage(d+f.Outline, scale))
+			}
+			mix.draw(dst, off, fill, coverage(d, scale))
+		}
+	}
+}
+
+// coverage returns the fraction of a dst pixel inside an edge d texels
+// away, where there are scale texels per pixel.
+func coverage(d, scale float32) float32 {
+	return clampf(0.5+d/scale, 0, 1)
+}
+
+// sampleDistance returns the encoded distance at (x, y) in src,
+// interpolated between texel centers.
+func sampleDistance(src *image.RGBA, srcb image.Rectangle, x, y float32, multi bool) float32 {
+	p := findLinearSrc(srcb, x, y)
+	off00 := src.PixOffset(p.low.X, p.low.Y)
+	off01 := src.PixOffset(p.high.X, p.low.Y)
+	off10 := src.PixOffset(p.low.X, p.high.Y)
+	off11 := src.PixOffset(p.high.X, p.high.Y)
+	channel := func(c int) float32 {
+		v := float32(src.Pix[off00+c]) * p.frac00
+		v += float32(src.Pix[off01+c]) * p.frac01
+		v += float32(src.Pix[off10+c]) * p.frac10
+		v += float32(src.Pix[off11+c]) * p.frac11
+		return v / 0xff
+	}
+	if !multi {
+		return channel(3)
+	}
+	return median(channel(0), channel(1), channel(2))
+}
+
+func median(a, b, c float32) float32 {
+	if a > b {
+		a, b = b, a
+	}
+	if b > c {
+		b = c
+	}
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func clampf(x, min, max float32) float32 {
+	if x < min {
+		return min
+	}
+	if x > max {
+		return max
+	}
+	return x
+}
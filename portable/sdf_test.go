@@ -0,0 +1,123 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package portable
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"golang.org/x/mobile/f32"
+	"golang.org/x/mobile/geom"
+
+	"github.com/crawshaw/sprite"
+	"github.com/crawshaw/sprite/raster"
+)
+
+func TestMedian(t *testing.T) {
+	for _, v := range [][3]float32{{1, 2, 3}, {1, 3, 2}, {2, 1, 3}, {2, 3, 1}, {3, 1, 2}, {3, 2, 1}} {
+		if got := median(v[0], v[1], v[2]); got != 2 {
+			t.Errorf("median%v = %v, want 2", v, got)
+		}
+	}
+}
+
+func TestDistanceFieldCurve(t *testing.T) {
+	geom.PixelsPerPt = 1
+
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	blue := color.RGBA{0, 0, 0xff, 0xff}
+	white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+
+	dst := image.NewRGBA(image.Rect(0, 0, 96, 96))
+	for i := range dst.Pix {
+		dst.Pix[i] = 0xff
+	}
+	e := Engine(dst)
+	r := raster.Rectangle{Max: geom.Point{8, 8}}
+	c, err := e.LoadCurve(r.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An 8x8 curve scaled up 8 times stays sharp.
+	n := &sprite.Node{
+		Transform: &f32.Affine{
+			{64, 0, 16},
+			{0, 64, 16},
+		},
+		Curve: c,
+		DistanceField: &sprite.DistanceField{
+			Color:        red,
+			Outline:      1,
+			OutlineColor: blue,
+		},
+	}
+	e.Render(n, 0)
+
+	tests := []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{48, 48, red},
+		{16, 48, red},   // just inside the edge
+		{15, 48, blue},  // just outside the edge
+		{9, 48, blue},   // the outline is one texel, 8 pixels, wide
+		{6, 48, white},  // outside the outline
+		{48, 79, red},   // just inside the bottom edge
+		{48, 80, blue},  // just outside the bottom edge
+		{48, 90, white}, // far outside
+	}
+	for _, test := range tests {
+		if got := dst.RGBAAt(test.x, test.y); !colorEq(got, test.want) {
+			t.Errorf("pixel (%d, %d) = %v, want %v", test.x, test.y, got, test.want)
+		}
+	}
+}
+
+func TestDistanceFieldSubTex(t *testing.T) {
+	geom.PixelsPerPt = 1
+
+	// A field for a disc of radius 4 texels, centered in 16x16.
+	field := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			dx, dy := float32(x)+0.5-8, float32(y)+0.5-8
+			d := 4 - float32(sqrt(dx*dx+dy*dy))
+			v := uint8(clampf(0.5+d/8, 0, 1)*255 + 0.5)
+			field.SetRGBA(x, y, color.RGBA{0, 0, 0, v})
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	e := Engine(dst)
+	tex, err := e.LoadTexture(field)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &sprite.Node{
+		Transform:     &f32.Affine{{64, 0, 0}, {0, 64, 0}},
+		SubTex:        sprite.SubTex{T: tex, R: field.Bounds()},
+		DistanceField: &sprite.DistanceField{Spread: 4, Color: color.White},
+	}
+	e.Render(n, 0)
+
+	// The disc has radius 16 pixels, centered at (32, 32).
+	for _, p := range []image.Point{{32, 32}, {32, 17}, {46, 32}} {
+		if got := dst.RGBAAt(p.X, p.Y); got.A != 0xff {
+			t.Errorf("pixel %v = %v, want opaque", p, got)
+		}
+	}
+	for _, p := range []image.Point{{32, 14}, {50, 32}, {2, 2}} {
+		if got := dst.RGBAAt(p.X, p.Y); got.A != 0 {
+			t.Errorf("pixel %v = %v, want transparent", p, got)
+		}
+	}
+}
+
+func sqrt(x float32) float32 {
+	return float32(math.Sqrt(float64(x)))
+}
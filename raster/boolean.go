@@ -0,0 +1,438 @@
+package raster
+
+import (
+	"math"
+	"sort"
+
+	"golang.org/x/mobile/geom"
+)
+
+// Boolean operations treat each path as the region it fills under the
+// non-zero winding rule used by Draw, with every curve implicitly
+// closed. Curved segments are first flattened to within a tenth of a
+// pixel, so the result is made only of lines.
+//
+// The result is a set of closed, non-overlapping curves. Outer
+// boundaries and the holes in them run in opposite directions, so the
+// result fills the same region under either fill rule.
+//
+// The operations are quadratic in the number of flattened segments.
+
+// Union returns the outline of the region filled by a or b.
+func Union(a, b Path) Path {
+	return combine(a, b, func(wa, wb int) bool { return wa != 0 || wb != 0 })
+}
+
+// Intersection returns the outline of the region filled by both a and b.
+func Intersection(a, b Path) Path {
+	return combine(a, b, func(wa, wb int) bool { return wa != 0 && wb != 0 })
+}
+
+// Difference returns the outline of the region filled by a but not b.
+func Difference(a, b Path) Path {
+	return combine(a, b, func(wa, wb int) bool { return wa != 0 && wb == 0 })
+}
+
+// Xor returns the outline of the region filled by exactly one of a and b.
+func Xor(a, b Path) Path {
+	return combine(a, b, func(wa, wb int) bool { return (wa != 0) != (wb != 0) })
+}
+
+// Points are snapped to a grid so that vertices shared by edges compare
+// exactly, which makes coincident edges and touching vertices reliable.
+const gridScale = 1024 // grid points per geom.Pt
+
+type gridPt struct{ x, y int64 }
+
+func snap(x, y float64) gridPt {
+	return gridPt{int64(math.Floor(x*gridScale + 0.5)), int64(math.Floor(y*gridScale + 0.5))}
+}
+
+func (p gridPt) f() (float64, float64) {
+	return float64(p.x), float64(p.y)
+}
+
+func (p gridPt) pt() geom.Point {
+	return geom.Point{geom.Pt(float64(p.x) / gridScale), geom.Pt(float64(p.y) / gridScale)}
+}
+
+type gridEdge struct {
+	p, q gridPt
+	src  int // which operand the edge came from
+}
+
+// polygons flattens p into closed polygons on the grid.
+func polygons(p Path) [][]gridPt {
+	tol := geom.Pt(0.1 / geom.PixelsPerPt)
+	var polys [][]gridPt
+	for it := p.Flatten(tol).Iterator(); it.Next(); {
+		s := it.Segment()
+		pt := snap(float64(s.End().X), float64(s.End().Y))
+		if s.Op == OpStart {
+			polys = append(polys, []gridPt{pt})
+			continue
+		}
+		if len(polys) == 0 {
+			polys = append(polys, nil)
+		}
+		poly := polys[len(polys)-1]
+		if len(poly) == 0 || poly[len(poly)-1] != pt {
+			polys[len(polys)-1] = append(poly, pt)
+		}
+	}
+	return polys
+}
+
+func polygonEdges(polys [][]gridPt, src int) []gridEdge {
+	var edges []gridEdge
+	for _, poly := range polys {
+		for i, p := range poly {
+			q := poly[(i+1)%len(poly)]
+			if p != q {
+				edges = append(edges, gridEdge{p, q, src})
+			}
+		}
+	}
+	return edges
+}
+
+// winding returns the winding number of edges around (x, y).
+func winding(edges []gridEdge, x, y float64) int {
+	w := 0
+	for _, e := range edges {
+		w += e.winding(x, y)
+	}
+	return w
+}
+
+// winding returns what e adds to the winding number around (x, y).
+func (e gridEdge) winding(x, y float64) int {
+	px, py := e.p.f()
+	qx, qy := e.q.f()
+	if py <= y {
+		if qy > y && (qx-px)*(y-py)-(x-px)*(qy-py) > 0 {
+			return 1
+		}
+	} else if qy <= y && (qx-px)*(y-py)-(x-px)*(qy-py) < 0 {
+		return -1
+	}
+	return 0
+}
+
+// bands buckets edges by the horizontal bands of equal height they
+// overlap, so that the edges near a height are found without looking
+// at them all. There are as many bands as edges, which keeps each
+// short unless the edges are mostly level or long.
+type bands struct {
+	edges []gridEdge
+	y0, h float64
+	index [][]int // of the edges overlapping each band
+}
+
+func newBands(edges []gridEdge) *bands {
+	b := &bands{edges: edges}
+	if len(edges) == 0 {
+		return b
+	}
+	y0, y1 := math.Inf(1), math.Inf(-1)
+	for _, e := range edges {
+		py, qy := float64(e.p.y), float64(e.q.y)
+		y0, y1 = math.Min(y0, math.Min(py, qy)), math.Max(y1, math.Max(py, qy))
+	}
+	b.y0, b.h = y0, (y1-y0)/float64(len(edges))
+	if b.h == 0 {
+		b.h = 1
+	}
+	b.index = make([][]int, len(edges))
+	for i, e := range edges {
+		lo, hi := b.span(e)
+		for k := lo; k <= hi; k++ {
+			b.index[k] = append(b.index[k], i)
+		}
+	}
+	return b
+}
+
+// band returns the band holding the height y.
+func (b *bands) band(y float64) int {
+	k := int((y - b.y0) / b.h)
+	if k < 0 {
+		return 0
+	}
+	if k >= len(b.index) {
+		return len(b.index) - 1
+	}
+	return k
+}
+
+// span returns the first and last bands e overlaps.
+func (b *bands) span(e gridEdge) (lo, hi int) {
+	lo, hi = b.band(float64(e.p.y)), b.band(float64(e.q.y))
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+	return lo, hi
+}
+
+// winding returns the winding number of the edges around (x, y).
+func (b *bands) winding(x, y float64) int {
+	if len(b.index) == 0 {
+		return 0
+	}
+	w := 0
+	for _, i := range b.index[b.band(y)] {
+		w += b.edges[i].winding(x, y)
+	}
+	return w
+}
+
+// split divides every edge at its intersections with the others,
+// including the ends of collinear overlapping edges.
+func split(edges []gridEdge) []gridEdge {
+	cuts := make([][]gridPt, len(edges))
+	b := newBands(edges)
+	for k, band := range b.index {
+		for n, i := range band {
+			loI, _ := b.span(edges[i])
+			for _, j := range band[n+1:] {
+				// Edges sharing several bands meet in the first.
+				if loJ, _ := b.span(edges[j]); loI == k || loJ == k {
+					intersect(edges[i], edges[j], &cuts[i], &cuts[j])
+				}
+			}
+		}
+	}
+	var out []gridEdge
+	for i, e := range edges {
+		c := cuts[i]
+		sort.Sort(byDistance{e.p, c})
+		prev := e.p
+		for _, pt := range append(c, e.q) {
+			if pt != prev {
+				out = append(out, gridEdge{prev, pt, e.src})
+				prev = pt
+			}
+		}
+	}
+	return out
+}
+
+// byDistance sorts collinear points by their distance from o.
+type byDistance struct {
+	o   gridPt
+	pts []gridPt
+}
+
+func (s byDistance) Len() int      { return len(s.pts) }
+func (s byDistance) Swap(i, j int) { s.pts[i], s.pts[j] = s.pts[j], s.pts[i] }
+func (s byDistance) Less(i, j int) bool {
+	return s.dist2(s.pts[i]) < s.dist2(s.pts[j])
+}
+
+func (s byDistance) dist2(p gridPt) int64 {
+	dx, dy := p.x-s.o.x, p.y-s.o.y
+	return dx*dx + dy*dy
+}
+
+// byPosition sorts points top to bottom, then left to right.
+type byPosition []gridPt
+
+func (s byPosition) Len() int      { return len(s) }
+func (s byPosition) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byPosition) Less(i, j int) bool {
+	return s[i].y < s[j].y || s[i].y == s[j].y && s[i].x < s[j].x
+}
+
+// intersect adds the points where a and b meet to their cut lists.
+func intersect(a, b gridEdge, cutA, cutB *[]gridPt) {
+	ax, ay := a.p.f()
+	bx, by := b.p.f()
+	rx, ry := float64(a.q.x-a.p.x), float64(a.q.y-a.p.y)
+	sx, sy := float64(b.q.x-b.p.x), float64(b.q.y-b.p.y)
+
+	// Quick reject on bounding boxes.
+	if math.Max(ax, ax+rx) < math.Min(bx, bx+sx) || math.Max(bx, bx+sx) < math.Min(ax, ax+rx) ||
+		math.Max(ay, ay+ry) < math.Min(by, by+sy) || math.Max(by, by+sy) < math.Min(ay, ay+ry) {
+		return
+	}
+
+	// onSegment reports whether pt lies strictly inside e, within half
+	// a grid unit of it.
+	onSegment := func(pt gridPt, e gridEdge) bool {
+		x, y := pt.f()
+		ex, ey := e.p.f()
+		dx, dy := float64(e.q.x-e.p.x), float64(e.q.y-e.p.y)
+		l2 := dx*dx + dy*dy
+		t := ((x-ex)*dx + (y-ey)*dy) / l2
+		if t <= 0 || t >= 1 {
+			return false
+		}
+		d := (dx*(y-ey) - dy*(x-ex))
+		return d*d <= l2/4
+	}
+
+	d := rx*sy - ry*sx
+	if d == 0 || math.Abs(d) < 1e-12*(rx*rx+ry*ry+sx*sx+sy*sy) {
+		// Parallel. Collinear overlaps meet at each other's ends.
+		if onSegment(b.p, a) {
+			*cutA = append(*cutA, b.p)
+		}
+		if onSegment(b.q, a) {
+			*cutA = append(*cutA, b.q)
+		}
+		if onSegment(a.p, b) {
+			*cutB = append(*cutB, a.p)
+		}
+		if onSegment(a.q, b) {
+			*cutB = append(*cutB, a.q)
+		}
+		return
+	}
+
+	// An end of one edge touching the other is cut at exactly that end.
+	touched := false
+	for _, pt := range [...]gridPt{b.p, b.q} {
+		if onSegment(pt, a) {
+			*cutA = append(*cutA, pt)
+			touched = true
+		}
+	}
+	for _, pt := range [...]gridPt{a.p, a.q} {
+		if onSegment(pt, b) {
+			*cutB = append(*cutB, pt)
+			touched = true
+		}
+	}
+	if touched {
+		return
+	}
+
+	t := ((bx-ax)*sy - (by-ay)*sx) / d
+	u := ((bx-ax)*ry - (by-ay)*rx) / d
+	if t <= 0 || t >= 1 || u <= 0 || u >= 1 {
+		return
+	}
+	pt := snap((ax+t*rx)/gridScale, (ay+t*ry)/gridScale)
+	*cutA = append(*cutA, pt)
+	*cutB = append(*cutB, pt)
+}
+
+func combine(a, b Path, inside func(wa, wb int) bool) Path {
+	var dst Path
+	for _, loop := range region(a, b, inside) {
+		addLoop(&dst, loop)
+	}
+	return dst
+}
+
+// region returns the closed polygons bounding the points where inside
+// reports true for the winding numbers of a and b around them. The
+// polygons do not cross, and have the region on their left.
+func region(a, b Path, inside func(wa, wb int) bool) [][]gridPt {
+	all := split(append(polygonEdges(polygons(a), 0), polygonEdges(polygons(b), 1)...))
+
+	// Winding numbers are taken about the split edges, so that every
+	// edge tested below lies exactly on an edge of its operand.
+	var edgesA, edgesB []gridEdge
+	for _, e := range all {
+		if e.src == 0 {
+			edgesA = append(edgesA, e)
+		} else {
+			edgesB = append(edgesB, e)
+		}
+	}
+	bandsA, bandsB := newBands(edgesA), newBands(edgesB)
+
+	// Keep each distinct edge once, whichever direction it had, and only
+	// if it separates the inside of the result from the outside. Orient
+	// kept edges so that the inside is on their left.
+	seen := make(map[gridEdge]bool)
+	out := make(map[gridPt][]gridPt)
+	for _, e := range all {
+		k := gridEdge{p: e.p, q: e.q}
+		if k.q.x < k.p.x || k.q.x == k.p.x && k.q.y < k.p.y {
+			k.p, k.q = k.q, k.p
+		}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+
+		px, py := k.p.f()
+		qx, qy := k.q.f()
+		dx, dy := qx-px, qy-py
+		l := math.Hypot(dx, dy)
+		const delta = 0.25 // grid units
+		nx, ny := -dy/l*delta, dx/l*delta
+		mx, my := (px+qx)/2, (py+qy)/2
+		in := func(x, y float64) bool {
+			return inside(bandsA.winding(x, y), bandsB.winding(x, y))
+		}
+		left, right := in(mx+nx, my+ny), in(mx-nx, my-ny)
+		switch {
+		case left && !right:
+			out[k.p] = append(out[k.p], k.q)
+		case right && !left:
+			out[k.q] = append(out[k.q], k.p)
+		}
+	}
+
+	// Chain the edges into closed curves. Every vertex on the boundary
+	// of a region has as many edges leaving as arriving, so walks return
+	// to where they started.
+	starts := make([]gridPt, 0, len(out))
+	for p := range out {
+		starts = append(starts, p)
+	}
+	sort.Sort(byPosition(starts))
+	var loops [][]gridPt
+	for _, start := range starts {
+		for len(out[start]) > 0 {
+			loop := []gridPt{start}
+			for p := start; ; {
+				next := out[p]
+				if len(next) == 0 {
+					break
+				}
+				q := next[len(next)-1]
+				out[p] = next[:len(next)-1]
+				if q == start {
+					break
+				}
+				loop = append(loop, q)
+				p = q
+			}
+			if loop = simplifyLoop(loop); len(loop) >= 3 {
+				loops = append(loops, loop)
+			}
+		}
+	}
+	return loops
+}
+
+// simplifyLoop removes vertices where a closed polygon runs straight on.
+func simplifyLoop(loop []gridPt) []gridPt {
+	for changed := true; changed && len(loop) > 2; {
+		changed = false
+		for i := 0; i < len(loop) && len(loop) > 2; i++ {
+			p := loop[(i+len(loop)-1)%len(loop)]
+			c := loop[i]
+			n := loop[(i+1)%len(loop)]
+			cross := (c.x-p.x)*(n.y-c.y) - (c.y-p.y)*(n.x-c.x)
+			if cross == 0 {
+				loop = append(loop[:i], loop[i+1:]...)
+				changed = true
+				i--
+			}
+		}
+	}
+	return loop
+}
+
+func addLoop(p *Path, loop []gridPt) {
+	p.AddStart(loop[0].pt())
+	for _, g := range loop[1:] {
+		p.AddLine(g.pt())
+	}
+	p.AddLine(loop[0].pt())
+}
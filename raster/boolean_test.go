@@ -0,0 +1,193 @@
+package raster
+
+import (
+	"math"
+	"testing"
+
+	"golang.org/x/mobile/geom"
+)
+
+func mustParse(t *testing.T, d string) Path {
+	p, err := ParseSVGPath(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// area returns the signed area enclosed by the flattened curves of p.
+func area(p Path) float64 {
+	a := 0.0
+	for _, poly := range polygons(p) {
+		for i, g := range poly {
+			h := poly[(i+1)%len(poly)]
+			a += float64(g.x*h.y - h.x*g.y)
+		}
+	}
+	return a / 2 / gridScale / gridScale
+}
+
+// checkRegion compares the region filled by got against want at a grid
+// of sample points chosen to avoid the edges of the test shapes.
+func checkRegion(t *testing.T, name string, got Path, want func(x, y float64) bool) {
+	edges := polygonEdges(polygons(got), 0)
+	bad := 0
+	for y := -10.0; y < 40; y += 0.5 {
+		for x := -10.0; x < 40; x += 0.5 {
+			sx, sy := (x+0.137)*gridScale, (y+0.291)*gridScale
+			w := winding(edges, sx, sy)
+			if w != 0 && w != 1 && w != -1 {
+				t.Errorf("%s: winding %d at (%v, %v), want curves not to overlap", name, w, x, y)
+				return
+			}
+			if (w != 0) != want(x+0.137, y+0.291) {
+				bad++
+			}
+		}
+	}
+	if bad > 0 {
+		t.Errorf("%s: %d sample points wrong, path %s", name, bad, got.SVG())
+	}
+}
+
+func inside(p Path) func(x, y float64) bool {
+	edges := polygonEdges(polygons(p), 0)
+	return func(x, y float64) bool {
+		return winding(edges, x*gridScale, y*gridScale) != 0
+	}
+}
+
+func segments(p Path) int {
+	n := 0
+	for it := p.Iterator(); it.Next(); {
+		n++
+	}
+	return n
+}
+
+func TestBoolean(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		area [4]float64 // union, intersection, difference, xor
+	}{
+		{
+			"overlap",
+			"M0 0 H10 V10 H0 Z", "M5 5 H15 V15 H5 Z",
+			[4]float64{175, 25, 75, 150},
+		},
+		{
+			"shared edge",
+			"M0 0 H10 V10 H0 Z", "M10 0 H20 V10 H10 Z",
+			[4]float64{200, 0, 100, 200},
+		},
+		{
+			"partly shared edge",
+			"M0 0 H10 V10 H0 Z", "M5 10 H15 V20 H5 Z",
+			[4]float64{200, 0, 100, 200},
+		},
+		{
+			"identical",
+			"M0 0 H10 V10 H0 Z", "M0 0 V10 H10 V0 Z",
+			[4]float64{100, 100, 0, 0},
+		},
+		{
+			"contained",
+			"M0 0 H30 V30 H0 Z", "M10 10 H20 V20 H10 Z",
+			[4]float64{900, 100, 800, 800},
+		},
+		{
+			"collinear overlap",
+			"M0 0 H20 V10 H0 Z", "M5 0 H25 V5 H5 Z",
+			[4]float64{225, 75, 125, 150},
+		},
+		{
+			"touching corner",
+			"M0 0 H10 V10 H0 Z", "M10 10 H20 V20 H10 Z",
+			[4]float64{200, 0, 100, 200},
+		},
+		{
+			"empty",
+			"M0 0 H10 V10 H0 Z", "",
+			[4]float64{100, 0, 100, 100},
+		},
+	}
+	ops := []struct {
+		name string
+		f    func(a, b Path) Path
+		in   func(a, b bool) bool
+	}{
+		{"Union", Union, func(a, b bool) bool { return a || b }},
+		{"Intersection", Intersection, func(a, b bool) bool { return a && b }},
+		{"Difference", Difference, func(a, b bool) bool { return a && !b }},
+		{"Xor", Xor, func(a, b bool) bool { return a != b }},
+	}
+	for _, test := range tests {
+		a, b := mustParse(t, test.a), mustParse(t, test.b)
+		ina, inb := inside(a), inside(b)
+		for i, op := range ops {
+			name := test.name + " " + op.name
+			got := op.f(a, b)
+			if a := math.Abs(area(got)); math.Abs(a-test.area[i]) > 1e-3 {
+				t.Errorf("%s: area %v, want %v", name, a, test.area[i])
+			}
+			in := op.in
+			checkRegion(t, name, got, func(x, y float64) bool { return in(ina(x, y), inb(x, y)) })
+		}
+	}
+
+	// Shared edges are merged away.
+	u := Union(mustParse(t, "M0 0 H10 V10 H0 Z"), mustParse(t, "M10 0 H20 V10 H10 Z"))
+	if n := segments(u); n != 5 {
+		t.Errorf("union of adjacent squares has %d segments, want 5: %s", n, u.SVG())
+	}
+}
+
+func TestBooleanSelfIntersecting(t *testing.T) {
+	// A pentagram drawn as one self-intersecting curve. Under the
+	// non-zero rule it includes the pentagon in the middle.
+	var star Path
+	for i := 0; i < 5; i++ {
+		a := -math.Pi/2 + float64(i)*4*math.Pi/5
+		pt := geom.Point{geom.Pt(15 + 15*math.Cos(a)), geom.Pt(15 + 15*math.Sin(a))}
+		if i == 0 {
+			star.AddStart(pt)
+		} else {
+			star.AddLine(pt)
+		}
+	}
+	in := inside(star)
+	simple := Union(star, nil)
+	checkRegion(t, "pentagram", simple, in)
+	if n := segments(simple); n != 11 {
+		t.Errorf("pentagram outline has %d segments, want 11: %s", n, simple.SVG())
+	}
+
+	// A bow tie crossing itself in the middle, cut by a rectangle.
+	bow := mustParse(t, "M0 0 L20 20 V0 L0 20 Z")
+	rect := mustParse(t, "M5 -5 H15 V25 H5 Z")
+	inBow, inRect := inside(bow), inside(rect)
+	checkRegion(t, "bow tie difference", Difference(bow, rect), func(x, y float64) bool {
+		return inBow(x, y) && !inRect(x, y)
+	})
+	checkRegion(t, "bow tie intersection", Intersection(bow, rect), func(x, y float64) bool {
+		return inBow(x, y) && inRect(x, y)
+	})
+
+	// A path covering its region twice is the same as covering it once.
+	double := mustParse(t, "M0 0 H10 V10 H0 Z M0 0 H10 V10 H0 Z")
+	if got := math.Abs(area(Union(double, nil))); math.Abs(got-100) > 1e-3 {
+		t.Errorf("doubled square area %v, want 100", got)
+	}
+}
+
+func TestBooleanCurves(t *testing.T) {
+	geom.PixelsPerPt = 1
+	c := (&Circle{Center: geom.Point{10, 10}, Radius: 10}).Path()
+	r := (&Rectangle{Min: geom.Point{10, -5}, Max: geom.Point{30, 25}}).Path()
+	got := math.Abs(area(Intersection(c, r)))
+	want := math.Abs(area(c)) / 2
+	if math.Abs(got-want) > 0.5 {
+		t.Errorf("half circle area %v, want %v", got, want)
+	}
+}
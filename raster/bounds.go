@@ -1,19 +1,18 @@
 package raster
 
 import (
-	"fmt"
 	"math"
 
 	"golang.org/x/mobile/geom"
 )
 
 func (p Path) Bounds() geom.Rectangle {
+	if len(p) == 0 {
+		return geom.Rectangle{}
+	}
 	r := geom.Rectangle{
 		Min: geom.Point{math.MaxFloat32, math.MaxFloat32},
-		Max: geom.Point{},
-	}
-	if len(p) == 0 {
-		return r
+		Max: geom.Point{-math.MaxFloat32, -math.MaxFloat32},
 	}
 	include := func(p geom.Point) {
 		if p.X < r.Min.X {
@@ -29,34 +28,19 @@ func (p Path) Bounds() geom.Rectangle {
 			r.Max.Y = p.Y
 		}
 	}
-	var start geom.Point
-	for len(p) > 0 {
-		switch p[0] {
-		case 0, 1:
-			end := geom.Point{p[1], p[2]}
-			start = end
-			p = p[3:]
-		case 2:
-			n0 := geom.Point{p[1], p[2]}
-			end := geom.Point{p[3], p[4]}
-			for _, b := range extremitiesQuad(start, n0, end) {
+	for it := p.Iterator(); it.Next(); {
+		s := it.Segment()
+		switch s.Op {
+		case OpQuadratic:
+			for _, b := range extremitiesQuad(s.P[0], s.P[1], s.P[2]) {
 				include(b)
 			}
-			start = end
-			p = p[5:]
-		case 3:
-			n0 := geom.Point{p[1], p[2]}
-			n1 := geom.Point{p[3], p[4]}
-			end := geom.Point{p[5], p[6]}
-			for _, b := range extremitiesCubic(start, n0, n1, end) {
+		case OpCubic:
+			for _, b := range extremitiesCubic(s.P[0], s.P[1], s.P[2], s.P[3]) {
 				include(b)
 			}
-			start = end
-			p = p[7:]
-		default:
-			panic(fmt.Sprintf("raster: unexpected path segment type: %f", p[0]))
 		}
-		include(start)
+		include(s.End())
 	}
 
 	return r
@@ -103,7 +87,14 @@ func extremitiesQuad(n0, n1, n2 geom.Point) (b [2]geom.Point) {
 	return b
 }
 
-func extremitiesCubic(n0, n1, n2, n3 geom.Point) [6]geom.Point {
+func extremitiesCubic(n0, n1, n2, n3 geom.Point) [4]geom.Point {
+	cubic := func(t geom.Pt) (b geom.Point) {
+		d := 1 - t
+		b.X = d*d*d*n0.X + 3*d*d*t*n1.X + 3*d*t*t*n2.X + t*t*t*n3.X
+		b.Y = d*d*d*n0.Y + 3*d*d*t*n1.Y + 3*d*t*t*n2.Y + t*t*t*n3.Y
+		return b
+	}
+
 	// A cubic Bezier curve is defined over t ∈ [0, 1] as
 	//
 	//	B(t) = (1-t)^3*n0 + 3*(1-t)^2*t*n1 + 3*(1-t)*t^2*n2 + t^3*p3
@@ -113,6 +104,34 @@ func extremitiesCubic(n0, n1, n2, n3 geom.Point) [6]geom.Point {
 	//
 	//	B'(t) = 3*(1-t)^2*(n1-n0) + 6*(1-t)*t*(n2-n1) + 3*t^2*(n3-n2)
 	//	B''(t) = 6*(1-t)*(n2-2*n1+n0) + 6*t*(n3 - 2*n2 + n1)
-	return [6]geom.Point{}
-	//panic("bounds for cubics are not implemented")
+	//
+	// Collecting terms, B'(t)/3 = a*t^2 + b*t + c where
+	//
+	//	a = n3 - 3*n2 + 3*n1 - n0
+	//	b = 2*(n2 - 2*n1 + n0)
+	//	c = n1 - n0
+	//
+	// which has up to two roots on each axis. As with the quadratic
+	// case, the second derivative contributes no extremities.
+	roots := func(v0, v1, v2, v3 geom.Pt) (t0, t1 geom.Pt) {
+		a := float64(v3 - 3*v2 + 3*v1 - v0)
+		b := float64(2 * (v2 - 2*v1 + v0))
+		c := float64(v1 - v0)
+		if math.Abs(a) < 1e-9 {
+			if b == 0 {
+				return 0, 0
+			}
+			t := geom.Pt(-c / b)
+			return clamp(t), clamp(t)
+		}
+		disc := b*b - 4*a*c
+		if disc < 0 {
+			return 0, 0
+		}
+		disc = math.Sqrt(disc)
+		return clamp(geom.Pt((-b + disc) / (2 * a))), clamp(geom.Pt((-b - disc) / (2 * a)))
+	}
+	tx0, tx1 := roots(n0.X, n1.X, n2.X, n3.X)
+	ty0, ty1 := roots(n0.Y, n1.Y, n2.Y, n3.Y)
+	return [4]geom.Point{cubic(tx0), cubic(tx1), cubic(ty0), cubic(ty1)}
 }
@@ -50,3 +50,38 @@ func TestBounds(t *testing.T) {
 		}
 	}
 }
+
+func TestBoundsCubic(t *testing.T) {
+	var tests = []struct {
+		curve [4]geom.Point
+		want  geom.Rectangle
+	}{
+		{
+			curve: [4]geom.Point{{10, 20}, {20, 30}, {30, 40}, {40, 50}},
+			want:  geom.Rectangle{geom.Point{10, 20}, geom.Point{40, 50}},
+		},
+		{
+			curve: [4]geom.Point{{0, 0}, {0, 40}, {40, 40}, {40, 0}},
+			want:  geom.Rectangle{geom.Point{0, 0}, geom.Point{40, 30}},
+		},
+		{
+			curve: [4]geom.Point{{-10, -10}, {-40, -20}, {-20, -40}, {-30, -30}},
+			want:  geom.Rectangle{geom.Point{-30, -32.73}, geom.Point{-10, -10}},
+		},
+	}
+
+	const epsilon = 0.01
+	eq := func(x, y geom.Pt) bool { return x-y < epsilon && y-x < epsilon }
+	pointEq := func(x, y geom.Point) bool { return eq(x.X, y.X) && eq(x.Y, y.Y) }
+	rectEq := func(x, y geom.Rectangle) bool { return pointEq(x.Min, y.Min) && pointEq(x.Max, y.Max) }
+
+	for _, test := range tests {
+		p := new(Path)
+		p.AddStart(test.curve[0])
+		p.AddCubic(test.curve[1], test.curve[2], test.curve[3])
+		got := p.Bounds()
+		if !rectEq(got, test.want) {
+			t.Errorf("%v: got bounds %v, want %v", test.curve, got, test.want)
+		}
+	}
+}
@@ -3,147 +3,510 @@ package raster
 import (
 	"fmt"
 	"image"
-	"image/color"
+	"image/draw"
+	"math"
+
+	"golang.org/x/mobile/f32"
+	"golang.org/x/mobile/geom"
 
 	"github.com/crawshaw/sprite"
 	"github.com/crawshaw/sprite/clock"
 )
 
-// TODO: must make this adaptive
-const colWidth = 128
+// Curves can be cached both as coverage and as distance fields.
+// Coverage is cached at a few scales, so that curves drawn large stay
+// sharp.
+type cacheKey struct {
+	id    sprite.Curve
+	sdf   bool
+	scale int // bucket, see bucketScale
+}
+
+// Scales are quantized to buckets half an octave apart, so that a curve
+// is never drawn more than about 1.4 times larger or smaller than it is
+// rasterized.
+const (
+	minScaleBucket = -8 // 1/16
+	maxScaleBucket = 6  // 8
+)
+
+// scaleBucket returns the bucket of scale s.
+func scaleBucket(s float32) int {
+	if !(s > 0) {
+		return 0
+	}
+	k := int(math.Floor(2*math.Log2(float64(s)) + 0.5))
+	if k < minScaleBucket {
+		return minScaleBucket
+	}
+	if k > maxScaleBucket {
+		return maxScaleBucket
+	}
+	return k
+}
+
+// bucketScale returns the scale curves in bucket k are rasterized at.
+func bucketScale(k int) float32 {
+	return float32(math.Pow(2, float64(k)/2))
+}
+
+// UnitScale returns the scale to pass to Get for a curve p drawn, as
+// engines do, over the unit square transformed by m into pixels. The
+// scale is that of the larger of the two axes.
+func UnitScale(p Path, m *f32.Affine) float32 {
+	b := p.Bounds()
+	w, h := (b.Max.X - b.Min.X).Px(), (b.Max.Y - b.Min.Y).Px()
+	s := float32(0)
+	if w > 0 {
+		s = float32(math.Hypot(float64(m[0][0]), float64(m[1][0]))) / w
+	}
+	if h > 0 {
+		if sy := float32(math.Hypot(float64(m[0][1]), float64(m[1][1]))) / h; sy > s {
+			s = sy
+		}
+	}
+	if s == 0 {
+		return 1
+	}
+	return s
+}
 
 type cacheEntry struct {
-	id   sprite.Curve
+	key  cacheKey
 	path Path
+	page int
 	b    image.Rectangle
-	time clock.Time // needed for rendering at time
+	slot image.Rectangle // b and its gutter, in the page's packer
+	time clock.Time      // needed for rendering at time
 
 	next, prev *cacheEntry // linked-list, most recently used at front
 }
 
+// A Cache holds rasterized curves, packed into one or more atlas
+// pages.
+//
+// When the pages are full, the least recently used curves are evicted
+// and their space reused. Curves used at the time of the current Get
+// are never evicted, as they are still being drawn, so the time must
+// advance from one frame to the next: with a time that stays the same,
+// no space is ever reused and Get fails once the pages are full.
 type Cache struct {
-	M     *image.RGBA // TODO: *image.Alpha??
-	Dirty bool
+	// Pages are the images that curves are drawn into. They are
+	// either *image.Alpha, holding coverage, or *image.RGBA, holding
+	// coverage in black or distance fields.
+	Pages []draw.Image
+
+	// NewPage, if non-nil, is called to add a page when the others
+	// are full, until there are MaxPages. If MaxPages is zero, there
+	// is no limit. Pages may have different sizes, but no page is
+	// added for a curve larger than the last page NewPage returned.
+	NewPage  func() draw.Image
+	MaxPages int
 
-	cache      map[sprite.Curve]*cacheEntry
+	// Spread is the distance in pixels recorded by distance field
+	// entries, and the margin left around their curves. Zero means 8.
+	Spread int
+
+	cache      map[cacheKey]*cacheEntry
 	cacheFront *cacheEntry // front of cacheEntry linked-list
-	x, y       int         // next empty slot
+	cacheBack  *cacheEntry // back of cacheEntry linked-list
+	pages      []*cachePage
+	newPage    image.Point // size of the last page from NewPage
 }
 
-func (c *Cache) Get(id sprite.Curve, p Path, t clock.Time) (image.Rectangle, error) {
-	if c.cache == nil {
-		c.cache = make(map[sprite.Curve]*cacheEntry)
+// A cachePage tracks the space in one page. Space is taken from
+// regions freed by evicted curves before the skyline.
+type cachePage struct {
+	sky   *skyline
+	free  []image.Rectangle
+	live  int               // entries in the page
+	dirty []image.Rectangle // regions drawn since TakeDirty
+}
+
+// Get returns the page and bounds in that page of the coverage of the
+// curve, drawn scale times larger than its natural size at
+// geom.PixelsPerPt.
+//
+// The scale is rounded to the nearest of a few fixed scales, so the
+// bounds may be somewhat larger or smaller. A curve too large for a
+// page at the requested scale is rasterized smaller. When a curve is
+// rasterized at a new scale, the other scales of the curve not used at
+// time t are evicted.
+func (c *Cache) Get(id sprite.Curve, p Path, scale float32, t clock.Time) (page int, b image.Rectangle, err error) {
+	k := scaleBucket(scale)
+	for {
+		entry, err := c.get(cacheKey{id, false, k}, p, t)
+		if _, ok := err.(tooLargeError); ok && k > minScaleBucket {
+			k--
+			continue
+		}
+		if err != nil {
+			return 0, image.Rectangle{}, err
+		}
+		return entry.page, entry.b, nil
+	}
+}
+
+// GetSDF returns the page and bounds in that page of a multi-channel
+// distance field of the curve, as drawn by MSDF. The bounds include a
+// margin of Spread pixels on each side of the curve.
+func (c *Cache) GetSDF(id sprite.Curve, p Path, t clock.Time) (page int, b image.Rectangle, err error) {
+	if c.Spread == 0 {
+		c.Spread = 8
 	}
-	entry, err := c.get(id, p, t)
-	return entry.b, err
+	entry, err := c.get(cacheKey{id, true, 0}, p, t)
+	if err != nil {
+		return 0, image.Rectangle{}, err
+	}
+	return entry.page, entry.b, nil
+}
+
+// TakeDirty returns the regions of each page drawn since the last call,
+// indexed by page. Engines that keep a copy of the pages, such as in
+// textures, need only update these regions.
+func (c *Cache) TakeDirty() [][]image.Rectangle {
+	d := make([][]image.Rectangle, len(c.pages))
+	for i, p := range c.pages {
+		d[i], p.dirty = p.dirty, nil
+	}
+	return d
+}
+
+// CacheStats describes how much of a Cache is in use.
+type CacheStats struct {
+	Entries int // cached curves
+	Pages   int
+	Area    int // pixels in all pages
+	Used    int // pixels holding cached curves
 }
 
-func (c *Cache) get(id sprite.Curve, p Path, t clock.Time) (*cacheEntry, error) {
-	entry := c.cache[id]
+// Occupancy returns the fraction of the cache's pixels in use.
+func (s CacheStats) Occupancy() float64 {
+	if s.Area == 0 {
+		return 0
+	}
+	return float64(s.Used) / float64(s.Area)
+}
+
+// Stats returns the current use of the cache.
+func (c *Cache) Stats() CacheStats {
+	s := CacheStats{
+		Entries: len(c.cache),
+		Pages:   len(c.Pages),
+	}
+	for _, m := range c.Pages {
+		b := m.Bounds()
+		s.Area += b.Dx() * b.Dy()
+	}
+	for _, e := range c.cache {
+		s.Used += e.b.Dx() * e.b.Dy()
+	}
+	return s
+}
+
+func (c *Cache) get(key cacheKey, p Path, t clock.Time) (*cacheEntry, error) {
+	if c.cache == nil {
+		c.cache = make(map[cacheKey]*cacheEntry)
+	}
+	entry := c.cache[key]
 	if entry == nil {
-		entry = &cacheEntry{id: id, path: p}
+		entry = &cacheEntry{key: key, path: p}
 		if err := c.rasterize(entry, t); err != nil {
 			return nil, err
 		}
-		c.cache[id] = entry
-		c.Dirty = true
+		c.cache[key] = entry
+		for k := minScaleBucket; k <= maxScaleBucket; k++ {
+			other := cacheKey{key.id, key.sdf, k}
+			if e := c.cache[other]; e != nil && k != key.scale && e.time < t {
+				c.evict(e)
+			}
+		}
 	} else {
-		entry.time = t
+		c.unlink(entry)
+	}
+	entry.time = t
+	c.pushFront(entry)
+	return entry, nil
+}
 
-		// remove from list
-		if entry.prev != nil {
-			entry.prev.next = entry.next
-		}
-		if entry.next != nil {
-			entry.next.prev = entry.prev
-		}
+func (c *Cache) unlink(e *cacheEntry) {
+	if e.prev != nil {
+		e.prev.next = e.next
+	} else {
+		c.cacheFront = e.next
+	}
+	if e.next != nil {
+		e.next.prev = e.prev
+	} else {
+		c.cacheBack = e.prev
 	}
+	e.next, e.prev = nil, nil
+}
 
-	// put on front of list
-	entry.prev = nil
-	entry.next = c.cacheFront
+func (c *Cache) pushFront(e *cacheEntry) {
+	e.prev = nil
+	e.next = c.cacheFront
 	if c.cacheFront != nil {
-		c.cacheFront.prev = entry
-		c.cacheFront = entry
+		c.cacheFront.prev = e
+	} else {
+		c.cacheBack = e
 	}
-	return entry, nil
+	c.cacheFront = e
+}
+
+// Remove evicts every entry of the curve id, such as when it has been
+// unloaded.
+func (c *Cache) Remove(id sprite.Curve) {
+	for k := minScaleBucket; k <= maxScaleBucket; k++ {
+		for _, sdf := range []bool{false, true} {
+			if e := c.cache[cacheKey{id, sdf, k}]; e != nil {
+				c.evict(e)
+			}
+		}
+	}
+}
+
+// evict removes e from the cache and frees its space.
+func (c *Cache) evict(e *cacheEntry) {
+	c.unlink(e)
+	delete(c.cache, e.key)
+	c.pages[e.page].release(e.slot)
 }
 
-func (c *Cache) findSpace(w, h int, t clock.Time) (image.Point, error) {
-	if w > colWidth {
-		return image.Point{}, fmt.Errorf("raster: curve larger than cache column width: %d", w)
+// findSpace returns a place for a w by h curve, evicting the least
+// recently used curves until there is room for it.
+func (c *Cache) findSpace(w, h int, t clock.Time) (int, image.Rectangle, error) {
+	if page, r, ok := c.alloc(w, h); ok {
+		return page, r, nil
 	}
-	b := c.M.Bounds()
-	sw, sh := b.Dx(), b.Dy()
-	if h > sh-c.y {
-		c.x += colWidth
-		c.y = 0
+	if err := c.fits(w, h); err != nil {
+		return 0, image.Rectangle{}, err
 	}
-	if c.x >= sw {
-		// out of space, clear out old curves
-		if err := c.clearHalf(t); err != nil {
-			return image.Point{}, err
+	for {
+		e := c.cacheBack
+		if e == nil || e.time >= t {
+			return 0, image.Rectangle{}, fmt.Errorf("raster: curve cache is full (%d items)", len(c.cache))
 		}
-		if h > sh-c.y {
-			c.x += colWidth
-			c.y = 0
+		c.evict(e)
+		if page, r, ok := c.alloc(w, h); ok {
+			return page, r, nil
 		}
 	}
-	if w > sw-c.x || h > sh-c.y {
-		return image.Point{}, fmt.Errorf("raster: no space for curve w=%d, h=%d", w, h)
+}
+
+// fits reports an error if a w by h curve is larger than any page can
+// hold.
+func (c *Cache) fits(w, h int) error {
+	var pw, ph int
+	for _, m := range c.Pages {
+		b := m.Bounds()
+		if b.Dx() >= w && b.Dy() >= h {
+			return nil
+		}
+		pw, ph = b.Dx(), b.Dy()
 	}
-	p := image.Point{c.x, c.y}
-	c.y += h
-	return p, nil
+	if c.canAddPage() {
+		if c.newPage == (image.Point{}) {
+			// A new page might be larger.
+			return nil
+		}
+		if c.newPage.X >= w && c.newPage.Y >= h {
+			return nil
+		}
+		pw, ph = c.newPage.X, c.newPage.Y
+	} else if len(c.Pages) == 0 {
+		return fmt.Errorf("raster: cache has no pages")
+	}
+	return tooLargeError{w, h, pw, ph}
+}
+
+// A tooLargeError reports a curve larger than any cache page.
+type tooLargeError struct {
+	w, h, pw, ph int
 }
 
-func (c *Cache) clearHalf(t clock.Time) error {
-	e := c.cacheFront
-	for e.next != nil {
-		e = e.next
+func (e tooLargeError) Error() string {
+	return fmt.Sprintf("raster: curve w=%d, h=%d larger than cache page w=%d, h=%d", e.w, e.h, e.pw, e.ph)
+}
+
+// canAddPage reports whether NewPage may be called for another page.
+func (c *Cache) canAddPage() bool {
+	return c.NewPage != nil && (c.MaxPages == 0 || len(c.Pages) < c.MaxPages)
+}
+
+// alloc reserves a w by h rectangle in the first page with room for it,
+// adding a page if none has and a new page can hold it. It returns the rectangle with its gutter,
+// in the coordinates of the page's packer.
+func (c *Cache) alloc(w, h int) (int, image.Rectangle, bool) {
+	// Each rectangle is given a one pixel gutter on its right and
+	// bottom, so that filtering does not blend neighboring curves.
+	// The skylines are a pixel larger than their page for the gutter
+	// of rectangles at the edge.
+	for len(c.pages) < len(c.Pages) {
+		b := c.Pages[len(c.pages)].Bounds()
+		c.pages = append(c.pages, &cachePage{sky: newSkyline(b.Dx()+1, b.Dy()+1)})
+	}
+	for i, p := range c.pages {
+		if r, ok := p.alloc(w+1, h+1); ok {
+			return i, r, true
+		}
+	}
+	if !c.canAddPage() {
+		return 0, image.Rectangle{}, false
+	}
+	if c.newPage != (image.Point{}) && (c.newPage.X < w || c.newPage.Y < h) {
+		// Do not make a page only to find it too small.
+		return 0, image.Rectangle{}, false
+	}
+	m := c.NewPage()
+	if m == nil {
+		return 0, image.Rectangle{}, false
 	}
+	b := m.Bounds()
+	c.newPage = b.Size()
+	if b.Dx() < w || b.Dy() < h {
+		return 0, image.Rectangle{}, false
+	}
+	p := &cachePage{sky: newSkyline(b.Dx()+1, b.Dy()+1)}
+	c.Pages = append(c.Pages, m)
+	c.pages = append(c.pages, p)
+	r, ok := p.alloc(w+1, h+1)
+	return len(c.pages) - 1, r, ok
+}
 
-	toDelete := len(c.cache) / 2
-	deleted := 0
-	for e != nil && toDelete > 0 {
-		if e.time < t {
-			delete(c.cache, e.id)
-			if e.next != nil {
-				e.next.prev = e.prev
-			}
-			if e.prev != nil {
-				e.prev.next = e.next
-			}
-			deleted++
-			toDelete--
+// alloc reserves a w by h rectangle, preferring the smallest free
+// region that holds it.
+func (p *cachePage) alloc(w, h int) (image.Rectangle, bool) {
+	best := -1
+	for i, r := range p.free {
+		if r.Dx() >= w && r.Dy() >= h && (best < 0 || r.Dx()*r.Dy() < p.free[best].Dx()*p.free[best].Dy()) {
+			best = i
 		}
-		e = e.prev
 	}
-	if deleted == 0 {
-		return fmt.Errorf("raster: curve cache is full (%d items)", len(c.cache))
+	if best < 0 {
+		pt, ok := p.sky.alloc(w, h)
+		if !ok {
+			return image.Rectangle{}, false
+		}
+		p.live++
+		return image.Rect(pt.X, pt.Y, pt.X+w, pt.Y+h), true
+	}
+
+	r := p.free[best]
+	p.free = append(p.free[:best], p.free[best+1:]...)
+	// Return the rest of the region, split in two, to the free list.
+	if r.Dx() > w {
+		p.free = append(p.free, image.Rect(r.Min.X+w, r.Min.Y, r.Max.X, r.Min.Y+h))
+	}
+	if r.Dy() > h {
+		p.free = append(p.free, image.Rect(r.Min.X, r.Min.Y+h, r.Max.X, r.Max.Y))
 	}
+	p.live++
+	return image.Rect(r.Min.X, r.Min.Y, r.Min.X+w, r.Min.Y+h), true
+}
 
-	// re-render cache
-	for e := c.cacheFront; e != nil; e = e.next {
-		if err := c.rasterize(e, e.time); err != nil {
-			return err
+// release frees a rectangle returned by alloc.
+func (p *cachePage) release(r image.Rectangle) {
+	p.live--
+	if p.live == 0 {
+		p.sky.reset()
+		p.free = p.free[:0]
+		return
+	}
+	// Join r with free regions that share a whole edge with it, so
+	// that space freed a little at a time can hold larger curves.
+	for joined := true; joined; {
+		joined = false
+		for i, f := range p.free {
+			if f.Min.Y == r.Min.Y && f.Max.Y == r.Max.Y && (f.Max.X == r.Min.X || f.Min.X == r.Max.X) ||
+				f.Min.X == r.Min.X && f.Max.X == r.Max.X && (f.Max.Y == r.Min.Y || f.Min.Y == r.Max.Y) {
+				r = r.Union(f)
+				p.free = append(p.free[:i], p.free[i+1:]...)
+				joined = true
+				break
+			}
 		}
 	}
-	return nil
+	p.free = append(p.free, r)
 }
 
-func (c *Cache) rasterize(entry *cacheEntry, t clock.Time) error {
+// size returns the size in pixels of the entry's image, and the margin
+// around its curve.
+func (c *Cache) size(entry *cacheEntry) (w, h, pad int) {
 	b := entry.path.Bounds()
-	w := int((b.Max.X - b.Min.X).Px() + 0.5)
-	h := int((b.Max.Y - b.Min.Y).Px() + 0.5)
-	p, err := c.findSpace(w, h, t)
+	s := bucketScale(entry.key.scale)
+	w = int((b.Max.X-b.Min.X).Px()*s + 0.5)
+	h = int((b.Max.Y-b.Min.Y).Px()*s + 0.5)
+	if entry.key.sdf {
+		pad = c.Spread
+		w += 2 * pad
+		h += 2 * pad
+	}
+	return w, h, pad
+}
+
+func (c *Cache) rasterize(entry *cacheEntry, t clock.Time) error {
+	w, h, pad := c.size(entry)
+	page, slot, err := c.findSpace(w, h, t)
 	if err != nil {
+		return err
 	}
-	entry.b = image.Rect(p.X, p.Y, p.X+w, p.Y+h)
-	m := c.M.SubImage(entry.b).(*image.RGBA)
-	for i := range m.Pix {
-		m.Pix[i] = 0
+	dst := c.Pages[page]
+	switch dst.(type) {
+	case *image.Alpha:
+		if entry.key.sdf {
+			c.pages[page].release(slot)
+			return fmt.Errorf("raster: distance fields need *image.RGBA cache pages, not %T", dst)
+		}
+	case *image.RGBA:
+	default:
+		c.pages[page].release(slot)
+		return fmt.Errorf("raster: unsupported cache page type %T", dst)
 	}
-	Draw(m, image.NewUniform(color.Black), entry.path)
+	entry.page = page
+	entry.slot = slot
+	min := slot.Min.Add(dst.Bounds().Min)
+	entry.b = image.Rect(min.X, min.Y, min.X+w, min.Y+h)
+
+	// Clear the whole slot, as a previous curve in a reused slot may
+	// have left pixels in the gutter.
+	sb := image.Rectangle{min, slot.Size().Add(min)}.Intersect(dst.Bounds())
+	draw.Draw(dst, sb, image.Transparent, image.Point{}, draw.Src)
+	c.pages[page].addDirty(sb)
+
+	b := entry.path.Bounds()
+	s := bucketScale(entry.key.scale)
+	off := float32(pad) / geom.PixelsPerPt
+	path := entry.path.Transform(&f32.Affine{
+		{s, 0, off - s*float32(b.Min.X)},
+		{0, s, off - s*float32(b.Min.Y)},
+	})
+	if m, ok := dst.(*image.Alpha); ok {
+		DrawAlpha(m.SubImage(entry.b).(*image.Alpha), path)
+		return nil
+	}
+	m := dst.(*image.RGBA).SubImage(entry.b).(*image.RGBA)
+	if entry.key.sdf {
+		MSDF(m, path, float32(pad))
+		return nil
+	}
+	mask := image.NewAlpha(image.Rect(0, 0, w, h))
+	DrawAlpha(mask, path)
+	draw.DrawMask(m, entry.b, image.Black, image.Point{}, mask, image.Point{}, draw.Over)
 	return nil
 }
+
+// addDirty records that r has been drawn. Past a few regions they are
+// joined into one, as uploading a little extra costs less than many
+// separate uploads.
+func (p *cachePage) addDirty(r image.Rectangle) {
+	const maxDirty = 16
+	if len(p.dirty) < maxDirty {
+		p.dirty = append(p.dirty, r)
+		return
+	}
+	for _, d := range p.dirty {
+		r = r.Union(d)
+	}
+	p.dirty = append(p.dirty[:0], r)
+}
@@ -0,0 +1,411 @@
+package raster
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"reflect"
+	"testing"
+
+	"golang.org/x/mobile/f32"
+	"golang.org/x/mobile/geom"
+
+	"github.com/crawshaw/sprite"
+	"github.com/crawshaw/sprite/clock"
+)
+
+func rectPath(w, h geom.Pt) Path {
+	var p Path
+	p.AddStart(geom.Point{0, 0})
+	p.AddLine(geom.Point{w, 0})
+	p.AddLine(geom.Point{w, h})
+	p.AddLine(geom.Point{0, h})
+	p.AddLine(geom.Point{0, 0})
+	return p
+}
+
+func TestSkyline(t *testing.T) {
+	s := newSkyline(100, 100)
+	var rects []image.Rectangle
+	for _, sz := range []image.Point{
+		{60, 30}, {40, 50}, {30, 30}, {30, 20}, {70, 40}, {100, 10},
+	} {
+		p, ok := s.alloc(sz.X, sz.Y)
+		if !ok {
+			t.Fatalf("alloc(%d, %d) failed, nodes=%v", sz.X, sz.Y, s.nodes)
+		}
+		r := image.Rectangle{p, p.Add(sz)}
+		if !r.In(image.Rect(0, 0, 100, 100)) {
+			t.Errorf("alloc(%d, %d) = %v, outside the skyline", sz.X, sz.Y, r)
+		}
+		for _, o := range rects {
+			if r.Overlaps(o) {
+				t.Errorf("alloc(%d, %d) = %v, overlaps %v", sz.X, sz.Y, r, o)
+			}
+		}
+		rects = append(rects, r)
+	}
+	if _, ok := s.alloc(101, 1); ok {
+		t.Error("alloc wider than the skyline succeeded")
+	}
+	if _, ok := s.alloc(100, 100); ok {
+		t.Error("alloc into a full skyline succeeded")
+	}
+	s.reset()
+	if p, ok := s.alloc(100, 100); !ok || p != (image.Point{}) {
+		t.Errorf("alloc after reset = %v, %v", p, ok)
+	}
+}
+
+func TestCacheLargeCurve(t *testing.T) {
+	geom.PixelsPerPt = 1
+	c := &Cache{Pages: []draw.Image{image.NewRGBA(image.Rect(0, 0, 512, 256))}}
+	page, b, err := c.Get(1, rectPath(300, 40), 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page != 0 || b.Dx() != 300 || b.Dy() != 40 {
+		t.Errorf("Get = %d, %v, want a 300x40 rectangle on page 0", page, b)
+	}
+	if _, _, _, a := c.Pages[0].At(b.Min.X+150, b.Min.Y+20).RGBA(); a == 0 {
+		t.Error("curve not drawn")
+	}
+
+	// A curve wider than the page at scale 1 is rasterized smaller.
+	page, b, err = c.Get(2, rectPath(600, 10), 1, 0)
+	if err != nil {
+		t.Fatalf("curve wider than the page: %v", err)
+	}
+	if b.Dx() != 424 || b.Dy() != 7 || !b.In(c.Pages[page].Bounds()) {
+		t.Errorf("Get = %d, %v, want a 424x7 rectangle in the page", page, b)
+	}
+
+	if _, _, err := c.Get(3, rectPath(600*16+16, 10), 1, 0); err == nil {
+		t.Error("curve wider than the page at the smallest scale: no error")
+	}
+}
+
+func TestCachePages(t *testing.T) {
+	geom.PixelsPerPt = 1
+	c := &Cache{
+		NewPage: func() draw.Image {
+			return image.NewRGBA(image.Rect(0, 0, 64, 64))
+		},
+		MaxPages: 3,
+	}
+	seen := make(map[int][]image.Rectangle)
+	for id := sprite.Curve(1); id <= 12; id++ {
+		page, b, err := c.Get(id, rectPath(30, 30), 1, 0)
+		if err != nil {
+			t.Fatalf("curve %d: %v", id, err)
+		}
+		for _, o := range seen[page] {
+			if b.Overlaps(o) {
+				t.Errorf("curve %d at %v on page %d overlaps %v", id, b, page, o)
+			}
+		}
+		seen[page] = append(seen[page], b)
+	}
+	s := c.Stats()
+	if s.Pages != 3 || s.Entries != 12 {
+		t.Errorf("Stats = %+v, want 3 pages and 12 entries", s)
+	}
+	if s.Area != 3*64*64 || s.Used != 12*30*30 {
+		t.Errorf("Stats = %+v, want area %d, used %d", s, 3*64*64, 12*30*30)
+	}
+	if got, want := s.Occupancy(), float64(12*30*30)/(3*64*64); got != want {
+		t.Errorf("Occupancy = %v, want %v", got, want)
+	}
+
+	// Cached curves keep their place.
+	page, b, err := c.Get(1, rectPath(30, 30), 1, 0)
+	if err != nil || page != 0 || b != seen[0][0] {
+		t.Errorf("Get(1) = %d, %v, %v, want 0, %v", page, b, err, seen[0][0])
+	}
+}
+
+func TestCacheOversizeNewPage(t *testing.T) {
+	geom.PixelsPerPt = 1
+	for _, max := range []int{0, 4} {
+		calls := 0
+		c := &Cache{
+			NewPage: func() draw.Image {
+				calls++
+				if calls > 10 {
+					t.Fatalf("MaxPages=%d: NewPage called %d times", max, calls)
+				}
+				return image.NewAlpha(image.Rect(0, 0, 64, 64))
+			},
+			MaxPages: max,
+		}
+		// Too wide for a page even at the smallest scale.
+		_, _, err := c.Get(1, rectPath(2000, 10), 1, 0)
+		if _, ok := err.(tooLargeError); !ok {
+			t.Errorf("MaxPages=%d: err = %v, want tooLargeError", max, err)
+		}
+		if calls != 1 || len(c.Pages) != 0 {
+			t.Errorf("MaxPages=%d: %d NewPage calls, %d pages, want 1 call and no pages", max, calls, len(c.Pages))
+		}
+		if _, _, err := c.Get(2, rectPath(30, 30), 1, 0); err != nil {
+			t.Errorf("MaxPages=%d: small curve: %v", max, err)
+		}
+		if len(c.Pages) != 1 {
+			t.Errorf("MaxPages=%d: %d pages after a small curve, want 1", max, len(c.Pages))
+		}
+	}
+}
+
+func TestCacheNoPages(t *testing.T) {
+	c := &Cache{}
+	_, _, err := c.Get(1, rectPath(10, 10), 1, 0)
+	if err == nil {
+		t.Fatal("no error from a cache without pages")
+	}
+	if got, want := err.Error(), "raster: cache has no pages"; got != want {
+		t.Errorf("err = %q, want %q", got, want)
+	}
+}
+
+// cached returns the ids of the coverage entries in c, most recently
+// used first.
+func cached(c *Cache) []sprite.Curve {
+	var ids []sprite.Curve
+	for e := c.cacheFront; e != nil; e = e.next {
+		ids = append(ids, e.key.id)
+	}
+	return ids
+}
+
+func TestCacheEviction(t *testing.T) {
+	geom.PixelsPerPt = 1
+	// Four 30x30 curves, with their gutters, fill the page.
+	c := &Cache{Pages: []draw.Image{image.NewRGBA(image.Rect(0, 0, 62, 62))}}
+	slots := make(map[sprite.Curve]image.Rectangle)
+	for id := sprite.Curve(1); id <= 4; id++ {
+		_, b, err := c.Get(id, rectPath(30, 30), 1, clock.Time(id))
+		if err != nil {
+			t.Fatalf("curve %d: %v", id, err)
+		}
+		slots[id] = b
+	}
+	if _, _, err := c.Get(1, rectPath(30, 30), 1, 5); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cached(c), []sprite.Curve{1, 4, 3, 2}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("LRU order = %v, want %v", got, want)
+	}
+
+	// New curves replace the least recently used, in place.
+	for i, want := range []sprite.Curve{2, 3} {
+		id := sprite.Curve(5 + i)
+		_, b, err := c.Get(id, rectPath(30, 30), 1, clock.Time(6+i))
+		if err != nil {
+			t.Fatalf("curve %d: %v", id, err)
+		}
+		if b != slots[want] {
+			t.Errorf("curve %d at %v, want %v, the place of curve %d", id, b, slots[want], want)
+		}
+	}
+	if got, want := cached(c), []sprite.Curve{6, 5, 1, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("LRU order = %v, want %v", got, want)
+	}
+
+	// A larger curve needs the space of more than one.
+	if _, _, err := c.Get(7, rectPath(61, 30), 1, 8); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range c.cache {
+		for _, o := range c.cache {
+			if e != o && e.b.Overlaps(o.b) {
+				t.Errorf("curve %d at %v overlaps curve %d at %v", e.key.id, e.b, o.key.id, o.b)
+			}
+		}
+	}
+
+	// Curves used at the current time are not evicted.
+	for id := range c.cache {
+		if _, _, err := c.Get(id.id, nil, 1, 9); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n := len(c.cache)
+	if _, _, err := c.Get(8, rectPath(61, 61), 1, 9); err == nil {
+		t.Error("evicted a curve in use")
+	}
+	if len(c.cache) != n {
+		t.Errorf("%d curves cached, want %d", len(c.cache), n)
+	}
+}
+
+func TestCacheDirty(t *testing.T) {
+	geom.PixelsPerPt = 1
+	c := &Cache{Pages: []draw.Image{image.NewRGBA(image.Rect(0, 0, 62, 31))}}
+	_, b1, _ := c.Get(1, rectPath(30, 30), 1, 1)
+	_, b2, _ := c.Get(2, rectPath(30, 30), 1, 2)
+	d := c.TakeDirty()
+	if len(d) != 1 || len(d[0]) != 2 || !b1.In(d[0][0]) || !b2.In(d[0][1]) {
+		t.Fatalf("TakeDirty = %v, want regions holding %v and %v", d, b1, b2)
+	}
+	if d := c.TakeDirty(); len(d[0]) != 0 {
+		t.Errorf("second TakeDirty = %v, want nothing", d)
+	}
+
+	c.Get(2, nil, 1, 3)
+	if d := c.TakeDirty(); len(d[0]) != 0 {
+		t.Errorf("TakeDirty after a cached Get = %v, want nothing", d)
+	}
+	_, b3, _ := c.Get(3, rectPath(30, 30), 1, 4)
+	if b3 != b1 {
+		t.Errorf("curve 3 at %v, want %v", b3, b1)
+	}
+	if d := c.TakeDirty(); len(d[0]) != 1 || !b3.In(d[0][0]) || d[0][0].Overlaps(b2) {
+		t.Errorf("TakeDirty after eviction = %v, want a region holding only %v", d, b3)
+	}
+}
+
+func TestScaleBucket(t *testing.T) {
+	for _, tc := range []struct {
+		scale float32
+		want  int
+	}{
+		{1, 0}, {1.1, 0}, {1.3, 1}, {2, 2}, {3, 3}, {0.5, -2}, {1000, maxScaleBucket}, {0.001, minScaleBucket}, {0, 0},
+	} {
+		if got := scaleBucket(tc.scale); got != tc.want {
+			t.Errorf("scaleBucket(%v) = %d, want %d", tc.scale, got, tc.want)
+		}
+	}
+	for k := minScaleBucket; k <= maxScaleBucket; k++ {
+		if got := scaleBucket(bucketScale(k)); got != k {
+			t.Errorf("scaleBucket(bucketScale(%d)) = %d", k, got)
+		}
+	}
+}
+
+func TestCacheScale(t *testing.T) {
+	geom.PixelsPerPt = 1
+	c := &Cache{Pages: []draw.Image{image.NewRGBA(image.Rect(0, 0, 128, 128))}}
+	p := rectPath(10, 10)
+	_, b1, err := c.Get(1, p, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, b2, err := c.Get(1, p, 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b1.Dx() != 10 || b2.Dx() != 28 || b2.Dy() != 28 {
+		t.Errorf("sizes %v and %v, want 10x10 and 28x28", b1.Size(), b2.Size())
+	}
+	if len(c.cache) != 2 {
+		t.Errorf("%d entries, want both scales used at the same time", len(c.cache))
+	}
+
+	// Scales unused at a later time are evicted.
+	if _, _, err := c.Get(1, p, 4, 2); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.cache) != 1 || c.cache[cacheKey{1, false, 4}] == nil {
+		t.Errorf("cache holds %v, want only scale bucket 4", c.cache)
+	}
+
+	// Curves too large to fit at a scale are drawn smaller.
+	_, b, err := c.Get(2, rectPath(100, 50), 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Dx() != 100 {
+		t.Errorf("large curve width %d, want 100", b.Dx())
+	}
+}
+
+func TestUnitScale(t *testing.T) {
+	geom.PixelsPerPt = 2
+	defer func() { geom.PixelsPerPt = 1 }()
+	p := rectPath(10, 20) // 20x40 pixels
+	for _, tc := range []struct {
+		m    f32.Affine
+		want float32
+	}{
+		{f32.Affine{{20, 0, 5}, {0, 40, 7}}, 1},
+		{f32.Affine{{40, 0, 0}, {0, 40, 0}}, 2},
+		{f32.Affine{{0, -80, 0}, {20, 0, 0}}, 2}, // rotated
+	} {
+		if got := UnitScale(p, &tc.m); math.Abs(float64(got-tc.want)) > 1e-6 {
+			t.Errorf("UnitScale(%v) = %v, want %v", tc.m, got, tc.want)
+		}
+	}
+}
+
+func TestCacheAlpha(t *testing.T) {
+	geom.PixelsPerPt = 1
+	c := &Cache{Pages: []draw.Image{image.NewAlpha(image.Rect(0, 0, 64, 64))}}
+	// A square whose right edge covers half a pixel.
+	page, b, err := c.Get(1, rectPath(10.5, 10), 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := c.Pages[page].(*image.Alpha)
+	if got := m.AlphaAt(b.Min.X+5, b.Min.Y+5).A; got != 0xff {
+		t.Errorf("inside alpha = %#x, want 0xff", got)
+	}
+	if got := m.AlphaAt(b.Min.X+10, b.Min.Y+5).A; got < 0x70 || got > 0x90 {
+		t.Errorf("edge alpha = %#x, want about 0x80", got)
+	}
+
+	if _, _, err := c.GetSDF(2, rectPath(10, 10), 0); err == nil {
+		t.Error("no error for a distance field in an alpha page")
+	}
+	if s := c.Stats(); s.Entries != 1 || s.Used != b.Dx()*b.Dy() {
+		t.Errorf("Stats = %+v after a failed GetSDF, want only the first curve", s)
+	}
+}
+
+func TestDrawAlpha(t *testing.T) {
+	geom.PixelsPerPt = 1
+	m := image.NewAlpha(image.Rect(0, 0, 20, 20))
+	DrawAlpha(m.SubImage(image.Rect(5, 5, 15, 15)).(*image.Alpha), rectPath(4, 4))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 20; x++ {
+			want := 0
+			if x >= 5 && x < 9 && y >= 5 && y < 9 {
+				want = 0xff
+			}
+			// Fixed point rounding leaves the far edges a little
+			// short of full coverage.
+			if got := int(m.AlphaAt(x, y).A); got < want-8 || got > want {
+				t.Errorf("alpha at (%d, %d) = %#x, want %#x", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestDraw(t *testing.T) {
+	geom.PixelsPerPt = 1
+	white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+	dst := image.NewRGBA(image.Rect(10, 10, 30, 20))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(white), image.Point{}, draw.Src)
+
+	// The src is opaque red on the left and half transparent blue,
+	// premultiplied, on the right.
+	src := image.NewRGBA(dst.Bounds())
+	draw.Draw(src, image.Rect(10, 10, 20, 20), image.NewUniform(color.RGBA{0xff, 0, 0, 0xff}), image.Point{}, draw.Src)
+	draw.Draw(src, image.Rect(20, 10, 30, 20), image.NewUniform(color.RGBA{0, 0, 0x80, 0x80}), image.Point{}, draw.Src)
+
+	Draw(dst, src, rectPath(20, 5))
+
+	tests := []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{12, 12, color.RGBA{0xff, 0, 0, 0xff}},
+		{25, 12, color.RGBA{0x7f, 0x7f, 0xff, 0xff}},
+		{12, 17, white},
+		{25, 17, white},
+	}
+	for _, tc := range tests {
+		if got := dst.RGBAAt(tc.x, tc.y); got != tc.want {
+			t.Errorf("(%d, %d) = %v, want %v", tc.x, tc.y, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package raster
+
+import "golang.org/x/mobile/geom"
+
+// FitCurve returns a path through pts made of as few cubic Bézier
+// segments as keep every point within tolerance of the path. It is
+// meant for compacting dense input such as touch events captured
+// while drawing freehand. A tolerance of zero or less keeps every
+// point on the path.
+//
+// The fitting is Philip J. Schneider's algorithm from "An Algorithm
+// for Automatically Fitting Digitized Curves", Graphics Gems, 1990.
+func FitCurve(pts []geom.Point, tolerance geom.Pt) Path {
+	d := make([]vec, 0, len(pts))
+	for _, p := range pts {
+		v := vecOf(p)
+		if len(d) == 0 || d[len(d)-1] != v {
+			d = append(d, v)
+		}
+	}
+	var p Path
+	if len(d) == 0 {
+		return p
+	}
+	p.AddStart(d[0].pt())
+	if len(d) == 1 {
+		return p
+	}
+	if tolerance < 0 {
+		tolerance = 0
+	}
+	f := fitter{d: d, err2: float64(tolerance) * float64(tolerance), p: &p}
+	t1 := d[1].sub(d[0]).unit()
+	t2 := d[len(d)-2].sub(d[len(d)-1]).unit()
+	f.fit(0, len(d)-1, t1, t2)
+	return p
+}
+
+// Simplify returns p with each of its curves replaced by the fewest
+// cubic segments that stay within tolerance of it. A tolerance of zero
+// or less keeps p as finely as Flatten can.
+func (p Path) Simplify(tolerance geom.Pt) Path {
+	var pts []geom.Point
+	var out Path
+	flush := func() {
+		if len(pts) > 0 {
+			out = append(out, FitCurve(pts, tolerance)...)
+		}
+		pts = pts[:0]
+	}
+	for it := p.Flatten(tolerance / 4).Iterator(); it.Next(); {
+		s := it.Segment()
+		if s.Op == OpStart {
+			flush()
+		}
+		pts = append(pts, s.End())
+	}
+	flush()
+	return out
+}
+
+type fitter struct {
+	d    []vec
+	err2 float64 // squared tolerance
+	p    *Path
+}
+
+// fit adds cubics fitting d[first:last+1] with the given unit tangents
+// at either end.
+func (f *fitter) fit(first, last int, t1, t2 vec) {
+	d := f.d
+	if last-first == 1 {
+		dist := d[last].sub(d[first]).len() / 3
+		f.p.AddCubic(d[first].add(t1.scale(dist)).pt(), d[last].add(t2.scale(dist)).pt(), d[last].pt())
+		return
+	}
+
+	u := f.chordLength(first, last)
+	bez := f.generate(first, last, u, t1, t2)
+	maxErr, split := f.maxError(first, last, bez, u)
+	if maxErr < f.err2 {
+		f.add(bez)
+		return
+	}
+
+	// If the fit is close, try improving the parameterization before
+	// splitting.
+	if maxErr < 16*f.err2 {
+		for i := 0; i < 4; i++ {
+			u = f.reparameterize(first, last, u, bez)
+			bez = f.generate(first, last, u, t1, t2)
+			maxErr, split = f.maxError(first, last, bez, u)
+			if maxErr < f.err2 {
+				f.add(bez)
+				return
+			}
+		}
+	}
+
+	center := d[split-1].sub(d[split+1]).unit()
+	if center == (vec{}) {
+		center = d[split-1].sub(d[split]).unit()
+	}
+	f.fit(first, split, t1, center)
+	f.fit(split, last, center.scale(-1), t2)
+}
+
+func (f *fitter) add(bez [4]vec) {
+	f.p.AddCubic(bez[1].pt(), bez[2].pt(), bez[3].pt())
+}
+
+// chordLength assigns each point a parameter by its distance along the
+// polyline.
+func (f *fitter) chordLength(first, last int) []float64 {
+	u := make([]float64, last-first+1)
+	for i := first + 1; i <= last; i++ {
+		u[i-first] = u[i-first-1] + f.d[i].sub(f.d[i-1]).len()
+	}
+	for i := range u {
+		u[i] /= u[len(u)-1]
+	}
+	return u
+}
+
+// generate finds the cubic with the given end tangents that best fits
+// the points at parameters u, in the least squares sense.
+func (f *fitter) generate(first, last int, u []float64, t1, t2 vec) [4]vec {
+	d := f.d
+	p0, p3 := d[first], d[last]
+	var c [2][2]float64
+	var x [2]float64
+	for i, t := range u {
+		s := 1 - t
+		a1 := t1.scale(3 * s * s * t)
+		a2 := t2.scale(3 * s * t * t)
+		c[0][0] += a1.dot(a1)
+		c[0][1] += a1.dot(a2)
+		c[1][1] += a2.dot(a2)
+		tmp := d[first+i].sub(p0.scale(s*s*s + 3*s*s*t).add(p3.scale(3*s*t*t + t*t*t)))
+		x[0] += a1.dot(tmp)
+		x[1] += a2.dot(tmp)
+	}
+	c[1][0] = c[0][1]
+
+	det := c[0][0]*c[1][1] - c[1][0]*c[0][1]
+	var alpha1, alpha2 float64
+	if det != 0 {
+		alpha1 = (x[0]*c[1][1] - x[1]*c[0][1]) / det
+		alpha2 = (c[0][0]*x[1] - c[1][0]*x[0]) / det
+	}
+
+	// Fall back to a heuristic if the solution is degenerate or runs
+	// backwards along a tangent.
+	segLen := p3.sub(p0).len()
+	eps := 1e-6 * segLen
+	if alpha1 < eps || alpha2 < eps {
+		alpha1, alpha2 = segLen/3, segLen/3
+	}
+	return [4]vec{p0, p0.add(t1.scale(alpha1)), p3.add(t2.scale(alpha2)), p3}
+}
+
+// maxError returns the largest squared distance between a point and
+// the cubic at its parameter, and the index of that point.
+func (f *fitter) maxError(first, last int, bez [4]vec, u []float64) (float64, int) {
+	maxErr, split := 0.0, (first+last+1)/2
+	for i := first + 1; i < last; i++ {
+		v := bezierPoint(bez, u[i-first]).sub(f.d[i])
+		if e := v.dot(v); e >= maxErr {
+			maxErr, split = e, i
+		}
+	}
+	return maxErr, split
+}
+
+// reparameterize improves u by a Newton-Raphson step towards the
+// closest point on bez.
+func (f *fitter) reparameterize(first, last int, u []float64, bez [4]vec) []float64 {
+	var d1 [3]vec
+	for i := range d1 {
+		d1[i] = bez[i+1].sub(bez[i]).scale(3)
+	}
+	var d2 [2]vec
+	for i := range d2 {
+		d2[i] = d1[i+1].sub(d1[i]).scale(2)
+	}
+	nu := make([]float64, len(u))
+	for i, t := range u {
+		s := 1 - t
+		p := bezierPoint(bez, t).sub(f.d[first+i])
+		q1 := d1[0].scale(s * s).add(d1[1].scale(2 * s * t)).add(d1[2].scale(t * t))
+		q2 := d2[0].scale(s).add(d2[1].scale(t))
+		den := q1.dot(q1) + p.dot(q2)
+		nu[i] = t
+		if den != 0 {
+			nu[i] = t - p.dot(q1)/den
+		}
+	}
+	return nu
+}
+
+func bezierPoint(b [4]vec, t float64) vec {
+	s := 1 - t
+	return b[0].scale(s * s * s).add(b[1].scale(3 * s * s * t)).add(b[2].scale(3 * s * t * t)).add(b[3].scale(t * t * t))
+}
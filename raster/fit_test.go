@@ -0,0 +1,88 @@
+package raster
+
+import (
+	"math"
+	"testing"
+
+	"golang.org/x/mobile/geom"
+)
+
+// distToPath returns the distance from p to the closest point on
+// the flattened path.
+func distToPath(p geom.Point, path Path) float64 {
+	min := math.Inf(1)
+	v := vecOf(p)
+	for it := path.Flatten(0.001).Iterator(); it.Next(); {
+		s := it.Segment()
+		if s.Op == OpStart {
+			continue
+		}
+		a, b := vecOf(s.P[0]), vecOf(s.P[1])
+		ab := b.sub(a)
+		t := 0.0
+		if l := ab.dot(ab); l > 0 {
+			t = math.Max(0, math.Min(1, v.sub(a).dot(ab)/l))
+		}
+		if d := a.add(ab.scale(t)).sub(v).len(); d < min {
+			min = d
+		}
+	}
+	return min
+}
+
+func TestFitCurve(t *testing.T) {
+	wave := func(n int) []geom.Point {
+		pts := make([]geom.Point, n)
+		for i := range pts {
+			x := float64(i) / float64(n-1) * 2 * math.Pi
+			pts[i] = geom.Point{geom.Pt(x * 10), geom.Pt(math.Sin(x) * 10)}
+		}
+		return pts
+	}
+	tests := []struct {
+		name     string
+		pts      []geom.Point
+		tol      geom.Pt
+		segments int // at most
+	}{
+		{"line", []geom.Point{{0, 0}, {1, 1}, {2, 2}, {3, 3}, {10, 10}}, 0.01, 1},
+		{"sine", wave(200), 0.1, 6},
+		{"sine coarse", wave(200), 1, 2},
+		{"corner", []geom.Point{{0, 0}, {2, 0}, {4, 0}, {6, 0}, {8, 0}, {10, 0}, {10, 2}, {10, 4}, {10, 6}, {10, 8}, {10, 10}}, 0.1, 4},
+		{"duplicates", []geom.Point{{0, 0}, {0, 0}, {5, 0}, {5, 0}}, 0.1, 1},
+	}
+	for _, test := range tests {
+		p := FitCurve(test.pts, test.tol)
+		n := segments(p) - 1
+		if n < 1 || n > test.segments {
+			t.Errorf("%s: %d cubics, want 1 to %d: %s", test.name, n, test.segments, p.SVG())
+		}
+		for _, pt := range test.pts {
+			if d := distToPath(pt, p); d > float64(test.tol)*1.01 {
+				t.Errorf("%s: point %v is %v from the fitted curve", test.name, pt, d)
+				break
+			}
+		}
+	}
+
+	if p := FitCurve(nil, 1); len(p) != 0 {
+		t.Errorf("FitCurve(nil) = %v, want empty", p)
+	}
+	if p := FitCurve([]geom.Point{{1, 2}}, 1); p.SVG() != "M1 2" {
+		t.Errorf("FitCurve of one point = %q", p.SVG())
+	}
+}
+
+func TestSimplify(t *testing.T) {
+	c := (&Circle{Center: geom.Point{0, 0}, Radius: 20}).Path()
+	dense := c.Flatten(0.001)
+	s := dense.Simplify(0.05)
+	if n, m := segments(s), segments(dense); n >= m/10 {
+		t.Errorf("simplified circle has %d segments, from %d", n, m)
+	}
+	for it := dense.Iterator(); it.Next(); {
+		if d := distToPath(it.Segment().End(), s); d > 0.06 {
+			t.Fatalf("point %v is %v from the simplified circle", it.Segment().End(), d)
+		}
+	}
+}
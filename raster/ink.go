@@ -0,0 +1,204 @@
+package raster
+
+import (
+	"math"
+
+	"golang.org/x/mobile/geom"
+
+	"github.com/crawshaw/sprite/clock"
+)
+
+// An InkSample is one input point of an Ink stroke, such as a touch
+// event.
+type InkSample struct {
+	Time  clock.Time
+	Point geom.Point
+
+	// Pressure is the force of the touch in (0, 1], or 0 if the input
+	// device does not report it.
+	Pressure float32
+}
+
+// An Ink builds a variable-width stroke from samples taken while the
+// user draws. The samples are smoothed with a Catmull-Rom spline, and
+// the stroke is wide where it is pressed hard or drawn slowly.
+//
+// An Ink is a Shape. Its Path is the filled outline of the whole
+// stroke. While the user is still drawing, Settled and Tail split the
+// outline into a part that grows by appending and a short part that
+// changes with every sample, so each can be loaded with LoadCurve
+// without reloading the entire stroke.
+type Ink struct {
+	MinWidth geom.Pt
+	MaxWidth geom.Pt
+
+	// ThinningSpeed is the speed, in points per clock tick, at which a
+	// stroke without pressure narrows to MinWidth. If zero, the width
+	// of such a stroke is MaxWidth.
+	ThinningSpeed geom.Pt
+
+	samples []inkPoint
+	settled int // segments returned by Settled
+}
+
+type inkPoint struct {
+	InkSample
+	width geom.Pt
+}
+
+// Add appends a sample to the stroke. Samples at the same point as the
+// previous one are ignored.
+func (k *Ink) Add(s InkSample) {
+	target := k.MaxWidth
+	if s.Pressure > 0 {
+		p := geom.Pt(s.Pressure)
+		if p > 1 {
+			p = 1
+		}
+		target = k.MinWidth + (k.MaxWidth-k.MinWidth)*p
+	}
+	if len(k.samples) == 0 {
+		k.samples = append(k.samples, inkPoint{s, target})
+		return
+	}
+	last := k.samples[len(k.samples)-1]
+	if s.Point == last.Point {
+		return
+	}
+	if s.Pressure == 0 && k.ThinningSpeed > 0 {
+		dt := geom.Pt(s.Time - last.Time)
+		if dt < 1 {
+			dt = 1
+		}
+		v := dist(last.Point, s.Point) / dt / k.ThinningSpeed
+		if v > 1 {
+			v = 1
+		}
+		target = k.MaxWidth - (k.MaxWidth-k.MinWidth)*v
+	}
+	// Ease towards the target width so the outline does not jump
+	// between noisy samples.
+	w := last.width + (target-last.width)/2
+	k.samples = append(k.samples, inkPoint{s, w})
+}
+
+// Reset clears the stroke, keeping its width settings.
+func (k *Ink) Reset() {
+	k.samples = k.samples[:0]
+	k.settled = 0
+}
+
+// Path returns the outline of the whole stroke.
+func (k *Ink) Path() Path {
+	return k.outline(0, len(k.samples)-1)
+}
+
+// Settled returns the outline of the part of the stroke that is final
+// and has not been returned by a previous call, or nil if there is
+// none. The spline between two samples is final once the sample after
+// them has been added.
+func (k *Ink) Settled() Path {
+	n := len(k.samples) - 2
+	if n <= k.settled {
+		return nil
+	}
+	p := k.outline(k.settled, n)
+	k.settled = n
+	return p
+}
+
+// Tail returns the outline of the part of the stroke after that
+// returned by Settled. It changes as samples are added.
+func (k *Ink) Tail() Path {
+	return k.outline(k.settled, len(k.samples)-1)
+}
+
+// segment returns the spline between samples i and i+1 as a cubic.
+func (k *Ink) segment(i int) Segment {
+	pt := func(j int) geom.Point {
+		if j < 0 {
+			j = 0
+		}
+		if j >= len(k.samples) {
+			j = len(k.samples) - 1
+		}
+		return k.samples[j].Point
+	}
+	p0, p1, p2, p3 := pt(i-1), pt(i), pt(i+1), pt(i+2)
+	return Segment{OpCubic, [4]geom.Point{
+		p1,
+		{p1.X + (p2.X-p0.X)/6, p1.Y + (p2.Y-p0.Y)/6},
+		{p2.X - (p3.X-p1.X)/6, p2.Y - (p3.Y-p1.Y)/6},
+		p2,
+	}}
+}
+
+// outline returns the outline of the stroke from sample i to sample j,
+// with round caps at both ends.
+func (k *Ink) outline(i, j int) Path {
+	if i < 0 || j < i || j >= len(k.samples) {
+		return nil
+	}
+	tol := geom.Pt(0.1 / geom.PixelsPerPt)
+	if i == j {
+		s := k.samples[i]
+		r := s.width / 2
+		var p Path
+		p.AddStart(geom.Point{s.Point.X + r, s.Point.Y})
+		addEllipticalArc(&p, s.Point, r, r, 0, 2*math.Pi)
+		return p
+	}
+
+	// Walk the spline, offsetting each side by half the width along
+	// the normal.
+	var left, right []geom.Point
+	var t0, t1 vec
+	for seg := i; seg < j; seg++ {
+		s := k.segment(seg)
+		w0, w1 := k.samples[seg].width, k.samples[seg+1].width
+		n := s.flatness(tol)
+		first := 0
+		if seg > i {
+			first = 1
+		}
+		for m := first; m <= n; m++ {
+			t := geom.Pt(m) / geom.Pt(n)
+			c := vecOf(s.Point(t))
+			tan := cubicTangent(s, t)
+			if m == 0 && seg == i {
+				t0 = tan
+			}
+			t1 = tan
+			off := vec{-tan.y, tan.x}.scale(float64(w0+(w1-w0)*t) / 2)
+			left = append(left, c.add(off).pt())
+			right = append(right, c.sub(off).pt())
+		}
+	}
+	for a, b := 0, len(right)-1; a < b; a, b = a+1, b-1 {
+		right[a], right[b] = right[b], right[a]
+	}
+
+	var p Path
+	p.AddStart(left[0])
+	p = append(p, FitCurve(left, tol)[3:]...)
+	end := k.samples[j]
+	angle := math.Atan2(t1.y, t1.x) + math.Pi/2
+	addEllipticalArc(&p, end.Point, end.width/2, end.width/2, angle, -math.Pi)
+	p = append(p, FitCurve(right, tol)[3:]...)
+	start := k.samples[i]
+	angle = math.Atan2(t0.y, t0.x) - math.Pi/2
+	addEllipticalArc(&p, start.Point, start.width/2, start.width/2, angle, -math.Pi)
+	return p
+}
+
+// cubicTangent returns the unit tangent of the cubic s at t.
+func cubicTangent(s Segment, t geom.Pt) vec {
+	u := float64(1 - t)
+	tt := float64(t)
+	p := [4]vec{vecOf(s.P[0]), vecOf(s.P[1]), vecOf(s.P[2]), vecOf(s.P[3])}
+	d := p[1].sub(p[0]).scale(u * u).add(p[2].sub(p[1]).scale(2 * u * tt)).add(p[3].sub(p[2]).scale(tt * tt))
+	if d.len() < 1e-9 {
+		d = p[3].sub(p[0])
+	}
+	return d.unit()
+}
@@ -0,0 +1,113 @@
+package raster
+
+import (
+	"testing"
+
+	"golang.org/x/mobile/geom"
+
+	"github.com/crawshaw/sprite/clock"
+)
+
+func TestInkPath(t *testing.T) {
+	geom.PixelsPerPt = 1
+	k := &Ink{MinWidth: 2, MaxWidth: 4}
+	for i := 0; i <= 10; i++ {
+		k.Add(InkSample{Time: clock.Time(i), Point: geom.Point{geom.Pt(i * 3), 10}})
+	}
+	in := inside(k.Path())
+	for _, p := range [][2]float64{{0, 10}, {15, 11.9}, {15, 8.1}, {30, 10}, {31.9, 10}, {-1.9, 10}} {
+		if !in(p[0], p[1]) {
+			t.Errorf("stroke does not contain %v", p)
+		}
+	}
+	for _, p := range [][2]float64{{15, 12.1}, {15, 7.9}, {32.1, 10}, {-2.1, 10}} {
+		if in(p[0], p[1]) {
+			t.Errorf("stroke contains %v", p)
+		}
+	}
+
+	dot := &Ink{MinWidth: 2, MaxWidth: 4}
+	dot.Add(InkSample{Point: geom.Point{5, 5}})
+	in = inside(dot.Path())
+	if !in(5, 6.9) || in(5, 7.1) {
+		t.Errorf("dot has the wrong size: %s", dot.Path().SVG())
+	}
+}
+
+func TestInkWidth(t *testing.T) {
+	width := func(k *Ink, step geom.Pt, pressure float32) geom.Pt {
+		for i := 0; i < 20; i++ {
+			k.Add(InkSample{
+				Time:     clock.Time(i),
+				Point:    geom.Point{geom.Pt(i) * step, 0},
+				Pressure: pressure,
+			})
+		}
+		return k.samples[len(k.samples)-1].width
+	}
+	slow := width(&Ink{MinWidth: 1, MaxWidth: 5, ThinningSpeed: 10}, 1, 0)
+	fast := width(&Ink{MinWidth: 1, MaxWidth: 5, ThinningSpeed: 10}, 20, 0)
+	if !near(slow, 4.6, 0.01) || !near(fast, 1, 0.01) {
+		t.Errorf("slow width %v, fast width %v, want 4.6 and 1", slow, fast)
+	}
+	soft := width(&Ink{MinWidth: 1, MaxWidth: 5, ThinningSpeed: 10}, 20, 0.25)
+	hard := width(&Ink{MinWidth: 1, MaxWidth: 5, ThinningSpeed: 10}, 20, 1)
+	if !near(soft, 2, 0.01) || !near(hard, 5, 0.01) {
+		t.Errorf("soft width %v, hard width %v, want 2 and 5", soft, hard)
+	}
+}
+
+func TestInkIncremental(t *testing.T) {
+	geom.PixelsPerPt = 1
+	k := &Ink{MinWidth: 2, MaxWidth: 2}
+	var settled []Path
+	add := func(x, y geom.Pt) {
+		k.Add(InkSample{Point: geom.Point{x, y}})
+		if p := k.Settled(); p != nil {
+			settled = append(settled, p)
+		}
+	}
+	add(0, 0)
+	add(10, 0)
+	if len(settled) != 0 {
+		t.Fatalf("settled with two samples")
+	}
+	add(20, 10)
+	add(30, 10)
+	add(40, 0)
+	if len(settled) != 3 {
+		t.Fatalf("got %d settled outlines, want 3", len(settled))
+	}
+	if p := k.Settled(); p != nil {
+		t.Errorf("Settled twice returned %s", p.SVG())
+	}
+
+	// The settled parts do not change as the stroke grows, and with
+	// the tail they cover the whole stroke.
+	before := settled[0].SVG()
+	add(50, 0)
+	if settled[0].SVG() != before {
+		t.Errorf("settled outline changed")
+	}
+	var parts []func(x, y float64) bool
+	for _, p := range settled {
+		parts = append(parts, inside(p))
+	}
+	parts = append(parts, inside(k.Tail()))
+	path := k.Path()
+	whole := inside(path)
+	for y := -3.0; y < 13; y += 0.25 {
+		for x := -3.0; x < 53; x += 0.25 {
+			any := false
+			for _, in := range parts {
+				any = any || in(x+0.01, y+0.01)
+			}
+			// The outlines are fitted separately, so they may differ
+			// by the fitting tolerance.
+			pt := geom.Point{geom.Pt(x + 0.01), geom.Pt(y + 0.01)}
+			if any != whole(x+0.01, y+0.01) && distToPath(pt, path) > 0.2 {
+				t.Fatalf("at %v parts %v, whole %v", pt, any, !any)
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package raster
+
+import (
+	"math"
+
+	"golang.org/x/mobile/geom"
+)
+
+// Offset returns the outline of the region filled by p, grown outwards
+// by d when d is positive and shrunk inwards when it is negative. Every
+// curve in p is treated as closed.
+//
+// Corners are rounded, as though a circle of radius |d| had been
+// rolled around the outline. The result is made of lines, see Simplify
+// to fit it with curves.
+//
+// The work grows with the number of segments of p, and with how many of
+// them lie within |d| of each other.
+func (p Path) Offset(d geom.Pt) Path {
+	if d == 0 {
+		return Union(p, nil)
+	}
+	r := math.Abs(float64(d))
+	tol := 0.1 / float64(geom.PixelsPerPt)
+	// step is the angle of each line of a rounded corner.
+	step := math.Pi / 4
+	if tol < r {
+		step = math.Min(step, 2*math.Acos(1-tol/r))
+	}
+
+	// Each edge of the outline, whose curves have the region on their
+	// left and do not cross, is moved d to its right. Consecutive edges
+	// are joined by an arc around their vertex where they part, and
+	// through their vertex where they overlap. The points of the
+	// offset region are those that these raw curves wind around
+	// positively, as in Chen and McMains, "Polygon offsetting by
+	// computing winding numbers", 2005.
+	var raw Path
+	for _, loop := range region(p, nil, func(wa, wb int) bool { return wa != 0 }) {
+		pts := make([]vec, len(loop))
+		for i, g := range loop {
+			x, y := g.f()
+			pts[i] = vec{x / gridScale, y / gridScale}
+		}
+		normal := func(i int) vec {
+			u := pts[(i+1)%len(pts)].sub(pts[i]).unit()
+			return vec{u.y, -u.x}.scale(float64(d))
+		}
+		n0 := normal(len(pts) - 1)
+		raw.AddStart(pts[0].add(n0).pt())
+		for i, v := range pts {
+			n1 := normal(i)
+			u0 := vec{-n0.y, n0.x}.scale(1 / float64(d)) // direction into v
+			u1 := vec{-n1.y, n1.x}.scale(1 / float64(d)) // direction out of v
+			turn := u0.x*u1.y - u0.y*u1.x
+			side := n0.x*u0.y - n0.y*u0.x // rotation from n0 around the turn
+			switch {
+			case turn == 0 && u0.dot(u1) > 0:
+				// Straight on.
+			case turn*side >= 0:
+				// The offset edges part: round the corner.
+				a := math.Acos(math.Max(-1, math.Min(1, n0.dot(n1)/(r*r))))
+				if side < 0 {
+					a = -a
+				}
+				k := int(math.Ceil(math.Abs(a) / step))
+				for j := 1; j < k; j++ {
+					sin, cos := math.Sincos(a * float64(j) / float64(k))
+					raw.AddLine(v.add(vec{n0.x*cos - n0.y*sin, n0.x*sin + n0.y*cos}).pt())
+				}
+			default:
+				// The offset edges overlap.
+				raw.AddLine(v.pt())
+			}
+			raw.AddLine(v.add(n1).pt())
+			raw.AddLine(pts[(i+1)%len(pts)].add(n1).pt())
+			n0 = n1
+		}
+	}
+	return combine(raw, nil, func(wa, wb int) bool { return wa > 0 })
+}
+
+// vec is a point or direction used for geometric computation.
+type vec struct{ x, y float64 }
+
+func vecOf(p geom.Point) vec { return vec{float64(p.X), float64(p.Y)} }
+
+func (v vec) pt() geom.Point      { return geom.Point{geom.Pt(v.x), geom.Pt(v.y)} }
+func (v vec) add(w vec) vec       { return vec{v.x + w.x, v.y + w.y} }
+func (v vec) sub(w vec) vec       { return vec{v.x - w.x, v.y - w.y} }
+func (v vec) scale(s float64) vec { return vec{v.x * s, v.y * s} }
+func (v vec) dot(w vec) float64   { return v.x*w.x + v.y*w.y }
+func (v vec) len() float64        { return math.Hypot(v.x, v.y) }
+
+func (v vec) unit() vec {
+	l := v.len()
+	if l == 0 {
+		return v
+	}
+	return v.scale(1 / l)
+}
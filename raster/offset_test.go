@@ -0,0 +1,102 @@
+package raster
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"golang.org/x/mobile/geom"
+)
+
+func TestOffset(t *testing.T) {
+	// Flatten finely, so the areas are close to those of true curves.
+	geom.PixelsPerPt = 4
+	defer func() { geom.PixelsPerPt = 1 }()
+
+	square := mustParse(t, "M10 10 H20 V20 H10 Z")
+	tests := []struct {
+		name string
+		p    Path
+		d    geom.Pt
+		area float64
+	}{
+		{"square grow", square, 2, 100 + 4*10*2 + math.Pi*4},
+		{"square shrink", square, -2, 36},
+		{"square vanish", square, -6, 0},
+		{"reversed square grow", square.Reverse(), 2, 100 + 4*10*2 + math.Pi*4},
+		{"circle grow", (&Circle{Center: geom.Point{15, 15}, Radius: 5}).Path(), 3, math.Pi * 64},
+		{"circle shrink", (&Circle{Center: geom.Point{15, 15}, Radius: 5}).Path(), -3, math.Pi * 4},
+		{"L grow", mustParse(t, "M0 0 H20 V10 H10 V20 H0 Z"), 2, 300 + 80*2 + math.Pi*4 - 4},
+		{"L shrink", mustParse(t, "M0 0 H20 V10 H10 V20 H0 Z"), -2, 16*6 + 6*10},
+		{"ring shrink", mustParse(t, "M0 0 H30 V30 H0 Z M10 10 V20 H20 V10 Z"), -1, 28*28 - 12*12 - (4 - math.Pi)},
+	}
+	for _, test := range tests {
+		got := test.p.Offset(test.d)
+		if a := math.Abs(area(got)); math.Abs(a-test.area) > 0.01*test.area+0.1 {
+			t.Errorf("%s: area %v, want %v", test.name, a, test.area)
+		}
+	}
+
+	// Points near the square are inside the grown outline, and points
+	// near its edges are outside the shrunk one.
+	in := inside(square.Offset(2))
+	for _, p := range [][2]float64{{8.5, 15}, {15, 21.5}, {9, 9}} {
+		if !in(p[0], p[1]) {
+			t.Errorf("grown square does not contain %v", p)
+		}
+	}
+	if in(8.2, 8.2) {
+		t.Errorf("grown square has sharp corners")
+	}
+	in = inside(square.Offset(-2))
+	for _, p := range [][2]float64{{11, 15}, {15, 19}} {
+		if in(p[0], p[1]) {
+			t.Errorf("shrunk square contains %v", p)
+		}
+	}
+}
+
+// freehand returns a closed, wavering outline of n points, as traced by
+// a finger around a blob. As with a finger, the points are about as far
+// apart however many there are, so the blob grows with n.
+func freehand(n int) Path {
+	var p Path
+	k := float64(n) / 400
+	for i := 0; i < n; i++ {
+		a := 2 * math.Pi * float64(i) / float64(n)
+		r := k * (50 + 10*math.Sin(7*a) + 2*math.Sin(53*a))
+		pt := geom.Point{geom.Pt(100 + r*math.Cos(a)), geom.Pt(100 + r*math.Sin(a))}
+		if i == 0 {
+			p.AddStart(pt)
+		} else {
+			p.AddLine(pt)
+		}
+	}
+	return p
+}
+
+func TestOffsetFreehand(t *testing.T) {
+	p := freehand(400)
+	a := math.Abs(area(p))
+	grown, shrunk := math.Abs(area(p.Offset(2))), math.Abs(area(p.Offset(-2)))
+	if !(shrunk < a && a < grown) {
+		t.Errorf("areas: shrunk %v, original %v, grown %v", shrunk, a, grown)
+	}
+	in := inside(p.Offset(2))
+	for it := p.Iterator(); it.Next(); {
+		if e := it.Segment().End(); !in(float64(e.X), float64(e.Y)) {
+			t.Fatalf("grown outline does not contain %v", e)
+		}
+	}
+}
+
+func BenchmarkOffset(b *testing.B) {
+	for _, n := range []int{100, 400, 1600, 6400} {
+		p := freehand(n)
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				p.Offset(2)
+			}
+		})
+	}
+}
@@ -0,0 +1,376 @@
+package raster
+
+import (
+	"fmt"
+	"math"
+
+	"golang.org/x/mobile/f32"
+	"golang.org/x/mobile/geom"
+)
+
+// An Op is the kind of a path Segment. Its value is the tag used in
+// the encoding of a Path, as documented on sprite.Engine.LoadCurve.
+type Op uint8
+
+const (
+	OpStart     Op = 0 // start a new curve
+	OpLine      Op = 1 // linear segment
+	OpQuadratic Op = 2 // quadratic Bézier segment
+	OpCubic     Op = 3 // cubic Bézier segment
+)
+
+// A Segment is one element of a Path: the start of a curve, or a line,
+// quadratic or cubic Bézier segment continuing it.
+type Segment struct {
+	Op Op
+
+	// P holds the control points of the segment. P[0] is where the
+	// segment begins, the end point of the previous segment, and
+	// P[Op] is where it ends. A start segment has only P[0].
+	P [4]geom.Point
+}
+
+// End returns the final control point of s.
+func (s Segment) End() geom.Point {
+	return s.P[s.Op]
+}
+
+// Point returns the point at t ∈ [0, 1] along s.
+func (s Segment) Point(t geom.Pt) geom.Point {
+	u := 1 - t
+	p := s.P
+	switch s.Op {
+	case OpLine:
+		return geom.Point{u*p[0].X + t*p[1].X, u*p[0].Y + t*p[1].Y}
+	case OpQuadratic:
+		return geom.Point{
+			u*u*p[0].X + 2*u*t*p[1].X + t*t*p[2].X,
+			u*u*p[0].Y + 2*u*t*p[1].Y + t*t*p[2].Y,
+		}
+	case OpCubic:
+		return geom.Point{
+			u*u*u*p[0].X + 3*u*u*t*p[1].X + 3*u*t*t*p[2].X + t*t*t*p[3].X,
+			u*u*u*p[0].Y + 3*u*u*t*p[1].Y + 3*u*t*t*p[2].Y + t*t*t*p[3].Y,
+		}
+	}
+	return p[0]
+}
+
+// Subdivide splits s at t ∈ [0, 1] into two segments of the same kind,
+// using de Casteljau's algorithm.
+func (s Segment) Subdivide(t geom.Pt) (Segment, Segment) {
+	lerp := func(a, b geom.Point) geom.Point {
+		return geom.Point{a.X + (b.X-a.X)*t, a.Y + (b.Y-a.Y)*t}
+	}
+	a, b := Segment{Op: s.Op}, Segment{Op: s.Op}
+	switch s.Op {
+	case OpStart:
+		return s, s
+	case OpLine:
+		m := lerp(s.P[0], s.P[1])
+		a.P[0], a.P[1] = s.P[0], m
+		b.P[0], b.P[1] = m, s.P[1]
+	case OpQuadratic:
+		p01 := lerp(s.P[0], s.P[1])
+		p12 := lerp(s.P[1], s.P[2])
+		m := lerp(p01, p12)
+		a.P[0], a.P[1], a.P[2] = s.P[0], p01, m
+		b.P[0], b.P[1], b.P[2] = m, p12, s.P[2]
+	case OpCubic:
+		p01 := lerp(s.P[0], s.P[1])
+		p12 := lerp(s.P[1], s.P[2])
+		p23 := lerp(s.P[2], s.P[3])
+		p012 := lerp(p01, p12)
+		p123 := lerp(p12, p23)
+		m := lerp(p012, p123)
+		a.P[0], a.P[1], a.P[2], a.P[3] = s.P[0], p01, p012, m
+		b.P[0], b.P[1], b.P[2], b.P[3] = m, p123, p23, s.P[3]
+	}
+	return a, b
+}
+
+// Length returns the arc length of s.
+func (s Segment) Length() geom.Pt {
+	return s.length(0)
+}
+
+func (s Segment) length(depth int) geom.Pt {
+	if s.Op == OpStart {
+		return 0
+	}
+	// The arc length lies between the length of the chord and the
+	// length of the control polygon. Subdivide until they agree.
+	chord := dist(s.P[0], s.End())
+	poly := geom.Pt(0)
+	for i := 0; i < int(s.Op); i++ {
+		poly += dist(s.P[i], s.P[i+1])
+	}
+	if poly-chord <= 1e-3*chord+1e-6 || depth > 16 {
+		return (chord + poly) / 2
+	}
+	a, b := s.Subdivide(0.5)
+	return a.length(depth+1) + b.length(depth+1)
+}
+
+// flatness returns the number of lines needed to approximate s within
+// tolerance. A tolerance of zero or less takes as many as it may.
+func (s Segment) flatness(tolerance geom.Pt) int {
+	const maxLines = 1000
+	// The distance between a curve and the polyline through n evenly
+	// spaced points on it is at most |B''|/(8*n^2).
+	var dd float64
+	switch s.Op {
+	case OpQuadratic:
+		dd = 2 * norm(s.P[0].X-2*s.P[1].X+s.P[2].X, s.P[0].Y-2*s.P[1].Y+s.P[2].Y)
+	case OpCubic:
+		d0 := norm(s.P[0].X-2*s.P[1].X+s.P[2].X, s.P[0].Y-2*s.P[1].Y+s.P[2].Y)
+		d1 := norm(s.P[1].X-2*s.P[2].X+s.P[3].X, s.P[1].Y-2*s.P[2].Y+s.P[3].Y)
+		dd = 6 * math.Max(d0, d1)
+	default:
+		return 1
+	}
+	if dd == 0 {
+		return 1
+	}
+	if !(tolerance > 0) {
+		return maxLines
+	}
+	n := int(math.Ceil(math.Sqrt(dd / (8 * float64(tolerance)))))
+	if n < 1 {
+		n = 1
+	}
+	if n > maxLines {
+		n = maxLines
+	}
+	return n
+}
+
+func norm(x, y geom.Pt) float64 {
+	return math.Hypot(float64(x), float64(y))
+}
+
+func dist(a, b geom.Point) geom.Pt {
+	return geom.Pt(norm(b.X-a.X, b.Y-a.Y))
+}
+
+// A PathIterator steps through the segments of a Path:
+//
+//	for it := p.Iterator(); it.Next(); {
+//		s := it.Segment()
+//		...
+//	}
+type PathIterator struct {
+	p   Path
+	off int // offset of the current segment in p
+	i   int // offset of the next segment in p
+	s   Segment
+}
+
+// Iterator returns a PathIterator positioned before the first segment
+// of p.
+func (p Path) Iterator() *PathIterator {
+	return &PathIterator{p: p}
+}
+
+// Next advances to the next segment, reporting false at the end of the
+// path. It panics if the path is not validly encoded.
+func (it *PathIterator) Next() bool {
+	p, i := it.p, it.i
+	if i >= len(p) {
+		return false
+	}
+	op, n, err := p.segmentAt(i)
+	if err != nil {
+		panic(err.Error())
+	}
+	s := Segment{Op: op}
+	if op != OpStart {
+		s.P[0] = it.s.End()
+	}
+	for j := 0; j < n; j++ {
+		s.P[int(op)-n+1+j] = geom.Point{p[i+1+2*j], p[i+2+2*j]}
+	}
+	it.s = s
+	it.off, it.i = i, i+1+2*n
+	return true
+}
+
+// segmentAt returns the op of the segment encoded at p[i], and the
+// number of points following its tag.
+func (p Path) segmentAt(i int) (op Op, n int, err error) {
+	op = Op(p[i])
+	n = int(op)
+	if op == OpStart {
+		n = 1
+	}
+	if geom.Pt(op) != p[i] || op > OpCubic || i+1+2*n > len(p) {
+		return 0, 0, fmt.Errorf("raster: invalid path, p[%d]=%f", i, p[i])
+	}
+	return op, n, nil
+}
+
+// Validate reports an error if p is not validly encoded, which would
+// make a PathIterator over it panic.
+func (p Path) Validate() error {
+	for i := 0; i < len(p); {
+		_, n, err := p.segmentAt(i)
+		if err != nil {
+			return err
+		}
+		i += 1 + 2*n
+	}
+	return nil
+}
+
+// Segment returns the current segment.
+func (it *PathIterator) Segment() Segment {
+	return it.s
+}
+
+// AddSegment adds s to p. Only the end point of a start segment, and
+// the control points after P[0] of other segments, are used.
+func (p *Path) AddSegment(s Segment) {
+	switch s.Op {
+	case OpStart:
+		p.AddStart(s.P[0])
+	case OpLine:
+		p.AddLine(s.P[1])
+	case OpQuadratic:
+		p.AddQuadratic(s.P[1], s.P[2])
+	case OpCubic:
+		p.AddCubic(s.P[1], s.P[2], s.P[3])
+	default:
+		panic(fmt.Sprintf("raster: invalid segment op %d", s.Op))
+	}
+}
+
+// Transform returns a copy of p with every control point transformed
+// by a. Bézier curves are invariant under affine transformations, so
+// the result is exact.
+func (p Path) Transform(a *f32.Affine) Path {
+	dst := make(Path, 0, len(p))
+	for it := p.Iterator(); it.Next(); {
+		s := it.Segment()
+		for i := range s.P {
+			x, y := float32(s.P[i].X), float32(s.P[i].Y)
+			s.P[i].X = geom.Pt(a[0][0]*x + a[0][1]*y + a[0][2])
+			s.P[i].Y = geom.Pt(a[1][0]*x + a[1][1]*y + a[1][2])
+		}
+		dst.AddSegment(s)
+	}
+	return dst
+}
+
+// subpaths splits p into its curves, each beginning with a start segment.
+func (p Path) subpaths() [][]Segment {
+	var subs [][]Segment
+	for it := p.Iterator(); it.Next(); {
+		s := it.Segment()
+		if s.Op == OpStart || len(subs) == 0 {
+			subs = append(subs, nil)
+		}
+		subs[len(subs)-1] = append(subs[len(subs)-1], s)
+	}
+	return subs
+}
+
+// Reverse returns p traced in the opposite direction: the curves are in
+// reverse order, and each runs from its end to its start.
+func (p Path) Reverse() Path {
+	dst := make(Path, 0, len(p))
+	subs := p.subpaths()
+	for i := len(subs) - 1; i >= 0; i-- {
+		sub := subs[i]
+		dst.AddStart(sub[len(sub)-1].End())
+		for j := len(sub) - 1; j >= 0; j-- {
+			s := sub[j]
+			if s.Op == OpStart {
+				continue
+			}
+			var r Segment
+			r.Op = s.Op
+			for k := 0; k <= int(s.Op); k++ {
+				r.P[k] = s.P[int(s.Op)-k]
+			}
+			dst.AddSegment(r)
+		}
+	}
+	return dst
+}
+
+// Flatten returns p with every curved segment replaced by line
+// segments no further than tolerance from the curve. A tolerance of
+// zero or less flattens as finely as Flatten can.
+func (p Path) Flatten(tolerance geom.Pt) Path {
+	dst := make(Path, 0, len(p))
+	for it := p.Iterator(); it.Next(); {
+		s := it.Segment()
+		switch s.Op {
+		case OpStart, OpLine:
+			dst.AddSegment(s)
+		default:
+			n := s.flatness(tolerance)
+			for i := 1; i < n; i++ {
+				dst.AddLine(s.Point(geom.Pt(i) / geom.Pt(n)))
+			}
+			dst.AddLine(s.End())
+		}
+	}
+	return dst
+}
+
+// Length returns the total arc length of p.
+func (p Path) Length() geom.Pt {
+	var l geom.Pt
+	for it := p.Iterator(); it.Next(); {
+		l += it.Segment().Length()
+	}
+	return l
+}
+
+// Split divides p at the given arc length from its start. The second
+// path begins with a start segment at the point of division. A length
+// outside of the path returns it whole as the first or second path.
+func (p Path) Split(length geom.Pt) (Path, Path) {
+	if length <= 0 {
+		return nil, p
+	}
+	var l geom.Pt
+	for it := p.Iterator(); it.Next(); {
+		s := it.Segment()
+		sl := s.Length()
+		if l+sl < length {
+			l += sl
+			continue
+		}
+
+		// Find t where the segment reaches the target length by
+		// bisection, as arc length is monotonic in t.
+		want := length - l
+		lo, hi := geom.Pt(0), geom.Pt(1)
+		for i := 0; i < 32 && sl > 0; i++ {
+			mid := (lo + hi) / 2
+			a, _ := s.Subdivide(mid)
+			if a.Length() < want {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		a, b := s.Subdivide((lo + hi) / 2)
+
+		first := make(Path, it.off, it.off+1+2*int(s.Op))
+		copy(first, p[:it.off])
+		if s.Op != OpStart {
+			first.AddSegment(a)
+		}
+		second := Path{}
+		second.AddStart(b.P[0])
+		if s.Op != OpStart {
+			second.AddSegment(b)
+		}
+		second = append(second, p[it.i:]...)
+		return first, second
+	}
+	return p, nil
+}
@@ -0,0 +1,193 @@
+package raster
+
+import (
+	"math"
+	"testing"
+
+	"golang.org/x/mobile/f32"
+	"golang.org/x/mobile/geom"
+)
+
+func near(a, b geom.Pt, eps float64) bool {
+	return math.Abs(float64(a-b)) <= eps
+}
+
+func TestPathIterator(t *testing.T) {
+	var p Path
+	p.AddStart(geom.Point{1, 2})
+	p.AddLine(geom.Point{3, 4})
+	p.AddQuadratic(geom.Point{5, 6}, geom.Point{7, 8})
+	p.AddCubic(geom.Point{9, 10}, geom.Point{11, 12}, geom.Point{13, 14})
+
+	want := []Segment{
+		{OpStart, [4]geom.Point{{1, 2}}},
+		{OpLine, [4]geom.Point{{1, 2}, {3, 4}}},
+		{OpQuadratic, [4]geom.Point{{3, 4}, {5, 6}, {7, 8}}},
+		{OpCubic, [4]geom.Point{{7, 8}, {9, 10}, {11, 12}, {13, 14}}},
+	}
+	var got []Segment
+	var q Path
+	for it := p.Iterator(); it.Next(); {
+		got = append(got, it.Segment())
+		q.AddSegment(it.Segment())
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d segments, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("segment %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+	if q.SVG() != p.SVG() {
+		t.Errorf("AddSegment round trip = %q, want %q", q.SVG(), p.SVG())
+	}
+}
+
+func TestPathIteratorInvalid(t *testing.T) {
+	for _, p := range []Path{{4, 0, 0}, {1, 0}, {0.5, 0, 0}, {3, 0, 0, 1, 1}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%v: no panic", p)
+				}
+			}()
+			for it := p.Iterator(); it.Next(); {
+			}
+		}()
+		if p.Validate() == nil {
+			t.Errorf("%v: Validate succeeded", p)
+		}
+	}
+}
+
+func TestPathTransform(t *testing.T) {
+	p, _ := ParseSVGPath("M0 0 L10 0 Q10 10 0 10 C-5 10 -5 0 0 0")
+	var a f32.Affine
+	a.Identity()
+	a.Translate(&a, 5, 7)
+	a.Scale(&a, 2, 3)
+	got := p.Transform(&a).SVG()
+	want := "M5 7 L25 7 Q25 37 5 37 C-5 37 -5 7 5 7"
+	if got != want {
+		t.Errorf("Transform = %q, want %q", got, want)
+	}
+}
+
+func TestPathReverse(t *testing.T) {
+	p, _ := ParseSVGPath("M0 0 L1 0 Q2 0 2 1 M5 5 C6 5 7 6 7 7")
+	got := p.Reverse().SVG()
+	want := "M7 7 C7 6 6 5 5 5 M2 1 Q2 0 1 0 L0 0"
+	if got != want {
+		t.Errorf("Reverse = %q, want %q", got, want)
+	}
+	if got := p.Reverse().Reverse().SVG(); got != p.SVG() {
+		t.Errorf("Reverse twice = %q, want %q", got, p.SVG())
+	}
+}
+
+func TestPathFlatten(t *testing.T) {
+	c := Circle{Center: geom.Point{0, 0}, Radius: 10}
+	for _, tol := range []geom.Pt{1, 0.1, 0.01} {
+		f := c.Path().Flatten(tol)
+		n := 0
+		for it := f.Iterator(); it.Next(); {
+			s := it.Segment()
+			if s.Op != OpStart && s.Op != OpLine {
+				t.Fatalf("tolerance %v: segment op %d", tol, s.Op)
+			}
+			// The midpoint of each chord is its furthest point from
+			// the circle.
+			m := s.Point(0.5)
+			if d := 10 - geom.Pt(math.Hypot(float64(m.X), float64(m.Y))); d > tol*1.05 {
+				t.Errorf("tolerance %v: chord %v is %v from circle", tol, s, d)
+			}
+			n++
+		}
+		t.Logf("tolerance %v: %d segments", tol, n)
+	}
+
+	// No tolerance flattens finely, rather than into chords.
+	fine := segments(c.Path().Flatten(0.001))
+	for _, tol := range []geom.Pt{0, -1, geom.Pt(math.NaN())} {
+		if n := segments(c.Path().Flatten(tol)); n < fine {
+			t.Errorf("tolerance %v: %d segments, want at least %d", tol, n, fine)
+		}
+	}
+}
+
+func TestSegmentSubdivide(t *testing.T) {
+	s := Segment{OpCubic, [4]geom.Point{{0, 0}, {0, 10}, {10, 10}, {10, 0}}}
+	for _, tt := range []geom.Pt{0.25, 0.5, 0.8} {
+		a, b := s.Subdivide(tt)
+		if a.P[0] != s.P[0] || b.End() != s.End() || a.End() != b.P[0] {
+			t.Errorf("Subdivide(%v) = %v, %v: not joined", tt, a, b)
+		}
+		pt := s.Point(tt)
+		if !near(a.End().X, pt.X, 1e-4) || !near(a.End().Y, pt.Y, 1e-4) {
+			t.Errorf("Subdivide(%v) split at %v, want %v", tt, a.End(), pt)
+		}
+		// Halfway along each half is a point on the original curve.
+		for _, u := range []geom.Pt{0, 0.5, 1} {
+			got, want := a.Point(u), s.Point(u*tt)
+			if !near(got.X, want.X, 1e-4) || !near(got.Y, want.Y, 1e-4) {
+				t.Errorf("Subdivide(%v) first half at %v = %v, want %v", tt, u, got, want)
+			}
+		}
+	}
+}
+
+func TestPathLength(t *testing.T) {
+	tests := []struct {
+		d    string
+		want float64
+	}{
+		{"M0 0 L3 4", 5},
+		{"M0 0 L3 4 M10 10 L10 20", 15},
+		{"M0 0 Q5 0 10 0", 10},
+		{"M0 0 C1 1 2 2 3 3", 3 * math.Sqrt2},
+	}
+	for _, test := range tests {
+		p, err := ParseSVGPath(test.d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.Length(); !near(got, geom.Pt(test.want), 1e-3) {
+			t.Errorf("Length(%q) = %v, want %v", test.d, got, test.want)
+		}
+	}
+
+	c := Ellipse{Center: geom.Point{0, 0}, RadiusX: 10, RadiusY: 10}
+	if got, want := c.Path().Length(), geom.Pt(20*math.Pi); !near(got, want, 0.02) {
+		t.Errorf("circle length = %v, want %v", got, want)
+	}
+}
+
+func TestPathSplit(t *testing.T) {
+	p, _ := ParseSVGPath("M0 0 L10 0 L10 10 M20 0 L30 0")
+	a, b := p.Split(15)
+	if got, want := a.SVG(), "M0 0 L10 0 L10 5"; got != want {
+		t.Errorf("first = %q, want %q", got, want)
+	}
+	if got, want := b.SVG(), "M10 5 L10 10 M20 0 L30 0"; got != want {
+		t.Errorf("second = %q, want %q", got, want)
+	}
+
+	a, b = p.Split(100)
+	if a.SVG() != p.SVG() || len(b) != 0 {
+		t.Errorf("Split past end = %q, %q", a.SVG(), b.SVG())
+	}
+	a, b = p.Split(0)
+	if len(a) != 0 || b.SVG() != p.SVG() {
+		t.Errorf("Split at start = %q, %q", a.SVG(), b.SVG())
+	}
+
+	c := (&Circle{Center: geom.Point{0, 0}, Radius: 10}).Path()
+	a, b = c.Split(c.Length() / 4)
+	if got, want := a.Length(), c.Length()/4; !near(got, want, 0.01) {
+		t.Errorf("circle quarter length = %v, want %v", got, want)
+	}
+	if got, want := a.Length()+b.Length(), c.Length(); !near(got, want, 0.01) {
+		t.Errorf("circle halves total %v, want %v", got, want)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"image"
 	"image/color"
+	"image/draw"
 	"math"
 
 	ftraster "code.google.com/p/freetype-go/freetype/raster"
@@ -54,26 +55,20 @@ func fix32ToPt(p ftraster.Fix32) geom.Pt {
 }
 
 func pathToFix(dst ftraster.Adder, src Path) {
-	pt := func(i int) ftraster.Point {
-		return ftraster.Point{ptToFix32(src[i]), ptToFix32(src[i+1])}
+	pt := func(p geom.Point) ftraster.Point {
+		return ftraster.Point{ptToFix32(p.X), ptToFix32(p.Y)}
 	}
-	i := 0
-	for i < len(src) {
-		switch src[i] {
-		case 0:
-			dst.Start(pt(i + 1))
-			i += 3
-		case 1:
-			dst.Add1(pt(i + 1))
-			i += 3
-		case 2:
-			dst.Add2(pt(i+1), pt(i+3))
-			i += 5
-		case 3:
-			dst.Add3(pt(i+1), pt(i+3), pt(i+5))
-			i += 7
-		default:
-			panic(fmt.Sprintf("invalid path, src[%d]=%f", i, src[i]))
+	for it := src.Iterator(); it.Next(); {
+		s := it.Segment()
+		switch s.Op {
+		case OpStart:
+			dst.Start(pt(s.P[0]))
+		case OpLine:
+			dst.Add1(pt(s.P[1]))
+		case OpQuadratic:
+			dst.Add2(pt(s.P[1]), pt(s.P[2]))
+		case OpCubic:
+			dst.Add3(pt(s.P[1]), pt(s.P[2]), pt(s.P[3]))
 		}
 	}
 }
@@ -153,7 +148,7 @@ func fix32PointToPoint(p ftraster.Point) geom.Point {
 func (s *Stroke) Path() Path {
 	// TODO: implement Stroke directly on geom.Pt?
 	dst := ftraster.Path{}
-	srcFix := s.Shape.Path()
+	srcFix := s.Shape.Path().quadratics()
 	src := make(ftraster.Path, 0, len(srcFix))
 	pathToFix(&src, srcFix)
 
@@ -169,19 +164,78 @@ func (s *Stroke) Path() Path {
 	return fixToPath(dst)
 }
 
+// quadratics returns p with each cubic segment approximated by a
+// sequence of quadratic segments. The freetype stroker does not
+// support cubics.
+func (p Path) quadratics() Path {
+	dst := make(Path, 0, len(p))
+	for it := p.Iterator(); it.Next(); {
+		s := it.Segment()
+		if s.Op == OpCubic {
+			dst.addCubicAsQuadratics(s.P[0], s.P[1], s.P[2], s.P[3])
+		} else {
+			dst.AddSegment(s)
+		}
+	}
+	return dst
+}
+
+func (p *Path) addCubicAsQuadratics(n0, n1, n2, n3 geom.Point) {
+	// The distance between a cubic and the quadratic with control
+	// point (3*(n1+n2) - n0 - n3)/4 is at most
+	//
+	//	sqrt(3)/36 * |n3 - 3*n2 + 3*n1 - n0|
+	//
+	// and splitting the cubic into k pieces divides the error by k^3.
+	// Aim for an error below a tenth of a pixel.
+	dx := float64(n3.X - 3*n2.X + 3*n1.X - n0.X)
+	dy := float64(n3.Y - 3*n2.Y + 3*n1.Y - n0.Y)
+	err := math.Sqrt(3) / 36 * math.Hypot(dx, dy)
+	tol := 0.1 / float64(geom.PixelsPerPt)
+	k := int(math.Ceil(math.Cbrt(err / tol)))
+	if k < 1 {
+		k = 1
+	}
+	if k > 16 {
+		k = 16
+	}
+
+	at := func(t geom.Pt) (b, d geom.Point) {
+		u := 1 - t
+		b.X = u*u*u*n0.X + 3*u*u*t*n1.X + 3*u*t*t*n2.X + t*t*t*n3.X
+		b.Y = u*u*u*n0.Y + 3*u*u*t*n1.Y + 3*u*t*t*n2.Y + t*t*t*n3.Y
+		d.X = 3*u*u*(n1.X-n0.X) + 6*u*t*(n2.X-n1.X) + 3*t*t*(n3.X-n2.X)
+		d.Y = 3*u*u*(n1.Y-n0.Y) + 6*u*t*(n2.Y-n1.Y) + 3*t*t*(n3.Y-n2.Y)
+		return b, d
+	}
+	h := 1 / geom.Pt(k)
+	b0, d0 := at(0)
+	for j := 1; j <= k; j++ {
+		b1, d1 := at(geom.Pt(j) * h)
+		if j == k {
+			b1 = n3
+		}
+		// Control points of the cubic covering [t0, t1].
+		c1 := geom.Point{b0.X + d0.X*h/3, b0.Y + d0.Y*h/3}
+		c2 := geom.Point{b1.X - d1.X*h/3, b1.Y - d1.Y*h/3}
+		p.AddQuadratic(geom.Point{
+			(3*(c1.X+c2.X) - b0.X - b1.X) / 4,
+			(3*(c1.Y+c2.Y) - b0.Y - b1.Y) / 4,
+		}, b1)
+		b0, d0 = b1, d1
+	}
+}
+
 type Circle struct {
-	//Center geom.Point
+	Center geom.Point
 	Radius geom.Pt
 }
 
+// Contains reports whether p is inside the circle.
 func (c *Circle) Contains(p geom.Point) bool {
-	/*
-		TODO
-		x := p.X - c.Center.X
-		y := p.Y - c.Center.Y
-		return x*x+y*y < c.Radius*c.Radius
-	*/
-	return false
+	x := p.X - c.Center.X
+	y := p.Y - c.Center.Y
+	return x*x+y*y < c.Radius*c.Radius
 }
 
 func (c *Circle) Path() (p Path) {
@@ -212,8 +266,7 @@ func (c *Circle) Path() (p Path) {
 	x1 := geom.Pt(math.Cos(math.Pi/4)) * c.Radius
 	x2 := geom.Pt(math.Tan(math.Pi/8)) * c.Radius
 
-	// TODO: find a rational foundation for this +1 business.
-	cx, cy := c.Radius+1, c.Radius+1
+	cx, cy := c.Center.X, c.Center.Y
 
 	p.AddStart(
 		geom.Point{cx, cy - c.Radius}, // N
@@ -253,9 +306,15 @@ func (c *Circle) Path() (p Path) {
 	return p
 }
 
-// TODO: rounded corners (i.e. css border-radius)?
+// A Rectangle is an axis-aligned rectangle. For rounded corners, see
+// RoundedRectangle.
 type Rectangle geom.Rectangle
 
+// Contains reports whether p is inside the rectangle.
+func (r *Rectangle) Contains(p geom.Point) bool {
+	return r.Min.X <= p.X && p.X < r.Max.X && r.Min.Y <= p.Y && p.Y < r.Max.Y
+}
+
 func (r *Rectangle) Path() (p Path) {
 	topRight := r.Min
 	topRight.X = r.Max.X
@@ -275,62 +334,32 @@ type Drawable struct {
 	Color color.Color // TODO mask? so many possibilities
 }
 
-type painter struct {
-	dst *image.RGBA
-	src image.Image
-}
-
-func (r *painter) Paint(spans []ftraster.Span, done bool) {
-	b := r.dst.Bounds()
-	for _, s := range spans {
-		if s.Y < b.Min.Y {
-			continue
-		}
-		if s.Y >= b.Max.Y {
-			return
-		}
-		if s.X0 < b.Min.X {
-			s.X0 = b.Min.X
-		}
-		if s.X1 > b.Max.X {
-			s.X1 = b.Max.X
-		}
-		if s.X0 >= s.X1 {
-			continue
-		}
-		// See $GOROOT/pkg/image/draw/draw.go drawCopyOver
-		i0 := (s.Y-r.dst.Rect.Min.Y)*r.dst.Stride + (s.X0-r.dst.Rect.Min.X)*4
-		i1 := i0 + (s.X1-s.X0)*4
-		for i := i0; i < i1; i += 4 {
-			sr, sg, sb, sa := r.src.At(s.Y, s.X0+(i-i0)/4).RGBA()
-
-			dr := uint32(r.dst.Pix[i+0])
-			dg := uint32(r.dst.Pix[i+1])
-			db := uint32(r.dst.Pix[i+2])
-			da := uint32(r.dst.Pix[i+3])
-
-			// TODO all wrong
-			const m = 1<<16 - 1
-			ma := uint32(1)
-			ca := uint32(1)
-			a := (m - (ca * ma / m)) * 0x101
-			r.dst.Pix[i+0] = uint8((dr*a/m + sr) >> 8)
-			r.dst.Pix[i+1] = uint8((dg*a/m + sg) >> 8)
-			r.dst.Pix[i+2] = uint8((db*a/m + sb) >> 8)
-			r.dst.Pix[i+3] = uint8((da*a/m + sa) >> 8)
-		}
-
-	}
+// Draw composites src over dst wherever path covers it, antialiased.
+// The path is relative to the top-left corner of dst, and src is read
+// at the same pixels as dst. As in image/draw, colors are
+// premultiplied.
+func Draw(dst *image.RGBA, src image.Image, path Path) {
+	b := dst.Bounds()
+	mask := image.NewAlpha(b)
+	DrawAlpha(mask, path)
+	draw.DrawMask(dst, b, src, b.Min, mask, b.Min, draw.Over)
 }
 
-// Draw is a portable implementation of vector rasterization.
-func Draw(dst *image.RGBA, src image.Image, path Path) {
-	//d *Drawable) {
-	p := &painter{dst, src}
+// DrawAlpha adds the coverage of path to dst.
+func DrawAlpha(dst *image.Alpha, path Path) {
 	b := dst.Bounds()
+	p := ftraster.NewAlphaOverPainter(dst)
 	r := ftraster.NewRasterizer(b.Dx(), b.Dy())
 	r.UseNonZeroWinding = true
 
 	pathToFix(r, path)
-	r.Rasterize(p)
+	r.Rasterize(ftraster.PainterFunc(func(spans []ftraster.Span, done bool) {
+		// Spans are relative to the top-left corner of dst.
+		for i := range spans {
+			spans[i].Y += b.Min.Y
+			spans[i].X0 += b.Min.X
+			spans[i].X1 += b.Min.X
+		}
+		p.Paint(spans, done)
+	}))
 }
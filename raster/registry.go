@@ -0,0 +1,136 @@
+package raster
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+
+	"github.com/crawshaw/sprite"
+)
+
+// A Registry assigns sprite.Curve handles to paths, for engines to
+// implement LoadCurve and UnloadCurve.
+//
+// Loading a path identical to one already loaded returns the same
+// handle and counts a reference to it. A handle remains valid until it
+// has been unloaded as many times as it was loaded. Paths are only
+// stored, engines rasterize them as they are drawn.
+type Registry struct {
+	curves map[sprite.Curve]*registered
+	byHash map[uint64][]sprite.Curve
+	next   sprite.Curve
+}
+
+type registered struct {
+	path Path
+	hash uint64
+	refs int
+}
+
+// Load returns a handle for p, and counts a reference to it. It reports
+// an error if p is not validly encoded, as the path is only rasterized
+// when it is drawn.
+func (r *Registry) Load(p Path) (sprite.Curve, error) {
+	if err := p.Validate(); err != nil {
+		return 0, err
+	}
+	if r.curves == nil {
+		r.curves = make(map[sprite.Curve]*registered)
+		r.byHash = make(map[uint64][]sprite.Curve)
+	}
+	h := hashPath(p)
+	for _, c := range r.byHash[h] {
+		if reg := r.curves[c]; equalPaths(reg.path, p) {
+			reg.refs++
+			return c, nil
+		}
+	}
+	if r.next == math.MaxInt32 {
+		return 0, fmt.Errorf("raster: out of curve handles")
+	}
+	r.next++
+	c := r.next
+	// The caller may reuse its slice.
+	r.curves[c] = &registered{path: append(Path(nil), p...), hash: h, refs: 1}
+	r.byHash[h] = append(r.byHash[h], c)
+	return c, nil
+}
+
+// Unload drops a reference to c. It reports whether that was the last
+// reference, so that the engine can forget anything it has cached for
+// the curve. Unloading a handle that is not loaded panics.
+func (r *Registry) Unload(c sprite.Curve) bool {
+	reg := r.curves[c]
+	if reg == nil {
+		panic(fmt.Sprintf("raster: Unload of curve %d, which is not loaded", c))
+	}
+	reg.refs--
+	if reg.refs > 0 {
+		return false
+	}
+	delete(r.curves, c)
+	cs := r.byHash[reg.hash]
+	for i, c1 := range cs {
+		if c1 == c {
+			cs = append(cs[:i], cs[i+1:]...)
+			break
+		}
+	}
+	if len(cs) == 0 {
+		delete(r.byHash, reg.hash)
+	} else {
+		r.byHash[reg.hash] = cs
+	}
+	return true
+}
+
+// Path returns the path of c, or nil if c is not loaded.
+func (r *Registry) Path(c sprite.Curve) Path {
+	if reg := r.curves[c]; reg != nil {
+		return reg.path
+	}
+	return nil
+}
+
+// Len returns the number of loaded curves.
+func (r *Registry) Len() int {
+	return len(r.curves)
+}
+
+// Close reports an error listing the curves that are still loaded.
+// Engines call it when they are released, to find leaked handles.
+func (r *Registry) Close() error {
+	if len(r.curves) == 0 {
+		return nil
+	}
+	leaked := make([]int, 0, len(r.curves))
+	for c := range r.curves {
+		leaked = append(leaked, int(c))
+	}
+	sort.Ints(leaked)
+	return fmt.Errorf("raster: %d curves not unloaded: %v", len(leaked), leaked)
+}
+
+func hashPath(p Path) uint64 {
+	h := fnv.New64a()
+	var b [4]byte
+	for _, v := range p {
+		u := math.Float32bits(float32(v))
+		b[0], b[1], b[2], b[3] = byte(u), byte(u>>8), byte(u>>16), byte(u>>24)
+		h.Write(b[:])
+	}
+	return h.Sum64()
+}
+
+func equalPaths(p, q Path) bool {
+	if len(p) != len(q) {
+		return false
+	}
+	for i := range p {
+		if p[i] != q[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+package raster
+
+import (
+	"image"
+	"image/draw"
+	"reflect"
+	"testing"
+
+	"github.com/crawshaw/sprite"
+)
+
+func TestRegistry(t *testing.T) {
+	var r Registry
+	p := rectPath(10, 10)
+	a, err := r.Load(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := r.Load(rectPath(10, 10))
+	if a != b {
+		t.Errorf("identical paths loaded as %d and %d", a, b)
+	}
+	c, _ := r.Load(rectPath(10, 20))
+	if c == a {
+		t.Errorf("different paths loaded as %d", c)
+	}
+	if r.Len() != 2 {
+		t.Errorf("Len = %d, want 2", r.Len())
+	}
+
+	// The registry keeps its own copy of the path.
+	p[3] = 99
+	if got := r.Path(a); !equalPaths(got, rectPath(10, 10)) {
+		t.Errorf("Path(%d) = %v, changed by the caller", a, got)
+	}
+
+	if r.Unload(a) {
+		t.Error("first Unload of a curve loaded twice was the last")
+	}
+	if r.Path(a) == nil {
+		t.Error("curve gone while referenced")
+	}
+	if !r.Unload(a) {
+		t.Error("second Unload was not the last")
+	}
+	if r.Path(a) != nil {
+		t.Error("curve still loaded after its last Unload")
+	}
+	d, _ := r.Load(rectPath(10, 10))
+	if d == a {
+		t.Errorf("reloaded curve reused handle %d", a)
+	}
+
+	err = r.Close()
+	if err == nil {
+		t.Fatal("Close reported no leaks")
+	}
+	if got, want := err.Error(), "raster: 2 curves not unloaded: [2 3]"; got != want {
+		t.Errorf("Close error %q, want %q", got, want)
+	}
+	r.Unload(c)
+	r.Unload(d)
+	if err := r.Close(); err != nil {
+		t.Errorf("Close after unloading everything: %v", err)
+	}
+}
+
+func TestRegistryInvalid(t *testing.T) {
+	var r Registry
+	for _, p := range []Path{{4, 0, 0}, {0, 0, 0, 2, 1, 1}} {
+		if _, err := r.Load(p); err == nil {
+			t.Errorf("Load(%v) succeeded", p)
+		}
+	}
+	if n := r.Len(); n != 0 {
+		t.Errorf("Len = %d, want 0", n)
+	}
+}
+
+func TestRegistryUnloadPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic")
+		}
+	}()
+	var r Registry
+	r.Unload(sprite.Curve(7))
+}
+
+func TestCacheRemove(t *testing.T) {
+	c := &Cache{Pages: []draw.Image{image.NewAlpha(image.Rect(0, 0, 64, 64))}}
+	c.Get(1, rectPath(10, 10), 1, 0)
+	c.Get(1, rectPath(10, 10), 2, 0)
+	c.Get(2, rectPath(10, 10), 1, 0)
+	c.Remove(1)
+	if got := cached(c); !reflect.DeepEqual(got, []sprite.Curve{2}) {
+		t.Errorf("cached after Remove(1) = %v, want [2]", got)
+	}
+}
@@ -0,0 +1,318 @@
+package raster
+
+import (
+	"image"
+	"math"
+
+	"golang.org/x/mobile/geom"
+)
+
+// Signed distance fields record, for each pixel, the distance from
+// its center to the nearest edge of a shape. Drawn with a threshold at
+// the edge, a distance field stays sharp when scaled far beyond its
+// resolution, and outlines and glows come from other thresholds.
+//
+// Distances are positive inside the shape. They are stored in a color
+// channel by mapping [-spread, spread] pixels onto [0, 255], so 128 is
+// on the edge and distances beyond spread are clamped.
+
+// SDF draws the signed distance field of the region filled by p into
+// dst, with the same placement as Draw.
+func SDF(dst *image.Gray, p Path, spread float32) {
+	segs := sdfSegments(p)
+	b := dst.Bounds()
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			pt := vec{float64(x) + 0.5, float64(y) + 0.5}
+			d := trueDistance(segs, pt)
+			dst.Pix[y*dst.Stride+x] = encodeDistance(d, spread)
+		}
+	}
+}
+
+// MSDF draws a multi-channel signed distance field of the region
+// filled by p into dst, with the same placement as Draw.
+//
+// The edges of p are split at corners and given colors so that the
+// edges meeting at a corner share only one of the red, green and blue
+// channels. Each channel is the distance to the edges of its colors,
+// and the median of the three is a distance field that keeps corners
+// sharp. The alpha channel holds the true distance, as drawn by SDF.
+//
+// See Viktor Chlumský, "Shape Decomposition for Multi-channel Distance
+// Fields", 2015.
+func MSDF(dst *image.RGBA, p Path, spread float32) {
+	segs := sdfSegments(p)
+	b := dst.Bounds()
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			pt := vec{float64(x) + 0.5, float64(y) + 0.5}
+			off := y*dst.Stride + x*4
+			for c := uint8(0); c < 3; c++ {
+				d := pseudoDistance(segs, pt, 1<<c)
+				dst.Pix[off+int(c)] = encodeDistance(d, spread)
+			}
+			dst.Pix[off+3] = encodeDistance(trueDistance(segs, pt), spread)
+		}
+	}
+}
+
+// AlphaSDF draws into dst the signed distance field of the shape made
+// by the pixels of src that are at least half opaque. The pixels of
+// dst and src correspond from the top-left of each.
+func AlphaSDF(dst *image.Gray, src image.Image, spread float32) {
+	sb, b := src.Bounds(), dst.Bounds()
+	w, h := b.Dx(), b.Dy()
+	in := make([]bool, w*h)
+	for y := 0; y < h && y < sb.Dy(); y++ {
+		for x := 0; x < w && x < sb.Dx(); x++ {
+			_, _, _, a := src.At(sb.Min.X+x, sb.Min.Y+y).RGBA()
+			in[y*w+x] = a >= 0x8000
+		}
+	}
+	toOut := distanceTransform(in, w, h, true)
+	toIn := distanceTransform(in, w, h, false)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := y*w + x
+			// The edge runs halfway between pixel centers.
+			var d float64
+			if in[i] {
+				d = math.Sqrt(toOut[i]) - 0.5
+			} else {
+				d = 0.5 - math.Sqrt(toIn[i])
+			}
+			dst.Pix[y*dst.Stride+x] = encodeDistance(d, spread)
+		}
+	}
+}
+
+func encodeDistance(d float64, spread float32) uint8 {
+	v := 0.5 + d/(2*float64(spread))
+	if v <= 0 {
+		return 0
+	}
+	if v >= 1 {
+		return 255
+	}
+	return uint8(v*255 + 0.5)
+}
+
+// distanceTransform returns the squared distance from each pixel to
+// the nearest pixel whose in value is not target, or 0 for those
+// pixels themselves. It is the separable exact transform of
+// Felzenszwalb and Huttenlocher, "Distance Transforms of Sampled
+// Functions", 2012.
+func distanceTransform(in []bool, w, h int, target bool) []float64 {
+	const inf = 1e20
+	f := make([]float64, w*h)
+	for i, v := range in {
+		if v == target {
+			f[i] = inf
+		}
+	}
+	n := w
+	if h > n {
+		n = h
+	}
+	col := make([]float64, n)
+	out := make([]float64, n)
+	v := make([]int, n)
+	z := make([]float64, n+1)
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			col[y] = f[y*w+x]
+		}
+		dt1(col[:h], out[:h], v, z)
+		for y := 0; y < h; y++ {
+			f[y*w+x] = out[y]
+		}
+	}
+	for y := 0; y < h; y++ {
+		dt1(f[y*w:(y+1)*w], out[:w], v, z)
+		copy(f[y*w:(y+1)*w], out[:w])
+	}
+	return f
+}
+
+// dt1 is the one-dimensional squared distance transform of f.
+func dt1(f, d []float64, v []int, z []float64) {
+	n := len(f)
+	k := 0
+	v[0] = 0
+	z[0] = math.Inf(-1)
+	z[1] = math.Inf(1)
+	for q := 1; q < n; q++ {
+		s := ((f[q] + float64(q*q)) - (f[v[k]] + float64(v[k]*v[k]))) / float64(2*q-2*v[k])
+		for s <= z[k] {
+			k--
+			s = ((f[q] + float64(q*q)) - (f[v[k]] + float64(v[k]*v[k]))) / float64(2*q-2*v[k])
+		}
+		k++
+		v[k] = q
+		z[k] = s
+		z[k+1] = math.Inf(1)
+	}
+	k = 0
+	for q := 0; q < n; q++ {
+		for z[k+1] < float64(q) {
+			k++
+		}
+		dq := float64(q - v[k])
+		d[q] = dq*dq + f[v[k]]
+	}
+}
+
+// An sdfSegment is a line on the outline of a shape, in pixels, with
+// the shape on its left.
+type sdfSegment struct {
+	a, b             vec
+	color            uint8 // channel bits: 1 red, 2 green, 4 blue
+	cornerA, cornerB bool  // whether each end is a corner
+}
+
+// sdfSegments returns the outline of the region p fills, split into
+// colored edges for MSDF.
+func sdfSegments(p Path) []sdfSegment {
+	const (
+		cyan    = 6
+		magenta = 5
+		yellow  = 3
+		white   = 7
+	)
+	// Directions turning by more than this are corners. The outline
+	// is flattened, so smooth curves turn by small angles.
+	const cornerCos = 0.6
+
+	scale := float64(geom.PixelsPerPt) / gridScale
+	var segs []sdfSegment
+	for _, loop := range region(p, nil, func(w, _ int) bool { return w != 0 }) {
+		n := len(loop)
+		ls := make([]sdfSegment, n)
+		for i, g := range loop {
+			h := loop[(i+1)%n]
+			ls[i].a = vec{float64(g.x) * scale, float64(g.y) * scale}
+			ls[i].b = vec{float64(h.x) * scale, float64(h.y) * scale}
+		}
+		var corners []int // indexes of segments starting at a corner
+		for i := range ls {
+			prev := ls[(i+n-1)%n]
+			if prev.b.sub(prev.a).unit().dot(ls[i].b.sub(ls[i].a).unit()) < cornerCos {
+				corners = append(corners, i)
+				ls[i].cornerA = true
+				ls[(i+n-1)%n].cornerB = true
+			}
+		}
+
+		switch {
+		case len(corners) == 0 || len(corners) == 1 && n < 3:
+			for i := range ls {
+				ls[i].color = white
+			}
+		case len(corners) == 1:
+			// Split the one edge in three so the corner still has
+			// edges of different colors.
+			c := corners[0]
+			for j := 0; j < n; j++ {
+				ls[(c+j)%n].color = [...]uint8{cyan, magenta, yellow}[j*3/n]
+			}
+		default:
+			k := len(corners)
+			for e := 0; e < k; e++ {
+				color := [...]uint8{cyan, magenta, yellow}[e%3]
+				if e == k-1 && k%3 == 1 {
+					// Avoid the same color on both sides of the
+					// first corner.
+					color = magenta
+				}
+				for i, end := corners[e], corners[(e+1)%k]; ; {
+					ls[i].color = color
+					if i = (i + 1) % n; i == end {
+						break
+					}
+				}
+			}
+		}
+		segs = append(segs, ls...)
+	}
+	return segs
+}
+
+// nearest returns the parameter of the projection of p onto the line
+// through s, and the distance from p to the closest point of s.
+func (s *sdfSegment) nearest(p vec) (float64, float64) {
+	d := s.b.sub(s.a)
+	t := 0.0
+	if l := d.dot(d); l > 0 {
+		t = p.sub(s.a).dot(d) / l
+	}
+	c := math.Max(0, math.Min(1, t))
+	return t, s.a.add(d.scale(c)).sub(p).len()
+}
+
+// side returns a positive number if p is on the left of s.
+func (s *sdfSegment) side(p vec) float64 {
+	d := s.b.sub(s.a)
+	q := p.sub(s.a)
+	return d.x*q.y - d.y*q.x
+}
+
+// trueDistance returns the signed distance from p to the outline segs.
+func trueDistance(segs []sdfSegment, p vec) float64 {
+	best := math.Inf(1)
+	w := 0
+	for i := range segs {
+		s := &segs[i]
+		if _, d := s.nearest(p); d < best {
+			best = d
+		}
+		// Non-zero winding, as in the winding function.
+		if s.a.y <= p.y {
+			if s.b.y > p.y && s.side(p) > 0 {
+				w++
+			}
+		} else if s.b.y <= p.y && s.side(p) < 0 {
+			w--
+		}
+	}
+	if w == 0 {
+		return -best
+	}
+	return best
+}
+
+// pseudoDistance returns the signed distance from p to the nearest
+// segment with the given color bit. Beyond a corner, the distance is
+// to the line extending the segment, which keeps the field of a
+// channel straight where its edges meet other channels' edges.
+func pseudoDistance(segs []sdfSegment, p vec, color uint8) float64 {
+	var best *sdfSegment
+	bestD, bestOrtho, bestT := math.Inf(1), 0.0, 0.0
+	for i := range segs {
+		s := &segs[i]
+		if s.color&color == 0 {
+			continue
+		}
+		t, d := s.nearest(p)
+		if d > bestD+1e-9 {
+			continue
+		}
+		// Break ties at shared ends in favor of the segment that p is
+		// most squarely to the side of.
+		ortho := math.Abs(s.side(p)) / (s.b.sub(s.a).len()*d + 1e-12)
+		if d < bestD-1e-9 || ortho > bestOrtho {
+			best, bestD, bestOrtho, bestT = s, d, ortho, t
+		}
+	}
+	if best == nil {
+		return -math.MaxFloat32
+	}
+	d := bestD
+	if bestT < 0 && best.cornerA || bestT > 1 && best.cornerB {
+		d = math.Abs(best.side(p)) / best.b.sub(best.a).len()
+	}
+	if best.side(p) < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,111 @@
+package raster
+
+import (
+	"image"
+	"math"
+	"testing"
+
+	"golang.org/x/mobile/geom"
+)
+
+func decodeDistance(v uint8, spread float32) float64 {
+	return (float64(v)/255 - 0.5) * 2 * float64(spread)
+}
+
+func median3(a, b, c uint8) uint8 {
+	if a > b {
+		a, b = b, a
+	}
+	if b > c {
+		b = c
+	}
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func TestSDF(t *testing.T) {
+	geom.PixelsPerPt = 1
+	square := mustParse(t, "M8 8 H24 V24 H8 Z")
+	m := image.NewGray(image.Rect(0, 0, 32, 32))
+	SDF(m, square, 8)
+
+	tests := []struct {
+		x, y int
+		d    float64
+	}{
+		{16, 16, 7.5},
+		{12, 16, 4.5},
+		{8, 16, 0.5},
+		{7, 16, -0.5},
+		{3, 16, -4.5},
+		{4, 4, -math.Sqrt(2 * 3.5 * 3.5)},
+		{0, 0, -11}, // clamped at the spread
+	}
+	for _, test := range tests {
+		got := decodeDistance(m.GrayAt(test.x, test.y).Y, 8)
+		want := math.Max(-8, math.Min(8, test.d))
+		if math.Abs(got-want) > 0.1 {
+			t.Errorf("distance at (%d, %d) = %v, want %v", test.x, test.y, got, want)
+		}
+	}
+}
+
+func TestMSDF(t *testing.T) {
+	geom.PixelsPerPt = 1
+	shapes := map[string]Path{
+		"square":   mustParse(t, "M8 8 H24 V24 H8 Z"),
+		"triangle": mustParse(t, "M16 4 L28 26 L4 26 Z"),
+		"circle":   (&Circle{Center: geom.Point{16, 16}, Radius: 10}).Path(),
+		"ring":     mustParse(t, "M4 4 H28 V28 H4 Z M10 10 V22 H22 V10 Z"),
+	}
+	for name, p := range shapes {
+		m := image.NewRGBA(image.Rect(0, 0, 32, 32))
+		MSDF(m, p, 4)
+		in := inside(p)
+		for y := 0; y < 32; y++ {
+			for x := 0; x < 32; x++ {
+				c := m.RGBAAt(x, y)
+				d := decodeDistance(median3(c.R, c.G, c.B), 4)
+				true := decodeDistance(c.A, 4)
+				px, py := float64(x)+0.5, float64(y)+0.5
+				if math.Abs(true) > 0.3 && (d > 0) != in(px, py) {
+					t.Errorf("%s: (%d, %d) median distance %v, inside %v", name, x, y, d, in(px, py))
+				}
+				// The median is a pseudo-distance, equal to the true
+				// distance near edges but not beyond corners.
+				if math.Abs(true) < 2 && math.Abs(d-true) > 0.75 {
+					t.Errorf("%s: (%d, %d) median distance %v, true distance %v", name, x, y, d, true)
+				}
+			}
+		}
+	}
+}
+
+func TestAlphaSDF(t *testing.T) {
+	src := image.NewAlpha(image.Rect(10, 10, 42, 42))
+	for y := 18; y < 34; y++ {
+		for x := 18; x < 34; x++ {
+			src.Pix[src.PixOffset(x, y)] = 0xff
+		}
+	}
+	m := image.NewGray(image.Rect(0, 0, 32, 32))
+	AlphaSDF(m, src, 8)
+	tests := []struct {
+		x, y int
+		d    float64
+	}{
+		{8, 16, 0.5},
+		{7, 16, -0.5},
+		{12, 16, 4.5},
+		{2, 16, -5.5},
+		{4, 4, -math.Sqrt(2*4*4) + 0.5},
+	}
+	for _, test := range tests {
+		got := decodeDistance(m.GrayAt(test.x, test.y).Y, 8)
+		if math.Abs(got-test.d) > 0.1 {
+			t.Errorf("distance at (%d, %d) = %v, want %v", test.x, test.y, got, test.d)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package raster
+
+import (
+	"math"
+
+	"golang.org/x/mobile/geom"
+)
+
+// Angles used by shapes are in radians, measured from the positive
+// x-axis towards the positive y-axis. As the y-axis points down,
+// positive angles turn clockwise on the screen.
+
+// An Ellipse is an axis-aligned ellipse.
+type Ellipse struct {
+	Center           geom.Point
+	RadiusX, RadiusY geom.Pt
+}
+
+// Contains reports whether p is inside the ellipse.
+func (e *Ellipse) Contains(p geom.Point) bool {
+	return inEllipse(e.Center, e.RadiusX, e.RadiusY, p)
+}
+
+func (e *Ellipse) Path() (p Path) {
+	p.AddStart(geom.Point{e.Center.X + e.RadiusX, e.Center.Y})
+	addEllipticalArc(&p, e.Center, e.RadiusX, e.RadiusY, 0, 2*math.Pi)
+	return p
+}
+
+// An Arc is a section of the outline of an Ellipse, running from the
+// angle Start for Sweep radians. A negative Sweep runs anti-clockwise.
+//
+// When filled, an Arc is closed by the chord between its end points.
+type Arc struct {
+	Center           geom.Point
+	RadiusX, RadiusY geom.Pt
+	Start, Sweep     float32
+}
+
+// Contains reports whether p is inside the area enclosed by the arc
+// and its chord.
+func (a *Arc) Contains(p geom.Point) bool {
+	if !inEllipse(a.Center, a.RadiusX, a.RadiusY, p) {
+		return false
+	}
+	if math.Abs(float64(a.Sweep)) >= 2*math.Pi {
+		return true
+	}
+	// p must be on the same side of the chord as the arc.
+	p0 := ellipsePoint(a.Center, a.RadiusX, a.RadiusY, float64(a.Start))
+	p1 := ellipsePoint(a.Center, a.RadiusX, a.RadiusY, float64(a.Start+a.Sweep))
+	mid := ellipsePoint(a.Center, a.RadiusX, a.RadiusY, float64(a.Start+a.Sweep/2))
+	return side(p0, p1, p)*side(p0, p1, mid) >= 0
+}
+
+func (a *Arc) Path() (p Path) {
+	p.AddStart(ellipsePoint(a.Center, a.RadiusX, a.RadiusY, float64(a.Start)))
+	addEllipticalArc(&p, a.Center, a.RadiusX, a.RadiusY, float64(a.Start), float64(a.Sweep))
+	return p
+}
+
+// A Pie is an Arc closed through the center of its ellipse, a slice of
+// a pie chart.
+type Pie Arc
+
+// Contains reports whether p is inside the slice.
+func (s *Pie) Contains(p geom.Point) bool {
+	if !inEllipse(s.Center, s.RadiusX, s.RadiusY, p) {
+		return false
+	}
+	sweep := float64(s.Sweep)
+	if math.Abs(sweep) >= 2*math.Pi {
+		return true
+	}
+	// The angle of p on the unit circle the ellipse is scaled from.
+	x := float64(p.X-s.Center.X) / float64(s.RadiusX)
+	y := float64(p.Y-s.Center.Y) / float64(s.RadiusY)
+	d := math.Atan2(y, x) - float64(s.Start)
+	if sweep < 0 {
+		d, sweep = -d, -sweep
+	}
+	d = math.Mod(d, 2*math.Pi)
+	if d < 0 {
+		d += 2 * math.Pi
+	}
+	return d <= sweep
+}
+
+func (s *Pie) Path() (p Path) {
+	p.AddStart(s.Center)
+	p.AddLine(ellipsePoint(s.Center, s.RadiusX, s.RadiusY, float64(s.Start)))
+	addEllipticalArc(&p, s.Center, s.RadiusX, s.RadiusY, float64(s.Start), float64(s.Sweep))
+	p.AddLine(s.Center)
+	return p
+}
+
+// A RoundedRectangle is a rectangle with circular corners, as with
+// the CSS border-radius property.
+type RoundedRectangle struct {
+	Rect geom.Rectangle
+
+	// Radius of each corner, clockwise from the top-left.
+	// Radii too large to fit the rectangle are scaled down
+	// proportionally.
+	Radius [4]geom.Pt
+}
+
+// radii returns the corner radii, scaled to fit the rectangle.
+func (r *RoundedRectangle) radii() [4]geom.Pt {
+	rad := r.Radius
+	for i := range rad {
+		if rad[i] < 0 {
+			rad[i] = 0
+		}
+	}
+	w := r.Rect.Max.X - r.Rect.Min.X
+	h := r.Rect.Max.Y - r.Rect.Min.Y
+	scale := geom.Pt(1)
+	fit := func(length, r0, r1 geom.Pt) {
+		if r0+r1 > length && r0+r1 > 0 {
+			if s := length / (r0 + r1); s < scale {
+				scale = s
+			}
+		}
+	}
+	fit(w, rad[0], rad[1])
+	fit(h, rad[1], rad[2])
+	fit(w, rad[2], rad[3])
+	fit(h, rad[3], rad[0])
+	for i := range rad {
+		rad[i] *= scale
+	}
+	return rad
+}
+
+// Contains reports whether p is inside the rounded rectangle.
+func (r *RoundedRectangle) Contains(p geom.Point) bool {
+	min, max := r.Rect.Min, r.Rect.Max
+	if p.X < min.X || p.X >= max.X || p.Y < min.Y || p.Y >= max.Y {
+		return false
+	}
+	rad := r.radii()
+	corners := [4]geom.Point{
+		{min.X + rad[0], min.Y + rad[0]},
+		{max.X - rad[1], min.Y + rad[1]},
+		{max.X - rad[2], max.Y - rad[2]},
+		{min.X + rad[3], max.Y - rad[3]},
+	}
+	for i, c := range corners {
+		// Is p in the square cut out of corner i?
+		outX := (i == 0 || i == 3) && p.X < c.X || (i == 1 || i == 2) && p.X > c.X
+		outY := (i == 0 || i == 1) && p.Y < c.Y || (i == 2 || i == 3) && p.Y > c.Y
+		if outX && outY {
+			return inEllipse(c, rad[i], rad[i], p)
+		}
+	}
+	return true
+}
+
+func (r *RoundedRectangle) Path() (p Path) {
+	min, max := r.Rect.Min, r.Rect.Max
+	rad := r.radii()
+	p.AddStart(geom.Point{min.X + rad[0], min.Y})
+	p.AddLine(geom.Point{max.X - rad[1], min.Y})
+	if rad[1] > 0 {
+		addEllipticalArc(&p, geom.Point{max.X - rad[1], min.Y + rad[1]}, rad[1], rad[1], -math.Pi/2, math.Pi/2)
+	}
+	p.AddLine(geom.Point{max.X, max.Y - rad[2]})
+	if rad[2] > 0 {
+		addEllipticalArc(&p, geom.Point{max.X - rad[2], max.Y - rad[2]}, rad[2], rad[2], 0, math.Pi/2)
+	}
+	p.AddLine(geom.Point{min.X + rad[3], max.Y})
+	if rad[3] > 0 {
+		addEllipticalArc(&p, geom.Point{min.X + rad[3], max.Y - rad[3]}, rad[3], rad[3], math.Pi/2, math.Pi/2)
+	}
+	p.AddLine(geom.Point{min.X, min.Y + rad[0]})
+	if rad[0] > 0 {
+		addEllipticalArc(&p, geom.Point{min.X + rad[0], min.Y + rad[0]}, rad[0], rad[0], math.Pi, math.Pi/2)
+	}
+	return p
+}
+
+// A Polygon is a regular polygon with the given number of Sides,
+// inscribed in a circle.
+//
+// With no Rotation, the first vertex points straight up.
+type Polygon struct {
+	Center   geom.Point
+	Radius   geom.Pt
+	Sides    int
+	Rotation float32
+}
+
+func (g *Polygon) vertices() []geom.Point {
+	if g.Sides < 3 {
+		return nil
+	}
+	v := make([]geom.Point, g.Sides)
+	for i := range v {
+		a := float64(g.Rotation) - math.Pi/2 + 2*math.Pi*float64(i)/float64(g.Sides)
+		v[i] = ellipsePoint(g.Center, g.Radius, g.Radius, a)
+	}
+	return v
+}
+
+// Contains reports whether p is inside the polygon.
+func (g *Polygon) Contains(p geom.Point) bool {
+	return polygonContains(g.vertices(), p)
+}
+
+func (g *Polygon) Path() Path {
+	return polygonPath(g.vertices())
+}
+
+// A Star is a regular star polygon with the given number of Points.
+// The tips of the star are Outer from the center, and the vertices
+// between them are Inner from the center.
+//
+// With no Rotation, the first tip points straight up.
+type Star struct {
+	Center       geom.Point
+	Outer, Inner geom.Pt
+	Points       int
+	Rotation     float32
+}
+
+func (s *Star) vertices() []geom.Point {
+	if s.Points < 2 {
+		return nil
+	}
+	v := make([]geom.Point, 2*s.Points)
+	for i := range v {
+		r := s.Outer
+		if i%2 == 1 {
+			r = s.Inner
+		}
+		a := float64(s.Rotation) - math.Pi/2 + math.Pi*float64(i)/float64(s.Points)
+		v[i] = ellipsePoint(s.Center, r, r, a)
+	}
+	return v
+}
+
+// Contains reports whether p is inside the star.
+func (s *Star) Contains(p geom.Point) bool {
+	return polygonContains(s.vertices(), p)
+}
+
+func (s *Star) Path() Path {
+	return polygonPath(s.vertices())
+}
+
+func polygonPath(v []geom.Point) (p Path) {
+	if len(v) == 0 {
+		return nil
+	}
+	p.AddStart(v[0])
+	for _, x := range v[1:] {
+		p.AddLine(x)
+	}
+	p.AddLine(v[0])
+	return p
+}
+
+// polygonContains reports whether p is inside the simple polygon with
+// vertices v, using the even-odd rule.
+func polygonContains(v []geom.Point, p geom.Point) bool {
+	in := false
+	for i, a := range v {
+		b := v[(i+1)%len(v)]
+		if (a.Y > p.Y) != (b.Y > p.Y) {
+			x := a.X + (p.Y-a.Y)*(b.X-a.X)/(b.Y-a.Y)
+			if p.X < x {
+				in = !in
+			}
+		}
+	}
+	return in
+}
+
+func inEllipse(c geom.Point, rx, ry geom.Pt, p geom.Point) bool {
+	if rx <= 0 || ry <= 0 {
+		return false
+	}
+	x := float64(p.X-c.X) / float64(rx)
+	y := float64(p.Y-c.Y) / float64(ry)
+	return x*x+y*y < 1
+}
+
+// side reports which side of the line through a and b the point p is
+// on, as the sign of the cross product (b-a)×(p-a).
+func side(a, b, p geom.Point) float64 {
+	return float64((b.X-a.X)*(p.Y-a.Y) - (b.Y-a.Y)*(p.X-a.X))
+}
+
+func ellipsePoint(c geom.Point, rx, ry geom.Pt, angle float64) geom.Point {
+	sin, cos := math.Sincos(angle)
+	return geom.Point{
+		c.X + rx*geom.Pt(cos),
+		c.Y + ry*geom.Pt(sin),
+	}
+}
+
+// addEllipticalArc adds cubic segments to p that follow the axis-aligned
+// ellipse centered at c with radii rx and ry, from the angle start for
+// sweep radians. The current point of p must be the start of the arc.
+func addEllipticalArc(p *Path, c geom.Point, rx, ry geom.Pt, start, sweep float64) {
+	addRotatedArc(p, c, float64(rx), float64(ry), 0, start, sweep)
+}
+
+// addRotatedArc is addEllipticalArc for an ellipse whose x-axis is
+// rotated by phi radians.
+func addRotatedArc(p *Path, c geom.Point, rx, ry, phi, start, sweep float64) {
+	if sweep > 2*math.Pi {
+		sweep = 2 * math.Pi
+	} else if sweep < -2*math.Pi {
+		sweep = -2 * math.Pi
+	}
+
+	// Approximate each piece of at most 90 degrees with a cubic whose
+	// control points are on the tangents at each end, a distance
+	//
+	//	4/3 * tan(sweep/4)
+	//
+	// from the end points on the unit circle.
+	n := int(math.Ceil(math.Abs(sweep) / (math.Pi / 2) * (1 - 1e-9)))
+	if n < 1 {
+		n = 1
+	}
+	d := sweep / float64(n)
+	k := 4.0 / 3 * math.Tan(d/4)
+	sinPhi, cosPhi := math.Sincos(phi)
+	point := func(x, y float64) geom.Point {
+		return geom.Point{
+			c.X + geom.Pt(cosPhi*rx*x-sinPhi*ry*y),
+			c.Y + geom.Pt(sinPhi*rx*x+cosPhi*ry*y),
+		}
+	}
+	for i := 0; i < n; i++ {
+		a0 := start + float64(i)*d
+		a1 := a0 + d
+		sin0, cos0 := math.Sincos(a0)
+		sin1, cos1 := math.Sincos(a1)
+		p.AddCubic(
+			point(cos0-k*sin0, sin0+k*cos0),
+			point(cos1+k*sin1, sin1-k*cos1),
+			point(cos1, sin1),
+		)
+	}
+}
@@ -0,0 +1,176 @@
+package raster
+
+import (
+	"math"
+	"testing"
+
+	"golang.org/x/mobile/geom"
+)
+
+type container interface {
+	Shape
+	Contains(geom.Point) bool
+}
+
+func TestContains(t *testing.T) {
+	tests := []struct {
+		name  string
+		shape container
+		in    []geom.Point
+		out   []geom.Point
+	}{
+		{
+			"circle",
+			&Circle{Center: geom.Point{10, 10}, Radius: 5},
+			[]geom.Point{{10, 10}, {14, 10}, {10, 6}},
+			[]geom.Point{{0, 0}, {14, 14}, {15.5, 10}},
+		},
+		{
+			"rectangle",
+			&Rectangle{Min: geom.Point{1, 2}, Max: geom.Point{3, 4}},
+			[]geom.Point{{1, 2}, {2, 3}},
+			[]geom.Point{{0, 0}, {3, 4}, {2, 4.5}},
+		},
+		{
+			"ellipse",
+			&Ellipse{Center: geom.Point{0, 0}, RadiusX: 10, RadiusY: 2},
+			[]geom.Point{{0, 0}, {9, 0}, {0, 1.9}, {-9, 0.5}},
+			[]geom.Point{{0, 3}, {11, 0}, {9, 1.5}},
+		},
+		{
+			"quarter arc",
+			&Arc{RadiusX: 10, RadiusY: 10, Start: 0, Sweep: math.Pi / 2},
+			[]geom.Point{{6, 6}, {9, 2}},
+			[]geom.Point{{2, 2}, {-1, 5}, {5, -1}, {8, 8}},
+		},
+		{
+			"three-quarter arc",
+			&Arc{RadiusX: 10, RadiusY: 10, Start: 0, Sweep: 3 * math.Pi / 2},
+			[]geom.Point{{0, 0}, {-5, -5}, {5, 5}, {-5, 5}},
+			[]geom.Point{{6, -6}, {20, 0}},
+		},
+		{
+			"anticlockwise arc",
+			&Arc{RadiusX: 10, RadiusY: 10, Start: 0, Sweep: -math.Pi / 2},
+			[]geom.Point{{6, -6}},
+			[]geom.Point{{6, 6}, {2, -2}},
+		},
+		{
+			"pie",
+			&Pie{RadiusX: 10, RadiusY: 10, Start: 0, Sweep: math.Pi / 2},
+			[]geom.Point{{2, 2}, {6, 6}, {9, 1}},
+			[]geom.Point{{-1, 5}, {5, -1}, {8, 8}},
+		},
+		{
+			"anticlockwise pie",
+			&Pie{RadiusX: 10, RadiusY: 10, Start: math.Pi, Sweep: -math.Pi / 2},
+			[]geom.Point{{-2, 2}},
+			[]geom.Point{{-2, -2}, {2, 2}},
+		},
+		{
+			"wrapping pie",
+			&Pie{RadiusX: 10, RadiusY: 10, Start: -math.Pi / 4, Sweep: math.Pi / 2},
+			[]geom.Point{{5, 0}, {5, 2}, {5, -2}},
+			[]geom.Point{{-5, 0}, {0, 5}, {0, -5}},
+		},
+		{
+			"rounded rectangle",
+			&RoundedRectangle{
+				Rect:   geom.Rectangle{geom.Point{0, 0}, geom.Point{20, 10}},
+				Radius: [4]geom.Pt{5, 0, 2, 5},
+			},
+			[]geom.Point{{2, 2}, {19.9, 0.1}, {10, 5}, {3, 7}},
+			[]geom.Point{{0.5, 0.5}, {19.9, 9.9}, {0.5, 9.5}, {21, 5}},
+		},
+		{
+			"hexagon",
+			&Polygon{Center: geom.Point{0, 0}, Radius: 10, Sides: 6},
+			[]geom.Point{{0, 0}, {0, -9.9}, {8, 0}},
+			[]geom.Point{{9, 0}, {0, -10.1}, {8, -6}},
+		},
+		{
+			"star",
+			&Star{Center: geom.Point{0, 0}, Outer: 10, Inner: 4, Points: 5},
+			[]geom.Point{{0, 0}, {0, -9}, {3, 0}},
+			[]geom.Point{{4, -4}, {0, 5}, {0, -11}},
+		},
+	}
+	for _, test := range tests {
+		for _, p := range test.in {
+			if !test.shape.Contains(p) {
+				t.Errorf("%s: %v should be inside", test.name, p)
+			}
+		}
+		for _, p := range test.out {
+			if test.shape.Contains(p) {
+				t.Errorf("%s: %v should be outside", test.name, p)
+			}
+		}
+	}
+}
+
+func TestShapeBounds(t *testing.T) {
+	tests := []struct {
+		name  string
+		shape Shape
+		want  geom.Rectangle
+	}{
+		{
+			"circle",
+			&Circle{Center: geom.Point{10, 10}, Radius: 5},
+			geom.Rectangle{geom.Point{5, 5}, geom.Point{15, 15}},
+		},
+		{
+			"ellipse",
+			&Ellipse{Center: geom.Point{0, 0}, RadiusX: 10, RadiusY: 2},
+			geom.Rectangle{geom.Point{-10, -2}, geom.Point{10, 2}},
+		},
+		{
+			"arc",
+			&Arc{RadiusX: 10, RadiusY: 10, Start: 0, Sweep: math.Pi / 2},
+			geom.Rectangle{geom.Point{0, 0}, geom.Point{10, 10}},
+		},
+		{
+			"pie",
+			&Pie{Center: geom.Point{5, 5}, RadiusX: 10, RadiusY: 10, Start: math.Pi, Sweep: math.Pi / 2},
+			geom.Rectangle{geom.Point{-5, -5}, geom.Point{5, 5}},
+		},
+		{
+			"rounded rectangle",
+			&RoundedRectangle{
+				Rect:   geom.Rectangle{geom.Point{0, 0}, geom.Point{20, 10}},
+				Radius: [4]geom.Pt{5, 5, 5, 5},
+			},
+			geom.Rectangle{geom.Point{0, 0}, geom.Point{20, 10}},
+		},
+		{
+			"oversized rounded rectangle",
+			&RoundedRectangle{
+				Rect:   geom.Rectangle{geom.Point{0, 0}, geom.Point{20, 10}},
+				Radius: [4]geom.Pt{100, 0, 0, 100},
+			},
+			geom.Rectangle{geom.Point{0, 0}, geom.Point{20, 10}},
+		},
+		{
+			"square",
+			&Polygon{Center: geom.Point{0, 0}, Radius: 10, Sides: 4},
+			geom.Rectangle{geom.Point{-10, -10}, geom.Point{10, 10}},
+		},
+		{
+			"star",
+			&Star{Center: geom.Point{0, 0}, Outer: 10, Inner: 5, Points: 4, Rotation: math.Pi / 4},
+			geom.Rectangle{geom.Point{-7.07, -7.07}, geom.Point{7.07, 7.07}},
+		},
+	}
+
+	const epsilon = 0.01
+	eq := func(x, y geom.Pt) bool { return x-y < epsilon && y-x < epsilon }
+	pointEq := func(x, y geom.Point) bool { return eq(x.X, y.X) && eq(x.Y, y.Y) }
+	rectEq := func(x, y geom.Rectangle) bool { return pointEq(x.Min, y.Min) && pointEq(x.Max, y.Max) }
+
+	for _, test := range tests {
+		if got := test.shape.Path().Bounds(); !rectEq(got, test.want) {
+			t.Errorf("%s: got bounds %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package raster
+
+import "image"
+
+// A skyline packs rectangles into a fixed area by tracking, for each
+// x, the bottom of the lowest rectangle placed there. Each rectangle
+// goes as high up as it fits, then as far left. Rectangles are never
+// freed individually, the whole skyline is reset.
+//
+// See Jukka Jylänki, "A Thousand Ways to Pack the Bin", 2010.
+type skyline struct {
+	w, h  int
+	nodes []skylineNode // sorted by x, covering [0, w)
+}
+
+// A skylineNode is a horizontal run of the skyline, w pixels wide at
+// height y.
+type skylineNode struct {
+	x, y, w int
+}
+
+func newSkyline(w, h int) *skyline {
+	s := &skyline{w: w, h: h}
+	s.reset()
+	return s
+}
+
+func (s *skyline) reset() {
+	s.nodes = append(s.nodes[:0], skylineNode{0, 0, s.w})
+}
+
+// alloc reserves a w by h rectangle and returns its top-left corner,
+// or false if there is no room for it.
+func (s *skyline) alloc(w, h int) (image.Point, bool) {
+	if w <= 0 || h <= 0 {
+		return image.Point{}, w >= 0 && h >= 0
+	}
+	best, bestY := -1, 0
+	for i := range s.nodes {
+		y, ok := s.fit(i, w, h)
+		if ok && (best < 0 || y < bestY) {
+			best, bestY = i, y
+		}
+	}
+	if best < 0 {
+		return image.Point{}, false
+	}
+
+	n := skylineNode{s.nodes[best].x, bestY + h, w}
+	s.nodes = append(s.nodes, skylineNode{})
+	copy(s.nodes[best+1:], s.nodes[best:])
+	s.nodes[best] = n
+
+	// Cut the runs now hidden under the new one.
+	end := n.x + n.w
+	for i := best + 1; i < len(s.nodes); {
+		r := &s.nodes[i]
+		if r.x >= end {
+			break
+		}
+		if r.x+r.w <= end {
+			s.nodes = append(s.nodes[:i], s.nodes[i+1:]...)
+			continue
+		}
+		r.w -= end - r.x
+		r.x = end
+		break
+	}
+	s.merge()
+	return image.Point{n.x, bestY}, true
+}
+
+// fit returns the height at which a w by h rectangle placed at the
+// start of node i would rest.
+func (s *skyline) fit(i, w, h int) (int, bool) {
+	if s.nodes[i].x+w > s.w {
+		return 0, false
+	}
+	y := 0
+	for left := w; left > 0; i++ {
+		if s.nodes[i].y > y {
+			y = s.nodes[i].y
+		}
+		if y+h > s.h {
+			return 0, false
+		}
+		left -= s.nodes[i].w
+	}
+	return y, true
+}
+
+// merge joins neighboring runs of the same height.
+func (s *skyline) merge() {
+	j := 0
+	for i := 1; i < len(s.nodes); i++ {
+		if s.nodes[i].y == s.nodes[j].y {
+			s.nodes[j].w += s.nodes[i].w
+			continue
+		}
+		j++
+		s.nodes[j] = s.nodes[i]
+	}
+	s.nodes = s.nodes[:j+1]
+}
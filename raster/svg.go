@@ -0,0 +1,394 @@
+package raster
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+
+	"golang.org/x/mobile/geom"
+)
+
+// ParseSVGPath parses SVG path data, the contents of the "d" attribute
+// of an SVG path element.
+//
+// The full path grammar is supported, with both absolute and relative
+// commands. Horizontal and vertical lines become line segments, smooth
+// curves have their implicit control point made explicit, elliptical
+// arcs are approximated by cubic segments, and closepath adds a line
+// segment back to the start of the subpath.
+func ParseSVGPath(d string) (Path, error) {
+	ps := &svgParser{s: d}
+	if err := ps.parse(); err != nil {
+		return nil, err
+	}
+	return ps.p, nil
+}
+
+// SVG returns p as SVG path data. It uses only absolute M, L, Q and C
+// commands, so ParseSVGPath(p.SVG()) reproduces p exactly.
+func (p Path) SVG() string {
+	var buf bytes.Buffer
+	for it := p.Iterator(); it.Next(); {
+		s := it.Segment()
+		if buf.Len() > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteByte("MLQC"[s.Op])
+		pts := s.P[1 : s.Op+1]
+		if s.Op == OpStart {
+			pts = s.P[:1]
+		}
+		for i, pt := range pts {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			buf.WriteString(formatPt(pt.X))
+			buf.WriteByte(' ')
+			buf.WriteString(formatPt(pt.Y))
+		}
+	}
+	return buf.String()
+}
+
+func formatPt(x geom.Pt) string {
+	return strconv.FormatFloat(float64(x), 'g', -1, 32)
+}
+
+type svgParser struct {
+	s   string
+	off int
+	p   Path
+
+	cur, start geom.Point
+	// ctrl is the last control point of the previous segment, used to
+	// reflect the implicit control point of S and T commands.
+	ctrl    geom.Point
+	ctrlCmd byte // upper-case command that set ctrl
+}
+
+func (ps *svgParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("raster: bad SVG path at offset %d: %s", ps.off, fmt.Sprintf(format, args...))
+}
+
+func (ps *svgParser) skipSpace() {
+	for ps.off < len(ps.s) {
+		switch ps.s[ps.off] {
+		case ' ', '\t', '\n', '\r', '\f':
+			ps.off++
+		default:
+			return
+		}
+	}
+}
+
+// skipSep skips white space and at most one comma.
+func (ps *svgParser) skipSep() {
+	ps.skipSpace()
+	if ps.off < len(ps.s) && ps.s[ps.off] == ',' {
+		ps.off++
+		ps.skipSpace()
+	}
+}
+
+// more reports whether the next token is a number.
+func (ps *svgParser) more() bool {
+	ps.skipSep()
+	if ps.off >= len(ps.s) {
+		return false
+	}
+	switch c := ps.s[ps.off]; {
+	case '0' <= c && c <= '9', c == '-', c == '+', c == '.':
+		return true
+	}
+	return false
+}
+
+func (ps *svgParser) number() (float64, error) {
+	ps.skipSep()
+	start := ps.off
+	i := ps.off
+	if i < len(ps.s) && (ps.s[i] == '-' || ps.s[i] == '+') {
+		i++
+	}
+	digits := 0
+	for ; i < len(ps.s) && '0' <= ps.s[i] && ps.s[i] <= '9'; i++ {
+		digits++
+	}
+	if i < len(ps.s) && ps.s[i] == '.' {
+		i++
+		for ; i < len(ps.s) && '0' <= ps.s[i] && ps.s[i] <= '9'; i++ {
+			digits++
+		}
+	}
+	if digits == 0 {
+		return 0, ps.errorf("expected number")
+	}
+	if i < len(ps.s) && (ps.s[i] == 'e' || ps.s[i] == 'E') {
+		j := i + 1
+		if j < len(ps.s) && (ps.s[j] == '-' || ps.s[j] == '+') {
+			j++
+		}
+		if j < len(ps.s) && '0' <= ps.s[j] && ps.s[j] <= '9' {
+			for i = j; i < len(ps.s) && '0' <= ps.s[i] && ps.s[i] <= '9'; i++ {
+			}
+		}
+	}
+	v, err := strconv.ParseFloat(ps.s[start:i], 64)
+	if err != nil {
+		return 0, ps.errorf("%v", err)
+	}
+	ps.off = i
+	return v, nil
+}
+
+// flag parses an arc flag, which may be written without a separator.
+func (ps *svgParser) flag() (bool, error) {
+	ps.skipSep()
+	if ps.off < len(ps.s) {
+		switch ps.s[ps.off] {
+		case '0':
+			ps.off++
+			return false, nil
+		case '1':
+			ps.off++
+			return true, nil
+		}
+	}
+	return false, ps.errorf("expected flag")
+}
+
+// point parses a coordinate pair, relative to the current point if rel.
+func (ps *svgParser) point(rel bool) (geom.Point, error) {
+	x, err := ps.number()
+	if err != nil {
+		return geom.Point{}, err
+	}
+	y, err := ps.number()
+	if err != nil {
+		return geom.Point{}, err
+	}
+	p := geom.Point{geom.Pt(x), geom.Pt(y)}
+	if rel {
+		p.X += ps.cur.X
+		p.Y += ps.cur.Y
+	}
+	return p, nil
+}
+
+// reflect returns the reflection of the previous control point about
+// the current point, if the previous command was a cmd. Otherwise it
+// returns the current point.
+func (ps *svgParser) reflect(cmd byte) geom.Point {
+	if ps.ctrlCmd != cmd {
+		return ps.cur
+	}
+	return geom.Point{2*ps.cur.X - ps.ctrl.X, 2*ps.cur.Y - ps.ctrl.Y}
+}
+
+func (ps *svgParser) parse() error {
+	ps.skipSpace()
+	if ps.off == len(ps.s) {
+		return nil
+	}
+	if c := ps.s[ps.off]; c != 'M' && c != 'm' {
+		return ps.errorf("path must start with a moveto, found %q", c)
+	}
+	for {
+		ps.skipSpace()
+		if ps.off == len(ps.s) {
+			return nil
+		}
+		cmd := ps.s[ps.off]
+		ps.off++
+		if err := ps.command(cmd); err != nil {
+			return err
+		}
+	}
+}
+
+func (ps *svgParser) command(cmd byte) error {
+	rel := 'a' <= cmd && cmd <= 'z'
+	upper := cmd
+	if rel {
+		upper -= 'a' - 'A'
+	}
+
+	if upper == 'Z' {
+		if ps.cur != ps.start {
+			ps.p.AddLine(ps.start)
+		}
+		ps.cur = ps.start
+		ps.ctrlCmd = 0
+		return nil
+	}
+
+	// Every other command takes one or more sets of arguments.
+	for first := true; first || ps.more(); first = false {
+		ctrlCmd := byte(0)
+		switch upper {
+		case 'M':
+			p, err := ps.point(rel)
+			if err != nil {
+				return err
+			}
+			if first {
+				ps.p.AddStart(p)
+				ps.start = p
+			} else {
+				// Subsequent pairs are implicit lineto commands.
+				ps.p.AddLine(p)
+			}
+			ps.cur = p
+		case 'L':
+			p, err := ps.point(rel)
+			if err != nil {
+				return err
+			}
+			ps.p.AddLine(p)
+			ps.cur = p
+		case 'H', 'V':
+			v, err := ps.number()
+			if err != nil {
+				return err
+			}
+			p := ps.cur
+			if upper == 'H' {
+				p.X = geom.Pt(v)
+				if rel {
+					p.X += ps.cur.X
+				}
+			} else {
+				p.Y = geom.Pt(v)
+				if rel {
+					p.Y += ps.cur.Y
+				}
+			}
+			ps.p.AddLine(p)
+			ps.cur = p
+		case 'C', 'S':
+			var c1 geom.Point
+			if upper == 'C' {
+				var err error
+				if c1, err = ps.point(rel); err != nil {
+					return err
+				}
+			} else {
+				c1 = ps.reflect('C')
+			}
+			c2, err := ps.point(rel)
+			if err != nil {
+				return err
+			}
+			p, err := ps.point(rel)
+			if err != nil {
+				return err
+			}
+			ps.p.AddCubic(c1, c2, p)
+			ps.cur = p
+			ps.ctrl, ctrlCmd = c2, 'C'
+		case 'Q', 'T':
+			var c geom.Point
+			if upper == 'Q' {
+				var err error
+				if c, err = ps.point(rel); err != nil {
+					return err
+				}
+			} else {
+				c = ps.reflect('Q')
+			}
+			p, err := ps.point(rel)
+			if err != nil {
+				return err
+			}
+			ps.p.AddQuadratic(c, p)
+			ps.cur = p
+			ps.ctrl, ctrlCmd = c, 'Q'
+		case 'A':
+			var v [3]float64
+			for i := range v {
+				var err error
+				if v[i], err = ps.number(); err != nil {
+					return err
+				}
+			}
+			large, err := ps.flag()
+			if err != nil {
+				return err
+			}
+			sweep, err := ps.flag()
+			if err != nil {
+				return err
+			}
+			p, err := ps.point(rel)
+			if err != nil {
+				return err
+			}
+			addArc(&ps.p, ps.cur, p, v[0], v[1], v[2], large, sweep)
+			ps.cur = p
+		default:
+			return ps.errorf("unknown command %q", cmd)
+		}
+		ps.ctrlCmd = ctrlCmd
+	}
+	return nil
+}
+
+// addArc adds an SVG elliptical arc from p0 to p1 to p as a sequence
+// of cubic segments. The arc parameters follow the SVG specification:
+// radii rx and ry, x-axis rotation phi in degrees, and the large-arc
+// and sweep flags.
+func addArc(p *Path, p0, p1 geom.Point, rx, ry, phi float64, large, sweep bool) {
+	if p0 == p1 {
+		return
+	}
+	rx, ry = math.Abs(rx), math.Abs(ry)
+	if rx == 0 || ry == 0 {
+		p.AddLine(p1)
+		return
+	}
+
+	// Convert from endpoint to center parameterization, following
+	// Appendix F.6.5 of the SVG 1.1 specification.
+	sinPhi, cosPhi := math.Sincos(phi * math.Pi / 180)
+	dx := float64(p0.X-p1.X) / 2
+	dy := float64(p0.Y-p1.Y) / 2
+	x1 := cosPhi*dx + sinPhi*dy
+	y1 := -sinPhi*dx + cosPhi*dy
+
+	// Scale up radii that are too small to reach p1.
+	if l := x1*x1/(rx*rx) + y1*y1/(ry*ry); l > 1 {
+		l = math.Sqrt(l)
+		rx *= l
+		ry *= l
+	}
+
+	num := rx*rx*ry*ry - rx*rx*y1*y1 - ry*ry*x1*x1
+	den := rx*rx*y1*y1 + ry*ry*x1*x1
+	k := 0.0
+	if num > 0 && den > 0 {
+		k = math.Sqrt(num / den)
+	}
+	if large == sweep {
+		k = -k
+	}
+	cx1 := k * rx * y1 / ry
+	cy1 := -k * ry * x1 / rx
+	cx := cosPhi*cx1 - sinPhi*cy1 + float64(p0.X+p1.X)/2
+	cy := sinPhi*cx1 + cosPhi*cy1 + float64(p0.Y+p1.Y)/2
+
+	theta := math.Atan2((y1-cy1)/ry, (x1-cx1)/rx)
+	delta := math.Atan2((-y1-cy1)/ry, (-x1-cx1)/rx) - theta
+	if sweep && delta < 0 {
+		delta += 2 * math.Pi
+	} else if !sweep && delta > 0 {
+		delta -= 2 * math.Pi
+	}
+
+	c := geom.Point{geom.Pt(cx), geom.Pt(cy)}
+	addRotatedArc(p, c, rx, ry, phi*math.Pi/180, theta, delta)
+
+	// End exactly on p1, not an approximation of it.
+	(*p)[len(*p)-2] = p1.X
+	(*p)[len(*p)-1] = p1.Y
+}
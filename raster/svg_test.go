@@ -0,0 +1,150 @@
+package raster
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"golang.org/x/mobile/geom"
+)
+
+func TestParseSVGPath(t *testing.T) {
+	tests := []struct {
+		d    string
+		want Path
+	}{
+		{"", nil},
+		{"M10 20L30 40", Path{0, 10, 20, 1, 30, 40}},
+		{"M 10,20 L 30,40 50,60", Path{0, 10, 20, 1, 30, 40, 1, 50, 60}},
+		{"m10 20 l5 5 5-5", Path{0, 10, 20, 1, 15, 25, 1, 20, 20}},
+		{"M0 0 10 10", Path{0, 0, 0, 1, 10, 10}},
+		{"M1 2H5V7h-2v-1", Path{0, 1, 2, 1, 5, 2, 1, 5, 7, 1, 3, 7, 1, 3, 6}},
+		{"M0 0L10 0L10 10Z", Path{0, 0, 0, 1, 10, 0, 1, 10, 10, 1, 0, 0}},
+		{"M0 0L10 0L0 0z", Path{0, 0, 0, 1, 10, 0, 1, 0, 0}},
+		{"M0 0Z l5 5", Path{0, 0, 0, 1, 5, 5}},
+		{"M0 0Q5 10 10 0T20 0", Path{0, 0, 0, 2, 5, 10, 10, 0, 2, 15, -10, 20, 0}},
+		{"M0 0q5 10 10 0t10 0", Path{0, 0, 0, 2, 5, 10, 10, 0, 2, 15, -10, 20, 0}},
+		{"M0 0T10 0", Path{0, 0, 0, 2, 0, 0, 10, 0}},
+		{"M0 0C0 10 10 10 10 0S20-10 20 0", Path{0, 0, 0, 3, 0, 10, 10, 10, 10, 0, 3, 10, -10, 20, -10, 20, 0}},
+		{"M0 0c0 10 10 10 10 0s10-10 10 0", Path{0, 0, 0, 3, 0, 10, 10, 10, 10, 0, 3, 10, -10, 20, -10, 20, 0}},
+		{"M0 0S5 5 10 0", Path{0, 0, 0, 3, 0, 0, 5, 5, 10, 0}},
+		{"M.5-.5L1e1 2.5E-1", Path{0, 0.5, -0.5, 1, 10, 0.25}},
+		{"M0 0A0 5 0 0 1 10 0", Path{0, 0, 0, 1, 10, 0}},
+		{"M0 0A5 5 0 0 1 0 0", Path{0, 0, 0}},
+	}
+	for _, test := range tests {
+		got, err := ParseSVGPath(test.d)
+		if err != nil {
+			t.Errorf("ParseSVGPath(%q): %v", test.d, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseSVGPath(%q) = %v, want %v", test.d, got, test.want)
+		}
+	}
+}
+
+func TestParseSVGPathErrors(t *testing.T) {
+	tests := []string{
+		"L10 10",
+		"M10",
+		"M10 10 L",
+		"M10 10 X5 5",
+		"M0 0 A5 5 0 2 0 10 10",
+		"M0 0 L1 2 3",
+		"M1.2.",
+	}
+	for _, d := range tests {
+		if p, err := ParseSVGPath(d); err == nil {
+			t.Errorf("ParseSVGPath(%q) = %v, want error", d, p)
+		}
+	}
+}
+
+func TestParseSVGPathArc(t *testing.T) {
+	tests := []struct {
+		d        string
+		center   geom.Point
+		rx, ry   float64
+		segments int
+	}{
+		// Half circles, in both directions.
+		{"M0 0A10 10 0 0 1 20 0", geom.Point{10, 0}, 10, 10, 2},
+		{"M0 0A10 10 0 0 0 20 0", geom.Point{10, 0}, 10, 10, 2},
+		// Quarter and three-quarter circles.
+		{"M10 0A10 10 0 0 1 0 10", geom.Point{0, 0}, 10, 10, 1},
+		{"M10 0A10 10 0 1 0 0 10", geom.Point{0, 0}, 10, 10, 3},
+		// Radii too small are scaled up.
+		{"M0 0A1 1 0 0 1 20 0", geom.Point{10, 0}, 10, 10, 2},
+		// Flags written without separators.
+		{"M0 0a10 10 0 0120 0", geom.Point{10, 0}, 10, 10, 2},
+		// An ellipse.
+		{"M0 0A20 10 0 0 1 40 0", geom.Point{20, 0}, 20, 10, 2},
+	}
+	for _, test := range tests {
+		p, err := ParseSVGPath(test.d)
+		if err != nil {
+			t.Errorf("ParseSVGPath(%q): %v", test.d, err)
+			continue
+		}
+		if got := (len(p) - 3) / 7; got != test.segments {
+			t.Errorf("%q: got %d segments, want %d", test.d, got, test.segments)
+			continue
+		}
+		// Each segment must start and end on the ellipse, and pass
+		// close to it at its midpoint.
+		start := geom.Point{p[1], p[2]}
+		for i := 3; i < len(p); i += 7 {
+			if p[i] != 3 {
+				t.Fatalf("%q: segment %d is not cubic", test.d, i)
+			}
+			c1 := geom.Point{p[i+1], p[i+2]}
+			c2 := geom.Point{p[i+3], p[i+4]}
+			end := geom.Point{p[i+5], p[i+6]}
+			mid := geom.Point{
+				(start.X + 3*c1.X + 3*c2.X + end.X) / 8,
+				(start.Y + 3*c1.Y + 3*c2.Y + end.Y) / 8,
+			}
+			for _, q := range []geom.Point{start, mid, end} {
+				dx := float64(q.X-test.center.X) / test.rx
+				dy := float64(q.Y-test.center.Y) / test.ry
+				if r := math.Hypot(dx, dy); math.Abs(r-1) > 0.001 {
+					t.Errorf("%q: point %v is %.4f radii from center", test.d, q, r)
+				}
+			}
+			start = end
+		}
+	}
+}
+
+func TestSVGRoundTrip(t *testing.T) {
+	var p Path
+	p.AddStart(geom.Point{1.5, -2})
+	p.AddLine(geom.Point{10, 20})
+	p.AddQuadratic(geom.Point{0.1, 0.2}, geom.Point{1e-7, 3e7})
+	p.AddCubic(geom.Point{1, 2}, geom.Point{3, 4}, geom.Point{5, 6})
+	p.AddStart(geom.Point{100, 100})
+	p.AddLine(geom.Point{geom.Pt(math.Pi), geom.Pt(math.E)})
+
+	paths := []Path{
+		p,
+		(&Circle{Radius: 7}).Path(),
+		(&Rectangle{Min: geom.Point{1, 2}, Max: geom.Point{3, 4}}).Path(),
+	}
+	for _, p := range paths {
+		d := p.SVG()
+		got, err := ParseSVGPath(d)
+		if err != nil {
+			t.Errorf("ParseSVGPath(%q): %v", d, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, p) {
+			t.Errorf("round trip of %q:\ngot  %v\nwant %v", d, got, p)
+		}
+	}
+
+	const want = "M1.5 -2 L10 20 Q0.1 0.2 1e-07 3e+07 C1 2 3 4 5 6 M100 100 L3.1415927 2.7182817"
+	if got := p.SVG(); got != want {
+		t.Errorf("SVG() = %q, want %q", got, want)
+	}
+}
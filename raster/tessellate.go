@@ -0,0 +1,211 @@
+package raster
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"golang.org/x/mobile/geom"
+)
+
+// A FillRule decides which points are inside a path whose curves
+// overlap or wind around a point more than once.
+type FillRule uint8
+
+const (
+	NonZero FillRule = iota // inside if the curves wind around the point
+	EvenOdd                 // inside if a ray from the point crosses the curves an odd number of times
+)
+
+// A Mesh is an indexed list of triangles, ready for a vertex buffer.
+type Mesh struct {
+	// Vertices holds three values for each vertex: its x and y
+	// position in points, and its coverage from 0 to 1. Coverage is 1
+	// except on the outer edge of an anti-aliasing fringe.
+	Vertices []float32
+
+	// Indices holds three vertex indices for each triangle.
+	Indices []uint16
+}
+
+// Tessellate returns a triangle mesh covering the region filled by p
+// under the given rule. Curved segments are flattened to within a
+// tenth of a pixel.
+//
+// If fringe is positive, the mesh includes a band of that width around
+// the outside of the region whose coverage fades from 1 to 0, so that
+// edges are anti-aliased when coverage is used as alpha.
+//
+// Meshes are limited to 65536 vertices, so they can be drawn with
+// 16-bit indices.
+func Tessellate(p Path, rule FillRule, fringe geom.Pt) (*Mesh, error) {
+	inside := func(w, _ int) bool { return w != 0 }
+	if rule == EvenOdd {
+		inside = func(w, _ int) bool { return w%2 != 0 }
+	}
+	t := &tessellator{index: make(map[[2]float64]uint16)}
+	loops := region(p, nil, inside)
+	t.fill(loops)
+	if fringe > 0 {
+		t.fringe(loops, float64(fringe)*gridScale)
+	}
+	if t.err != nil {
+		return nil, t.err
+	}
+	return &t.m, nil
+}
+
+// TessellateStroke returns a triangle mesh covering the stroke s.
+func TessellateStroke(s *Stroke, fringe geom.Pt) (*Mesh, error) {
+	return Tessellate(s.Path(), NonZero, fringe)
+}
+
+type tessellator struct {
+	m     Mesh
+	index map[[2]float64]uint16 // vertex index by position in grid units
+	err   error
+}
+
+// vertex returns the index of the vertex at (x, y) in grid units.
+func (t *tessellator) vertex(x, y float64, coverage float32) uint16 {
+	k := [2]float64{x, y}
+	if coverage == 1 {
+		if i, ok := t.index[k]; ok {
+			return i
+		}
+	}
+	n := len(t.m.Vertices) / 3
+	if n > math.MaxUint16 {
+		if t.err == nil {
+			t.err = fmt.Errorf("raster: mesh needs more than %d vertices", math.MaxUint16+1)
+		}
+		return 0
+	}
+	t.m.Vertices = append(t.m.Vertices, float32(x/gridScale), float32(y/gridScale), coverage)
+	if coverage == 1 {
+		t.index[k] = uint16(n)
+	}
+	return uint16(n)
+}
+
+func (t *tessellator) triangle(a, b, c uint16) {
+	if a == b || b == c || a == c {
+		return
+	}
+	t.m.Indices = append(t.m.Indices, a, b, c)
+}
+
+// fill covers the region bounded by loops with triangles, by cutting
+// it into trapezoids between horizontal lines through every vertex.
+// The loops do not cross, so edges keep their order within each band.
+func (t *tessellator) fill(loops [][]gridPt) {
+	var edges []gridEdge
+	var ys []int64
+	for _, loop := range loops {
+		for i, p := range loop {
+			q := loop[(i+1)%len(loop)]
+			ys = append(ys, p.y)
+			if p.y != q.y {
+				edges = append(edges, gridEdge{p: p, q: q})
+			}
+		}
+	}
+	sort.Sort(int64s(ys))
+
+	var cs []crossing
+	for i := 0; i+1 < len(ys); i++ {
+		y0, y1 := ys[i], ys[i+1]
+		if y0 == y1 {
+			continue
+		}
+		cs = cs[:0]
+		for _, e := range edges {
+			p, q, dir := e.p, e.q, 1
+			if p.y > q.y {
+				p, q, dir = q, p, -1
+			}
+			if p.y <= y0 && q.y >= y1 {
+				cs = append(cs, crossing{edgeX(p, q, y0), edgeX(p, q, y1), dir})
+			}
+		}
+		sort.Sort(byMidX(cs))
+
+		w := 0
+		for j := 0; j+1 < len(cs); j++ {
+			w += cs[j].dir
+			if w == 0 {
+				continue
+			}
+			l, r := cs[j], cs[j+1]
+			fy0, fy1 := float64(y0), float64(y1)
+			tl := t.vertex(l.x0, fy0, 1)
+			tr := t.vertex(r.x0, fy0, 1)
+			bl := t.vertex(l.x1, fy1, 1)
+			br := t.vertex(r.x1, fy1, 1)
+			t.triangle(tl, tr, br)
+			t.triangle(tl, br, bl)
+		}
+	}
+}
+
+// A crossing is where an edge passes through a horizontal band.
+type crossing struct {
+	x0, x1 float64 // x at the top and bottom of the band
+	dir    int     // +1 for edges running down, -1 for up
+}
+
+type byMidX []crossing
+
+func (s byMidX) Len() int           { return len(s) }
+func (s byMidX) Less(i, j int) bool { return s[i].x0+s[i].x1 < s[j].x0+s[j].x1 }
+func (s byMidX) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// edgeX returns the x coordinate of the edge from p to q at y.
+func edgeX(p, q gridPt, y int64) float64 {
+	switch y {
+	case p.y:
+		return float64(p.x)
+	case q.y:
+		return float64(q.x)
+	}
+	return float64(p.x) + float64(y-p.y)*float64(q.x-p.x)/float64(q.y-p.y)
+}
+
+type int64s []int64
+
+func (s int64s) Len() int           { return len(s) }
+func (s int64s) Less(i, j int) bool { return s[i] < s[j] }
+func (s int64s) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// fringe adds a band of width w grid units outside each loop, fading
+// from full coverage on the loop to none.
+func (t *tessellator) fringe(loops [][]gridPt, w float64) {
+	for _, loop := range loops {
+		n := len(loop)
+		in := make([]uint16, n)
+		out := make([]uint16, n)
+		for i, p := range loop {
+			prev, next := vecOf(loop[(i+n-1)%n].pt()), vecOf(loop[(i+1)%n].pt())
+			c := vecOf(p.pt())
+			// The region is on the left of each edge, so outwards is
+			// on the right.
+			d1, d2 := c.sub(prev).unit(), next.sub(c).unit()
+			o1, o2 := vec{d1.y, -d1.x}, vec{d2.y, -d2.x}
+			m := o1.add(o2).unit()
+			// Keep the band its full width along both edges, but
+			// limit the spike at sharp corners.
+			s := m.dot(o1)
+			if s < 0.25 {
+				s = 0.25
+			}
+			x, y := float64(p.x), float64(p.y)
+			in[i] = t.vertex(x, y, 1)
+			out[i] = t.vertex(x+m.x*w/s, y+m.y*w/s, 0)
+		}
+		for i := range loop {
+			j := (i + 1) % n
+			t.triangle(in[i], in[j], out[j])
+			t.triangle(in[i], out[j], out[i])
+		}
+	}
+}
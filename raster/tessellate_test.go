@@ -0,0 +1,124 @@
+package raster
+
+import (
+	"math"
+	"testing"
+
+	"golang.org/x/mobile/geom"
+)
+
+// meshArea returns the total area of triangles in m whose vertices all
+// have full coverage, and of those that do not.
+func meshArea(m *Mesh) (fill, fringe float64) {
+	v := func(i uint16) (float64, float64, float32) {
+		return float64(m.Vertices[3*i]), float64(m.Vertices[3*i+1]), m.Vertices[3*i+2]
+	}
+	for i := 0; i < len(m.Indices); i += 3 {
+		ax, ay, ac := v(m.Indices[i])
+		bx, by, bc := v(m.Indices[i+1])
+		cx, cy, cc := v(m.Indices[i+2])
+		a := math.Abs((bx-ax)*(cy-ay)-(cx-ax)*(by-ay)) / 2
+		if ac == 1 && bc == 1 && cc == 1 {
+			fill += a
+		} else {
+			fringe += a
+		}
+	}
+	return fill, fringe
+}
+
+func TestTessellate(t *testing.T) {
+	geom.PixelsPerPt = 1
+	var star Path
+	for i := 0; i < 5; i++ {
+		a := -math.Pi/2 + float64(i)*4*math.Pi/5
+		pt := geom.Point{geom.Pt(15 + 15*math.Cos(a)), geom.Pt(15 + 15*math.Sin(a))}
+		if i == 0 {
+			star.AddStart(pt)
+		} else {
+			star.AddLine(pt)
+		}
+	}
+	// The area of the pentagon in the middle of the pentagram.
+	inner := 15 * math.Sin(math.Pi/10) / math.Sin(7*math.Pi/10)
+	pentagon := 5 * inner * inner * math.Sin(2*math.Pi/5) / 2
+
+	circle := (&Circle{Center: geom.Point{10, 10}, Radius: 10}).Path()
+
+	tests := []struct {
+		name string
+		p    Path
+		rule FillRule
+		area float64
+	}{
+		{"square", mustParse(t, "M0 0 H10 V10 H0 Z"), NonZero, 100},
+		{"square with hole", mustParse(t, "M0 0 H10 V10 H0 Z M2 2 V8 H8 V2 Z"), NonZero, 64},
+		{"square with hole even-odd", mustParse(t, "M0 0 H10 V10 H0 Z M2 2 H8 V8 H2 Z"), EvenOdd, 64},
+		{"double square", mustParse(t, "M0 0 H10 V10 H0 Z M0 0 H10 V10 H0 Z"), NonZero, 100},
+		{"double square even-odd", mustParse(t, "M0 0 H10 V10 H0 Z M0 0 H10 V10 H0 Z"), EvenOdd, 0},
+		{"pentagram", star, NonZero, math.Abs(area(Union(star, nil)))},
+		{"pentagram even-odd", star, EvenOdd, math.Abs(area(Union(star, nil))) - pentagon},
+		{"circle", circle, NonZero, math.Abs(area(circle))},
+	}
+	for _, test := range tests {
+		m, err := Tessellate(test.p, test.rule, 0)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		fill, fringe := meshArea(m)
+		if math.Abs(fill-test.area) > 0.005*test.area+1e-3 || fringe != 0 {
+			t.Errorf("%s: area %v, fringe %v, want %v", test.name, fill, fringe, test.area)
+		}
+
+		// Every triangle is inside the shape.
+		in := inside(test.p)
+		if test.rule == EvenOdd {
+			edges := polygonEdges(polygons(test.p), 0)
+			in = func(x, y float64) bool { return winding(edges, x*gridScale, y*gridScale)%2 != 0 }
+		}
+		for i := 0; i < len(m.Indices); i += 3 {
+			var cx, cy float64
+			for _, j := range m.Indices[i : i+3] {
+				cx += float64(m.Vertices[3*j]) / 3
+				cy += float64(m.Vertices[3*j+1]) / 3
+			}
+			if !in(cx, cy) {
+				t.Errorf("%s: triangle centered at (%v, %v) is outside", test.name, cx, cy)
+				break
+			}
+		}
+	}
+}
+
+func TestTessellateFringe(t *testing.T) {
+	m, err := Tessellate(mustParse(t, "M0 0 H10 V10 H0 Z"), NonZero, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fill, fringe := meshArea(m)
+	if fill != 100 || math.Abs(fringe-44) > 1e-3 {
+		t.Errorf("fill %v, fringe %v, want 100 and 44", fill, fringe)
+	}
+	for i := 0; i < len(m.Vertices); i += 3 {
+		x, y, c := m.Vertices[i], m.Vertices[i+1], m.Vertices[i+2]
+		inSquare := x >= 0 && x <= 10 && y >= 0 && y <= 10
+		if (c == 1) != inSquare {
+			t.Errorf("vertex (%v, %v) has coverage %v", x, y, c)
+		}
+	}
+}
+
+func TestTessellateStroke(t *testing.T) {
+	geom.PixelsPerPt = 1
+	shape := mustParse(t, "M0 5 H20")
+	s := &Stroke{Shape: &shape, Width: 2}
+	m, err := TessellateStroke(s, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := math.Abs(area(Union(s.Path(), nil)))
+	if fill, _ := meshArea(m); math.Abs(fill-want) > 1e-3 || fill < 40 {
+		t.Errorf("stroke area %v, want %v", fill, want)
+	}
+}
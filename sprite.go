@@ -25,7 +25,9 @@
 package sprite
 
 import (
+	"errors"
 	"image"
+	"image/color"
 	"image/draw"
 
 	"github.com/crawshaw/sprite/clock"
@@ -37,43 +39,220 @@ type Arranger interface {
 	Arrange(e Engine, n *Node, t clock.Time)
 }
 
+// A Texture is an image loaded into an Engine.
+//
+// Format is how the engine stores the texels, which it chooses from the
+// type of the image loaded. Download copies the texels r of the texture
+// into dst, starting at the top-left of dst. Upload copies src into the
+// texels r, converting it to the format. Unload frees the texture. Using
+// it after that, by these methods or by drawing it, panics with
+// ErrUnloaded.
 type Texture interface {
 	Bounds() (w, h int)
+	Format() Format
 	Download(r image.Rectangle, dst draw.Image)
 	Upload(r image.Rectangle, src image.Image)
 	Unload()
 }
 
+// ErrUnloaded is the panic value of using a Texture after Unload, and
+// the error RenderTexture returns for one.
+var ErrUnloaded = errors.New("sprite: texture used after Unload")
+
+// TextureStats describes a texture loaded into an Engine.
+type TextureStats struct {
+	T             Texture
+	Width, Height int
+	CPUBytes      int // of main memory, including any mipmaps
+	GPUBytes      int // of graphics memory
+}
+
+// An Inventory lists the textures loaded into an Engine, in the order
+// they were loaded, with the memory they hold in total. A count that
+// keeps growing in a long-running program is a sign of textures that
+// are never unloaded.
+type Inventory struct {
+	Textures []TextureStats
+	CPUBytes int
+	GPUBytes int
+}
+
 type SubTex struct {
 	T Texture
 	R image.Rectangle
+
+	// Filter is how T is sampled between texel centers.
+	Filter Filter
+
+	// WrapX and WrapY are how the texels beyond R are read, by
+	// filters sampling near its edges, and how the tile of a Pattern
+	// is repeated. They do not extend the area drawn by a Node's
+	// SubTex, which is always the unit square of the Node.
+	WrapX, WrapY Wrap
 }
 
 type Curve int32
 
+// Wrap describes how a texture is sampled outside of its bounds.
+type Wrap uint8
+
+const (
+	WrapClamp  Wrap = iota // extend the edge texels
+	WrapRepeat             // tile the texture
+	WrapMirror             // tile the texture, reflecting every other tile
+	WrapNone               // leave the area outside the texture empty
+)
+
+// Format describes how the texels of a Texture are stored.
+type Format uint8
+
+const (
+	FormatRGBA      Format = iota // 8-bit premultiplied red, green, blue and alpha
+	FormatAlpha                   // 8-bit alpha, of white
+	FormatGray                    // 8-bit opaque gray
+	FormatPaletted                // 8-bit indices into a palette of colors
+	FormatETC1                    // ETC1 compressed opaque RGB
+	FormatETC2RGB                 // ETC2 compressed opaque RGB
+	FormatETC2RGBA                // ETC2 compressed RGB with EAC alpha
+	FormatETC2RGBA1               // ETC2 compressed RGB with 1-bit alpha
+)
+
+// Filter describes how a texture is sampled between texel centers.
+type Filter uint8
+
+const (
+	FilterBilinear  Filter = iota // interpolate the four nearest texels
+	FilterNearest                 // take the nearest texel, for pixel art
+	FilterBicubic                 // interpolate the sixteen nearest texels
+	FilterTrilinear               // bilinear, from a mipmap when minifying
+)
+
+// A BlendMode is how a Node is composited with the pixels drawn before
+// it, the destination. Modes only change the destination inside the
+// area the Node draws.
+type BlendMode uint8
+
+const (
+	BlendNormal   BlendMode = iota // source over destination
+	BlendAdd                       // the sum of source and destination
+	BlendMultiply                  // the product of source and destination
+	BlendScreen                    // the inverse of the product of the inverses
+	BlendOverlay                   // multiply or screen, by the destination
+	BlendDarken                    // the darker of source and destination
+	BlendLighten                   // the lighter of source and destination
+
+	// The Porter-Duff operators. BlendNormal is source over.
+	BlendClear   // nothing
+	BlendSrc     // the source
+	BlendDst     // the destination
+	BlendDstOver // destination over source
+	BlendSrcIn   // the source where the destination is
+	BlendDstIn   // the destination where the source is
+	BlendSrcOut  // the source where the destination is not
+	BlendDstOut  // the destination where the source is not
+	BlendSrcAtop // source over destination, where the destination is
+	BlendDstAtop // destination over source, where the source is
+	BlendXor     // the source and destination where the other is not
+)
+
+// A Pattern fills the area covered by a Node's Curve with a SubTex.
+//
+// A pattern is positioned in the unit square of its Node, the same
+// space a SubTex is drawn into. One tile of the SubTex covers the unit
+// square mapped by Transform, and is repeated outside it according to
+// the WrapX and WrapY of the SubTex.
+type Pattern struct {
+	SubTex SubTex
+
+	// Transform maps a single tile of SubTex into the unit square
+	// of the Node. A nil Transform draws one tile over the whole Node.
+	Transform *f32.Affine
+}
+
+// A DistanceField draws a Node's SubTex or Curve as a signed distance
+// field, which keeps its edges sharp at any scale and can be given an
+// outline and a glow.
+//
+// A distance field texture holds, for each texel, the distance from
+// its center to the nearest edge of a shape, positive inside. The
+// distance is mapped from [-Spread, Spread] texels onto the range of a
+// color channel, so that half intensity is on the edge. A single field
+// is in the alpha channel. A multi-channel field has three distances
+// in red, green and blue, whose median is the distance.
+//
+// An engine makes its own distance fields for curves, so Spread and
+// Multi only apply to a SubTex.
+type DistanceField struct {
+	Spread float32
+	Multi  bool
+
+	Color color.Color // color inside the edge
+
+	// Outline is the width of a border drawn in OutlineColor outside
+	// the edge, in texels of the field.
+	Outline      float32
+	OutlineColor color.Color
+
+	// Glow is the distance, in texels of the field, over which a halo
+	// in GlowColor fades away outside the edge and the outline. The
+	// outline and glow are limited by the spread of the field.
+	Glow      float32
+	GlowColor color.Color
+}
+
 type Engine interface {
 	// LoadTexture loads a texture into the active Engine.
 	LoadTexture(a image.Image) (Texture, error)
 
-	// LoadPath loads a vector path into the active Engine.
+	// LoadCurve loads a vector path into the active Engine.
 	//
 	// The path slice is an encoded sequence of tagged bezier
 	// curve control points. Control points are geom.Pt co-ordinates.
-	//  The first control point of a curve is the final control point
+	// The first control point of a curve is the final control point
 	// of the previous curve.
 	//
 	// Valid tags:
-	//	{0, x, y}           - start control point
-	//	{1, x, y}           - line segment control point
-	//	{2, x1, y1, x2, y2} - quadratic segment control points
+	//	{0, x, y}                   - start control point
+	//	{1, x, y}                   - line segment control point
+	//	{2, x1, y1, x2, y2}         - quadratic segment control points
+	//	{3, x1, y1, x2, y2, x3, y3} - cubic segment control points
+	//
+	// It reports an error if the path is not validly encoded, with an
+	// unknown tag or too few control points for the last tag, as
+	// the path is not drawn until later.
 	//
-	// TODO(crawshaw): support cubic segments
 	// TODO(crawshaw): make []float32?
 	LoadCurve(path []geom.Pt) (Curve, error)
 
+	// UnloadCurve releases a curve loaded by LoadCurve. Loading the
+	// same path again may return the same Curve, in which case it
+	// must be unloaded as many times.
 	UnloadCurve(c Curve)
 
+	// Render draws scene at time t. The time must advance from one
+	// frame to the next, as engines keep what was drawn at the current
+	// time cached, and only reuse the space of what was drawn before.
+	// A curve that does not fit in the cache is left out of the frame.
 	Render(scene *Node, t clock.Time)
+
+	// RenderTexture draws scene into the rectangle r of dst, in place
+	// of its previous contents, and returns that rectangle as a
+	// SubTex. If dst is nil, a new texture is loaded, large enough to
+	// hold r.
+	//
+	// The transform m maps the scene to pixels of r, relative to
+	// r.Min. A nil m scales by geom.PixelsPerPt, as Render does.
+	RenderTexture(dst Texture, r image.Rectangle, scene *Node, m *f32.Affine, t clock.Time) (SubTex, error)
+
+	// Inventory reports the textures loaded, by LoadTexture or by
+	// RenderTexture, and not yet unloaded.
+	Inventory() Inventory
+
+	// Release frees the resources held by the Engine, unloading any
+	// textures left. It reports an error if curves or textures are
+	// still loaded, as their handles have leaked. Leaked curves may
+	// still be unloaded after Release.
+	Release() error
 }
 
 // TODO: 64-bit sizeof(Node): 8*7 + 8*2 + 8*2 + 4*4 = 104 bytes.
@@ -90,6 +269,52 @@ type Node struct {
 	Arranger Arranger
 	SubTex   SubTex
 	Curve    Curve
+
+	// Color is the color Curve is filled with, if Pattern is nil.
+	// A nil Color is black.
+	Color color.Color
+
+	// Pattern, if non-nil, fills Curve instead of Color.
+	Pattern *Pattern
+
+	// DistanceField, if non-nil, draws SubTex or Curve as a distance
+	// field.
+	DistanceField *DistanceField
+
+	// Blend is how the node's SubTex or Curve is composited with what
+	// is already drawn. It does not apply to the node's children.
+	Blend BlendMode
+
+	// Clip, if non-nil, limits the drawing of the node and all its
+	// descendants.
+	Clip *Clip
+
+	// Effects are applied to the drawing of the node and all its
+	// descendants.
+	Effects []Effect
+}
+
+// A Clip limits drawing to an area, given in the coordinates of its
+// Node after the Node's Transform. Only one of Rect, Curve and Mask is
+// used, in that order. Clips of nested Nodes intersect.
+//
+// An engine drawing with a stencil buffer, such as glsprite, has no
+// antialiased clips: a pixel is drawn if its center is at least half
+// covered. Where it has no stencil buffer, nothing is drawn within a
+// clip other than an upright Rect.
+type Clip struct {
+	// Rect, if not empty, is the area drawn. If the Node is not
+	// rotated or sheared, it is rounded to whole pixels and clips
+	// quickest.
+	Rect geom.Rectangle
+
+	// Curve, if non-zero, is the area drawn, with antialiased edges.
+	Curve Curve
+
+	// Mask, if its T is non-nil, is drawn over the unit square, and
+	// its alpha is the fraction of each pixel that is drawn. Outside
+	// the unit square nothing is drawn.
+	Mask SubTex
 }
 
 // AppendChild adds a node c as a child of n.
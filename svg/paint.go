@@ -0,0 +1,449 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package svg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mobile/f32"
+	"golang.org/x/mobile/geom"
+
+	"github.com/crawshaw/sprite"
+)
+
+// gradientSize is the width and height in pixels of the texture
+// a gradient is rendered into.
+const gradientSize = 64
+
+// A paint is the value of a fill or stroke property.
+type paint struct {
+	none bool
+	c    color.NRGBA
+	url  string // id of a gradient element
+}
+
+// A style holds the inherited presentation properties of an element.
+type style struct {
+	color         color.NRGBA // the value of currentColor
+	fill, stroke  paint
+	fillOpacity   float64
+	strokeOpacity float64
+	strokeWidth   float64
+
+	// opacity is the product of the opacity of the element and its
+	// ancestors. It is not inherited in SVG, but as each shape is drawn
+	// separately it is applied to the paint of each descendant.
+	opacity float64
+}
+
+var defaultStyle = style{
+	color:         color.NRGBA{A: 0xff},
+	fill:          paint{c: color.NRGBA{A: 0xff}},
+	stroke:        paint{none: true},
+	fillOpacity:   1,
+	strokeOpacity: 1,
+	strokeWidth:   1,
+	opacity:       1,
+}
+
+// inherit returns st updated with the presentation properties of el.
+func (st style) inherit(el *element) (style, error) {
+	var err error
+	if s, ok := el.attr["color"]; ok {
+		if st.color, err = parseColorCurrent(s, st.color); err != nil {
+			return st, err
+		}
+	}
+	if s, ok := el.attr["fill"]; ok {
+		if st.fill, err = parsePaint(s, st.color); err != nil {
+			return st, err
+		}
+	}
+	if s, ok := el.attr["stroke"]; ok {
+		if st.stroke, err = parsePaint(s, st.color); err != nil {
+			return st, err
+		}
+	}
+	if s, ok := el.attr["stroke-width"]; ok {
+		if st.strokeWidth, err = parseLength(s); err != nil {
+			return st, err
+		}
+	}
+	opacity := func(name string, v *float64) {
+		if err != nil {
+			return
+		}
+		if s, ok := el.attr[name]; ok {
+			var f float64
+			if f, err = parseLength(s); err == nil {
+				*v = clamp(f)
+			}
+		}
+	}
+	opacity("fill-opacity", &st.fillOpacity)
+	opacity("stroke-opacity", &st.strokeOpacity)
+	o := 1.0
+	opacity("opacity", &o)
+	st.opacity *= o
+	return st, err
+}
+
+// parsePaint parses a paint, where currentColor is current.
+func parsePaint(s string, current color.NRGBA) (paint, error) {
+	switch {
+	case s == "none":
+		return paint{none: true}, nil
+	case strings.HasPrefix(s, "url(") && strings.HasSuffix(s, ")"):
+		id := strings.TrimSpace(s[4 : len(s)-1])
+		if !strings.HasPrefix(id, "#") {
+			return paint{}, fmt.Errorf("svg: unsupported paint %q", s)
+		}
+		return paint{url: id[1:]}, nil
+	}
+	c, err := parseColorCurrent(s, current)
+	if err != nil {
+		return paint{}, err
+	}
+	return paint{c: c}, nil
+}
+
+var namedColors = map[string]color.NRGBA{
+	"black":       {0x00, 0x00, 0x00, 0xff},
+	"white":       {0xff, 0xff, 0xff, 0xff},
+	"red":         {0xff, 0x00, 0x00, 0xff},
+	"lime":        {0x00, 0xff, 0x00, 0xff},
+	"green":       {0x00, 0x80, 0x00, 0xff},
+	"blue":        {0x00, 0x00, 0xff, 0xff},
+	"yellow":      {0xff, 0xff, 0x00, 0xff},
+	"cyan":        {0x00, 0xff, 0xff, 0xff},
+	"aqua":        {0x00, 0xff, 0xff, 0xff},
+	"magenta":     {0xff, 0x00, 0xff, 0xff},
+	"fuchsia":     {0xff, 0x00, 0xff, 0xff},
+	"gray":        {0x80, 0x80, 0x80, 0xff},
+	"grey":        {0x80, 0x80, 0x80, 0xff},
+	"silver":      {0xc0, 0xc0, 0xc0, 0xff},
+	"maroon":      {0x80, 0x00, 0x00, 0xff},
+	"olive":       {0x80, 0x80, 0x00, 0xff},
+	"navy":        {0x00, 0x00, 0x80, 0xff},
+	"purple":      {0x80, 0x00, 0x80, 0xff},
+	"teal":        {0x00, 0x80, 0x80, 0xff},
+	"orange":      {0xff, 0xa5, 0x00, 0xff},
+	"transparent": {},
+}
+
+// parseColor parses a color as #rgb, #rrggbb, rgb(r, g, b) or a
+// basic color keyword.
+func parseColor(s string) (color.NRGBA, error) {
+	if c, ok := namedColors[strings.ToLower(s)]; ok {
+		return c, nil
+	}
+	bad := fmt.Errorf("svg: bad color %q", s)
+	switch {
+	case strings.HasPrefix(s, "#"):
+		hex := s[1:]
+		if len(hex) == 3 {
+			hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+		}
+		if len(hex) != 6 {
+			return color.NRGBA{}, bad
+		}
+		v, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil {
+			return color.NRGBA{}, bad
+		}
+		return color.NRGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 0xff}, nil
+	case strings.HasPrefix(s, "rgb(") && strings.HasSuffix(s, ")"):
+		parts := strings.Split(s[4:len(s)-1], ",")
+		if len(parts) != 3 {
+			return color.NRGBA{}, bad
+		}
+		var v [3]uint8
+		for i, p := range parts {
+			p = strings.TrimSpace(p)
+			percent := strings.HasSuffix(p, "%")
+			if percent {
+				p = p[:len(p)-1]
+			}
+			f, err := strconv.ParseFloat(p, 64)
+			if err != nil {
+				return color.NRGBA{}, bad
+			}
+			if percent {
+				f = f * 255 / 100
+			}
+			v[i] = uint8(math.Max(0, math.Min(255, f+0.5)))
+		}
+		return color.NRGBA{v[0], v[1], v[2], 0xff}, nil
+	}
+	return color.NRGBA{}, bad
+}
+
+// parseColorCurrent parses a color as parseColor does, or the keyword
+// currentColor, which is current.
+func parseColorCurrent(s string, current color.NRGBA) (color.NRGBA, error) {
+	if strings.EqualFold(s, "currentColor") {
+		return current, nil
+	}
+	return parseColor(s)
+}
+
+func clamp(x float64) float64 {
+	if x < 0 {
+		return 0
+	}
+	if x > 1 {
+		return 1
+	}
+	return x
+}
+
+type solidKey color.NRGBA
+
+// pattern returns a Pattern filling the bounds b with p.
+func (d *decoder) pattern(p paint, opacity float64, b geom.Rectangle) (*sprite.Pattern, error) {
+	if p.url == "" {
+		c := p.c
+		c.A = uint8(float64(c.A)*opacity + 0.5)
+		t := d.solids[solidKey(c)]
+		if t == nil {
+			m := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+			m.SetNRGBA(0, 0, c)
+			var err error
+			if t, err = d.loadTexture(m); err != nil {
+				return nil, err
+			}
+			d.solids[solidKey(c)] = t
+		}
+		return &sprite.Pattern{SubTex: sprite.SubTex{T: t, R: image.Rect(0, 0, 1, 1)}}, nil
+	}
+
+	el := d.ids[p.url]
+	if el == nil {
+		return nil, fmt.Errorf("svg: unknown paint server %q", p.url)
+	}
+	g, err := d.gradient(el)
+	if err != nil {
+		return nil, err
+	}
+	m := g.render(b, opacity)
+	t, err := d.loadTexture(m)
+	if err != nil {
+		return nil, err
+	}
+	return &sprite.Pattern{SubTex: sprite.SubTex{T: t, R: m.Bounds()}}, nil
+}
+
+type stop struct {
+	offset float64
+	c      color.NRGBA
+}
+
+type gradient struct {
+	radial    bool
+	userSpace bool // gradientUnits="userSpaceOnUse"
+
+	x1, y1, x2, y2 float64 // linear
+	cx, cy, r      float64 // radial
+
+	inv   f32.Affine // inverse of gradientTransform
+	stops []stop
+}
+
+// gradient parses a gradient element. Attributes and stops missing
+// from el are taken from the gradient it references with xlink:href.
+func (d *decoder) gradient(el *element) (*gradient, error) {
+	g := &gradient{
+		radial: el.name == "radialGradient",
+		x2:     1,
+		cx:     0.5,
+		cy:     0.5,
+		r:      0.5,
+	}
+	if el.name != "linearGradient" && !g.radial {
+		return nil, fmt.Errorf("svg: unsupported paint server <%s>", el.name)
+	}
+
+	// Collect the chain of referenced gradients, nearest first.
+	var chain []*element
+	seen := make(map[*element]bool)
+	for e := el; e != nil && !seen[e]; e = d.ids[strings.TrimPrefix(e.attr["href"], "#")] {
+		seen[e] = true
+		chain = append(chain, e)
+	}
+	attr := func(name string) (string, bool) {
+		for _, e := range chain {
+			if v, ok := e.attr[name]; ok {
+				return v, true
+			}
+		}
+		return "", false
+	}
+	for _, e := range chain {
+		stops, err := parseStops(e)
+		if err != nil {
+			return nil, err
+		}
+		if len(stops) > 0 {
+			g.stops = stops
+			break
+		}
+	}
+
+	if v, ok := attr("gradientUnits"); ok {
+		g.userSpace = v == "userSpaceOnUse"
+	}
+	var fields map[string]*float64
+	if g.radial {
+		fields = map[string]*float64{"cx": &g.cx, "cy": &g.cy, "r": &g.r}
+	} else {
+		fields = map[string]*float64{"x1": &g.x1, "y1": &g.y1, "x2": &g.x2, "y2": &g.y2}
+	}
+	for name, f := range fields {
+		v, ok := attr(name)
+		if !g.userSpace {
+			// Percentages are fractions of the bounding box.
+			if ok {
+				var err error
+				if *f, err = parseLength(v); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		if !ok {
+			// The defaults are percentages of the viewport.
+			if x, ok := d.ofViewport(*f, lengthAxis[name]); ok {
+				*f = x
+			}
+			continue
+		}
+		var err error
+		if *f, err = d.length(v, lengthAxis[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	g.inv.Identity()
+	if v, ok := attr("gradientTransform"); ok {
+		a, err := parseTransform(v)
+		if err != nil {
+			return nil, err
+		}
+		g.inv.Inverse(&a)
+	}
+	return g, nil
+}
+
+func parseStops(el *element) ([]stop, error) {
+	var stops []stop
+	for _, c := range el.children {
+		if c.name != "stop" {
+			continue
+		}
+		var s stop
+		var err error
+		if s.offset, err = parseLengthDefault(c.attr["offset"], 0); err != nil {
+			return nil, err
+		}
+		s.offset = clamp(s.offset)
+		// Offsets must not decrease.
+		if len(stops) > 0 && s.offset < stops[len(stops)-1].offset {
+			s.offset = stops[len(stops)-1].offset
+		}
+		// A stop inherits color from the ancestors of its gradient,
+		// not from where the gradient is used. Only the stop's own
+		// is looked at, so currentColor is black unless it sets it.
+		s.c = color.NRGBA{A: 0xff}
+		current := s.c
+		if v, ok := c.attr["color"]; ok {
+			if current, err = parseColor(v); err != nil {
+				return nil, err
+			}
+		}
+		if v, ok := c.attr["stop-color"]; ok {
+			if s.c, err = parseColorCurrent(v, current); err != nil {
+				return nil, err
+			}
+		}
+		if v, ok := c.attr["stop-opacity"]; ok {
+			o, err := parseLength(v)
+			if err != nil {
+				return nil, err
+			}
+			s.c.A = uint8(float64(s.c.A)*clamp(o) + 0.5)
+		}
+		stops = append(stops, s)
+	}
+	return stops, nil
+}
+
+// at returns the color of the gradient at offset t.
+func (g *gradient) at(t float64) color.NRGBA {
+	if len(g.stops) == 0 {
+		return color.NRGBA{}
+	}
+	if t <= g.stops[0].offset {
+		return g.stops[0].c
+	}
+	for i := 1; i < len(g.stops); i++ {
+		s0, s1 := g.stops[i-1], g.stops[i]
+		if t > s1.offset {
+			continue
+		}
+		f := 0.0
+		if s1.offset > s0.offset {
+			f = (t - s0.offset) / (s1.offset - s0.offset)
+		}
+		lerp := func(a, b uint8) uint8 {
+			return uint8(float64(a)*(1-f) + float64(b)*f + 0.5)
+		}
+		return color.NRGBA{lerp(s0.c.R, s1.c.R), lerp(s0.c.G, s1.c.G), lerp(s0.c.B, s1.c.B), lerp(s0.c.A, s1.c.A)}
+	}
+	return g.stops[len(g.stops)-1].c
+}
+
+// render draws the gradient over the bounds b of a shape into an image,
+// whose texels are evenly spread over b.
+func (g *gradient) render(b geom.Rectangle, opacity float64) *image.NRGBA {
+	m := image.NewNRGBA(image.Rect(0, 0, gradientSize, gradientSize))
+	w := float64(b.Max.X - b.Min.X)
+	h := float64(b.Max.Y - b.Min.Y)
+	for y := 0; y < gradientSize; y++ {
+		for x := 0; x < gradientSize; x++ {
+			// Position in the object bounding box.
+			u := (float64(x) + 0.5) / gradientSize
+			v := (float64(y) + 0.5) / gradientSize
+			if g.userSpace {
+				u = float64(b.Min.X) + u*w
+				v = float64(b.Min.Y) + v*h
+			}
+			gu := float64(g.inv[0][0])*u + float64(g.inv[0][1])*v + float64(g.inv[0][2])
+			gv := float64(g.inv[1][0])*u + float64(g.inv[1][1])*v + float64(g.inv[1][2])
+
+			var t float64
+			if g.radial {
+				if g.r > 0 {
+					t = math.Hypot(gu-g.cx, gv-g.cy) / g.r
+				} else {
+					t = 1
+				}
+			} else {
+				dx, dy := g.x2-g.x1, g.y2-g.y1
+				if l := dx*dx + dy*dy; l > 0 {
+					t = ((gu-g.x1)*dx + (gv-g.y1)*dy) / l
+				}
+			}
+			c := g.at(clamp(t))
+			c.A = uint8(float64(c.A)*opacity + 0.5)
+			m.SetNRGBA(x, y, c)
+		}
+	}
+	return m
+}
@@ -0,0 +1,553 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package svg builds sprite scenes from SVG documents.
+//
+// A subset of SVG 1.1 is supported, enough for typical icons:
+//
+//	shapes:     path, rect, circle, ellipse, line, polyline, polygon
+//	structure:  svg, g, defs, with the transform attribute
+//	paint:      fill, stroke, stroke-width, opacity, fill-opacity,
+//	            stroke-opacity, as attributes or in a style attribute
+//	gradients:  linearGradient, radialGradient
+//
+// Each painted shape becomes a Node drawing a Curve filled with a
+// Pattern. Group opacity is applied to the paint of each shape, rather
+// than to the group as a whole. Lengths are in user units or in the
+// units of CSS, where em and ex are of a 16 unit font. Percentages are
+// of the viewBox of the nearest svg element, or of its width and height
+// if it has no viewBox. Text, images, clipping, masks and filters are
+// not supported and are ignored.
+package svg
+
+import (
+	"encoding/xml"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mobile/f32"
+	"golang.org/x/mobile/geom"
+
+	"github.com/crawshaw/sprite"
+	"github.com/crawshaw/sprite/raster"
+)
+
+// Decode reads an SVG document from r and returns a tree of Nodes
+// that draws it. SVG user units are geom.Pt.
+//
+// The curves and textures used by the tree are loaded into e. Calling
+// release unloads them, once the tree is no longer drawn.
+func Decode(e sprite.Engine, r io.Reader) (n *sprite.Node, release func(), err error) {
+	root, err := parse(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if root.name != "svg" {
+		return nil, nil, fmt.Errorf("svg: root element is <%s>, not <svg>", root.name)
+	}
+	d := &decoder{
+		e:      e,
+		ids:    make(map[string]*element),
+		solids: make(map[solidKey]sprite.Texture),
+	}
+	d.index(root)
+
+	n = new(sprite.Node)
+	if err := d.build(n, root, defaultStyle); err != nil {
+		d.release()
+		return nil, nil, err
+	}
+	return n, d.release, nil
+}
+
+// An element is a node of the parsed XML document.
+type element struct {
+	name     string
+	attr     map[string]string
+	children []*element
+}
+
+// parse reads an XML document into a tree of elements. Declarations
+// in a style attribute override presentation attributes.
+func parse(r io.Reader) (*element, error) {
+	dec := xml.NewDecoder(r)
+	var stack []*element
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil, fmt.Errorf("svg: no root element")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("svg: %v", err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			el := &element{
+				name: tok.Name.Local,
+				attr: make(map[string]string),
+			}
+			for _, a := range tok.Attr {
+				el.attr[a.Name.Local] = strings.TrimSpace(a.Value)
+			}
+			if style, ok := el.attr["style"]; ok {
+				for _, decl := range strings.Split(style, ";") {
+					i := strings.Index(decl, ":")
+					if i < 0 {
+						continue
+					}
+					el.attr[strings.TrimSpace(decl[:i])] = strings.TrimSpace(decl[i+1:])
+				}
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, el)
+			}
+			stack = append(stack, el)
+		case xml.EndElement:
+			if len(stack) == 1 {
+				return stack[0], nil
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+}
+
+type decoder struct {
+	e      sprite.Engine
+	ids    map[string]*element
+	solids map[solidKey]sprite.Texture
+
+	// curves and textures are what has been loaded into e.
+	curves   []sprite.Curve
+	textures []sprite.Texture
+
+	// viewportSize is the size in user units of the innermost viewport,
+	// which percentage lengths are of. It is zero if unknown.
+	viewportSize [2]float64
+}
+
+// release unloads the curves and textures loaded into d.e.
+func (d *decoder) release() {
+	for _, c := range d.curves {
+		d.e.UnloadCurve(c)
+	}
+	for _, t := range d.textures {
+		t.Unload()
+	}
+	d.curves, d.textures = nil, nil
+}
+
+// loadTexture loads m into d.e.
+func (d *decoder) loadTexture(m image.Image) (sprite.Texture, error) {
+	t, err := d.e.LoadTexture(m)
+	if err != nil {
+		return nil, err
+	}
+	d.textures = append(d.textures, t)
+	return t, nil
+}
+
+func (d *decoder) index(el *element) {
+	if id := el.attr["id"]; id != "" {
+		d.ids[id] = el
+	}
+	for _, c := range el.children {
+		d.index(c)
+	}
+}
+
+// build adds the contents of el to n.
+func (d *decoder) build(n *sprite.Node, el *element, st style) error {
+	st, err := st.inherit(el)
+	if err != nil {
+		return err
+	}
+
+	switch el.name {
+	case "svg", "g":
+		if el.name == "svg" {
+			defer func(vp [2]float64) { d.viewportSize = vp }(d.viewportSize)
+			n, err = d.viewport(n, el)
+		} else {
+			n, err = d.transformed(n, el)
+		}
+		if err != nil {
+			return err
+		}
+		for _, c := range el.children {
+			if err := d.build(n, c, st); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "path", "rect", "circle", "ellipse", "line", "polyline", "polygon":
+		p, err := d.shapePath(el)
+		if err != nil {
+			return err
+		}
+		if len(p) == 0 {
+			return nil
+		}
+		if n, err = d.transformed(n, el); err != nil {
+			return err
+		}
+		if !st.fill.none && el.name != "line" {
+			if err := d.addCurve(n, p, st.fill, st.fillOpacity*st.opacity); err != nil {
+				return err
+			}
+		}
+		if !st.stroke.none && st.strokeWidth > 0 {
+			s := &raster.Stroke{Shape: &p, Width: geom.Pt(st.strokeWidth)}
+			if err := d.addCurve(n, s.Path(), st.stroke, st.strokeOpacity*st.opacity); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// Everything else, including defs and gradients, draws nothing.
+	return nil
+}
+
+// transformed returns a child of n that applies the transform of el,
+// or n if el has no transform.
+func (d *decoder) transformed(n *sprite.Node, el *element) (*sprite.Node, error) {
+	s, ok := el.attr["transform"]
+	if !ok {
+		return n, nil
+	}
+	a, err := parseTransform(s)
+	if err != nil {
+		return nil, err
+	}
+	c := &sprite.Node{Transform: &a}
+	n.AppendChild(c)
+	return c, nil
+}
+
+// viewport returns a child of n that maps the viewBox of el onto its
+// width and height, centered as with preserveAspectRatio="xMidYMid".
+// It sets d.viewportSize to the size of the new viewport.
+func (d *decoder) viewport(n *sprite.Node, el *element) (*sprite.Node, error) {
+	var a f32.Affine
+	a.Identity()
+	// The position is in the enclosing viewport.
+	if x, y := el.attr["x"], el.attr["y"]; x != "" || y != "" {
+		tx, err := d.lengthDefault(x, horizontal)
+		if err != nil {
+			return nil, err
+		}
+		ty, err := d.lengthDefault(y, vertical)
+		if err != nil {
+			return nil, err
+		}
+		a.Translate(&a, float32(tx), float32(ty))
+	}
+	if v, ok := el.attr["viewBox"]; ok {
+		vb, err := parseNumbers(v)
+		if err != nil {
+			return nil, err
+		}
+		if len(vb) != 4 || vb[2] <= 0 || vb[3] <= 0 {
+			return nil, fmt.Errorf("svg: bad viewBox %q", v)
+		}
+		// A percentage or missing size is of the enclosing viewport.
+		// There is none around the outermost element, so there it is
+		// of the viewBox.
+		size := func(i int, whole float64) (float64, error) {
+			name := [...]string{"width", "height"}[i]
+			s, ok := el.attr[name]
+			if d.viewportSize[i] != 0 {
+				if !ok {
+					return d.viewportSize[i], nil
+				}
+				return d.length(s, axis(i))
+			}
+			if !ok {
+				return whole, nil
+			}
+			v, err := parseLength(s)
+			if strings.HasSuffix(s, "%") {
+				v *= whole
+			}
+			return v, err
+		}
+		w, err := size(0, vb[2])
+		if err != nil {
+			return nil, err
+		}
+		h, err := size(1, vb[3])
+		if err != nil {
+			return nil, err
+		}
+		scale := w / vb[2]
+		if sy := h / vb[3]; sy < scale {
+			scale = sy
+		}
+		a.Translate(&a, float32((w-vb[2]*scale)/2), float32((h-vb[3]*scale)/2))
+		a.Scale(&a, float32(scale), float32(scale))
+		a.Translate(&a, float32(-vb[0]), float32(-vb[1]))
+		d.viewportSize = [2]float64{vb[2], vb[3]}
+	} else {
+		// Without a viewBox, user units are those of the enclosing
+		// viewport, so a percentage size is of that.
+		for i, name := range []string{"width", "height"} {
+			s, ok := el.attr[name]
+			if !ok || strings.HasSuffix(s, "%") && d.viewportSize[i] == 0 {
+				// 100% of the enclosing viewport, or a part of
+				// a size that is unknown.
+				continue
+			}
+			v, err := d.length(s, axis(i))
+			if err != nil {
+				return nil, err
+			}
+			d.viewportSize[i] = v
+		}
+	}
+	c := &sprite.Node{Transform: &a}
+	n.AppendChild(c)
+	return c, nil
+}
+
+// addCurve adds a child to n that fills the path p with paint.
+func (d *decoder) addCurve(n *sprite.Node, p raster.Path, pt paint, opacity float64) error {
+	b := p.Bounds()
+	w, h := b.Max.X-b.Min.X, b.Max.Y-b.Min.Y
+	if w <= 0 || h <= 0 || opacity <= 0 {
+		return nil
+	}
+	pat, err := d.pattern(pt, opacity, b)
+	if err != nil {
+		return err
+	}
+	c, err := d.e.LoadCurve(p)
+	if err != nil {
+		return err
+	}
+	d.curves = append(d.curves, c)
+	// A curve is drawn over the unit square of its node, which
+	// is mapped onto the bounds of the path.
+	n.AppendChild(&sprite.Node{
+		Transform: &f32.Affine{
+			{float32(w), 0, float32(b.Min.X)},
+			{0, float32(h), float32(b.Min.Y)},
+		},
+		Curve:   c,
+		Pattern: pat,
+	})
+	return nil
+}
+
+// shapePath converts a shape element to a path.
+func (d *decoder) shapePath(el *element) (raster.Path, error) {
+	var v [6]float64
+	lengths := func(names ...string) error {
+		for i, name := range names {
+			var err error
+			if v[i], err = d.lengthDefault(el.attr[name], lengthAxis[name]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var data string
+	switch el.name {
+	case "path":
+		data = el.attr["d"]
+	case "rect":
+		if err := lengths("x", "y", "width", "height", "rx", "ry"); err != nil {
+			return nil, err
+		}
+		x, y, w, h, rx, ry := v[0], v[1], v[2], v[3], v[4], v[5]
+		if w <= 0 || h <= 0 {
+			return nil, nil
+		}
+		// A missing radius takes the value of the other one.
+		if _, ok := el.attr["rx"]; !ok {
+			rx = ry
+		}
+		if _, ok := el.attr["ry"]; !ok {
+			ry = rx
+		}
+		if rx > w/2 {
+			rx = w / 2
+		}
+		if ry > h/2 {
+			ry = h / 2
+		}
+		if rx <= 0 || ry <= 0 {
+			data = fmt.Sprintf("M%g %gh%gv%gh%gz", x, y, w, h, -w)
+		} else {
+			data = fmt.Sprintf("M%g %gh%ga%g %g 0 0 1 %g %gv%ga%g %g 0 0 1 %g %gh%ga%g %g 0 0 1 %g %gv%ga%g %g 0 0 1 %g %gz",
+				x+rx, y, w-2*rx, rx, ry, rx, ry,
+				h-2*ry, rx, ry, -rx, ry,
+				-(w - 2*rx), rx, ry, -rx, -ry,
+				-(h - 2*ry), rx, ry, rx, -ry)
+		}
+	case "circle", "ellipse":
+		var cx, cy, rx, ry float64
+		if el.name == "circle" {
+			if err := lengths("cx", "cy", "r"); err != nil {
+				return nil, err
+			}
+			cx, cy, rx, ry = v[0], v[1], v[2], v[2]
+		} else {
+			if err := lengths("cx", "cy", "rx", "ry"); err != nil {
+				return nil, err
+			}
+			cx, cy, rx, ry = v[0], v[1], v[2], v[3]
+		}
+		if rx <= 0 || ry <= 0 {
+			return nil, nil
+		}
+		e := &raster.Ellipse{
+			Center:  geom.Point{geom.Pt(cx), geom.Pt(cy)},
+			RadiusX: geom.Pt(rx),
+			RadiusY: geom.Pt(ry),
+		}
+		return e.Path(), nil
+	case "line":
+		if err := lengths("x1", "y1", "x2", "y2"); err != nil {
+			return nil, err
+		}
+		data = fmt.Sprintf("M%g %gL%g %g", v[0], v[1], v[2], v[3])
+	case "polyline", "polygon":
+		pts, err := parseNumbers(el.attr["points"])
+		if err != nil {
+			return nil, err
+		}
+		if len(pts) < 4 {
+			return nil, nil
+		}
+		var buf []string
+		for i := 0; i+1 < len(pts); i += 2 {
+			buf = append(buf, strconv.FormatFloat(pts[i], 'g', -1, 64), strconv.FormatFloat(pts[i+1], 'g', -1, 64))
+		}
+		data = "M" + strings.Join(buf, " ")
+		if el.name == "polygon" {
+			data += "z"
+		}
+	}
+	p, err := raster.ParseSVGPath(data)
+	if err != nil {
+		return nil, fmt.Errorf("svg: <%s>: %v", el.name, err)
+	}
+	return p, nil
+}
+
+// parseNumbers parses a list of numbers separated by white space
+// and commas.
+func parseNumbers(s string) ([]float64, error) {
+	f := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	v := make([]float64, len(f))
+	for i, x := range f {
+		var err error
+		if v[i], err = strconv.ParseFloat(x, 64); err != nil {
+			return nil, fmt.Errorf("svg: bad number %q", x)
+		}
+	}
+	return v, nil
+}
+
+// units are the sizes of the CSS units of length, in user units. The
+// font relative units are of the default font size, as text is not
+// supported.
+var units = map[string]float64{
+	"px": 1,
+	"in": 96,
+	"cm": 96 / 2.54,
+	"mm": 96 / 25.4,
+	"pt": 96.0 / 72,
+	"pc": 96.0 / 6,
+	"em": 16,
+	"ex": 8,
+}
+
+// parseLength parses a length in user units. A percentage is
+// returned as a fraction.
+func parseLength(s string) (float64, error) {
+	scale := 1.0
+	if strings.HasSuffix(s, "%") {
+		s = s[:len(s)-1]
+		scale = 0.01
+	} else if len(s) > 2 {
+		if u, ok := units[s[len(s)-2:]]; ok {
+			s = s[:len(s)-2]
+			scale = u
+		}
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, fmt.Errorf("svg: bad length %q", s)
+	}
+	return v * scale, nil
+}
+
+// An axis is what a percentage length is of.
+type axis int
+
+const (
+	horizontal axis = iota // the viewport width
+	vertical               // the viewport height
+	diagonal               // the viewport diagonal, divided by √2
+)
+
+// lengthAxis holds the axes of the length attributes of shapes.
+var lengthAxis = map[string]axis{
+	"x": horizontal, "width": horizontal, "cx": horizontal, "rx": horizontal, "x1": horizontal, "x2": horizontal,
+	"y": vertical, "height": vertical, "cy": vertical, "ry": vertical, "y1": vertical, "y2": vertical,
+	"r": diagonal,
+}
+
+// length parses a length in user units, taking a percentage of the
+// viewport along a.
+func (d *decoder) length(s string, a axis) (float64, error) {
+	v, err := parseLength(s)
+	if err != nil || !strings.HasSuffix(s, "%") {
+		return v, err
+	}
+	v, ok := d.ofViewport(v, a)
+	if !ok {
+		return 0, fmt.Errorf("svg: percentage length %q with no viewport size", s)
+	}
+	return v, nil
+}
+
+// ofViewport returns the fraction f of the viewport along a. It
+// reports false if the size of the viewport is unknown.
+func (d *decoder) ofViewport(f float64, a axis) (float64, bool) {
+	w, h := d.viewportSize[0], d.viewportSize[1]
+	var whole float64
+	switch a {
+	case horizontal:
+		whole = w
+	case vertical:
+		whole = h
+	case diagonal:
+		whole = math.Sqrt((w*w + h*h) / 2)
+	}
+	return f * whole, whole != 0
+}
+
+// lengthDefault is like length, but returns 0 for an empty string.
+func (d *decoder) lengthDefault(s string, a axis) (float64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return d.length(s, a)
+}
+
+func parseLengthDefault(s string, def float64) (float64, error) {
+	if s == "" {
+		return def, nil
+	}
+	return parseLength(s)
+}
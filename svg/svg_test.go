@@ -0,0 +1,309 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package svg
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	"golang.org/x/mobile/f32"
+	"golang.org/x/mobile/geom"
+
+	"github.com/crawshaw/sprite"
+	"github.com/crawshaw/sprite/portable"
+)
+
+func TestParseTransform(t *testing.T) {
+	tests := []struct {
+		s    string
+		want f32.Affine
+	}{
+		{"", f32.Affine{{1, 0, 0}, {0, 1, 0}}},
+		{"translate(10)", f32.Affine{{1, 0, 10}, {0, 1, 0}}},
+		{"translate(10, 20)", f32.Affine{{1, 0, 10}, {0, 1, 20}}},
+		{"scale(2)", f32.Affine{{2, 0, 0}, {0, 2, 0}}},
+		{"scale(2 3)", f32.Affine{{2, 0, 0}, {0, 3, 0}}},
+		{"matrix(1 2 3 4 5 6)", f32.Affine{{1, 3, 5}, {2, 4, 6}}},
+		{"rotate(90)", f32.Affine{{0, -1, 0}, {1, 0, 0}}},
+		{"rotate(90 10 10)", f32.Affine{{0, -1, 20}, {1, 0, 0}}},
+		{"skewX(45)", f32.Affine{{1, 1, 0}, {0, 1, 0}}},
+		{"skewY(45)", f32.Affine{{1, 0, 0}, {1, 1, 0}}},
+		{"translate(10,20) scale(2)", f32.Affine{{2, 0, 10}, {0, 2, 20}}},
+		{"scale(2),translate(10,20)", f32.Affine{{2, 0, 20}, {0, 2, 40}}},
+	}
+	for _, test := range tests {
+		got, err := parseTransform(test.s)
+		if err != nil {
+			t.Errorf("parseTransform(%q): %v", test.s, err)
+			continue
+		}
+		if !got.Eq(&test.want, 1e-5) {
+			t.Errorf("parseTransform(%q) = %v, want %v", test.s, got, test.want)
+		}
+	}
+
+	for _, s := range []string{"scale", "scale(1 2 3)", "spin(2)", "translate(a)"} {
+		if _, err := parseTransform(s); err == nil {
+			t.Errorf("parseTransform(%q): want error", s)
+		}
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		s    string
+		want color.NRGBA
+	}{
+		{"black", color.NRGBA{0, 0, 0, 0xff}},
+		{"Red", color.NRGBA{0xff, 0, 0, 0xff}},
+		{"#fff", color.NRGBA{0xff, 0xff, 0xff, 0xff}},
+		{"#1a2B3c", color.NRGBA{0x1a, 0x2b, 0x3c, 0xff}},
+		{"rgb(1, 2, 3)", color.NRGBA{1, 2, 3, 0xff}},
+		{"rgb(100%,50%,0%)", color.NRGBA{0xff, 0x80, 0, 0xff}},
+	}
+	for _, test := range tests {
+		got, err := parseColor(test.s)
+		if err != nil {
+			t.Errorf("parseColor(%q): %v", test.s, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("parseColor(%q) = %v, want %v", test.s, got, test.want)
+		}
+	}
+
+	for _, s := range []string{"", "#12", "#ggg", "rgb(1,2)", "chartreuse-ish"} {
+		if _, err := parseColor(s); err == nil {
+			t.Errorf("parseColor(%q): want error", s)
+		}
+	}
+}
+
+func countCurves(n *sprite.Node) int {
+	c := 0
+	if n.Curve != 0 {
+		c++
+	}
+	for x := n.FirstChild; x != nil; x = x.NextSibling {
+		c += countCurves(x)
+	}
+	return c
+}
+
+func TestDecodeTree(t *testing.T) {
+	const doc = `<?xml version="1.0"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="32" height="32">
+	<title>test</title>
+	<defs>
+		<linearGradient id="g"><stop offset="0" stop-color="red"/></linearGradient>
+	</defs>
+	<g transform="translate(4 4)" fill="blue">
+		<rect width="8" height="8"/>
+		<circle cx="16" cy="16" r="4" stroke="black" stroke-width="2"/>
+		<line x1="0" y1="0" x2="10" y2="10" stroke="black"/>
+	</g>
+	<path d="M0 0L10 0L10 10z" style="fill:url(#g); stroke:none"/>
+	<polygon points="0,0 4,0 4,4" fill="none"/>
+</svg>`
+	dst := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	n, _, err := Decode(portable.Engine(dst), strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// rect fill, circle fill and stroke, line stroke, path fill.
+	if got, want := countCurves(n), 5; got != want {
+		t.Errorf("got %d curves, want %d", got, want)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []string{
+		``,
+		`<html/>`,
+		`<svg><rect width="x" height="1"/></svg>`,
+		`<svg><path d="L0 0"/></svg>`,
+		`<svg><rect width="1" height="1" fill="url(#missing)"/></svg>`,
+		`<svg><rect width="1" height="1" fill="bogus"/></svg>`,
+		`<svg><g transform="spin(1)"/></svg>`,
+		`<svg viewBox="0 0 1"/>`,
+		`<svg><rect width="50%" height="1"/></svg>`,
+		`<svg><rect width="1" height="1"/><rect width="1" height="1" fill="url(#missing)"/></svg>`,
+	}
+	for _, doc := range tests {
+		dst := image.NewRGBA(image.Rect(0, 0, 8, 8))
+		e := portable.Engine(dst)
+		if _, _, err := Decode(e, strings.NewReader(doc)); err == nil {
+			t.Errorf("Decode(%q): want error", doc)
+		}
+		// What was loaded before the error is unloaded.
+		if err := e.Release(); err != nil {
+			t.Errorf("Decode(%q): %v", doc, err)
+		}
+	}
+}
+
+func TestDecodeRender(t *testing.T) {
+	geom.PixelsPerPt = 1
+
+	const doc = `<svg xmlns="http://www.w3.org/2000/svg" width="128" height="64" viewBox="0 0 64 32">
+	<linearGradient id="lr" x1="0" y1="0" x2="1" y2="0">
+		<stop offset="0" stop-color="#f00"/>
+		<stop offset="1" stop-color="#00f"/>
+	</linearGradient>
+	<rect x="0" y="0" width="32" height="32" fill="lime" opacity="0.5"/>
+	<rect x="32" y="0" width="32" height="32" fill="url(#lr)"/>
+</svg>`
+	dst := image.NewRGBA(image.Rect(0, 0, 128, 64))
+	for i := range dst.Pix {
+		dst.Pix[i] = 0xff
+	}
+	e := portable.Engine(dst)
+	n, release, err := Decode(e, strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Render(n, 0)
+	release()
+	if err := e.Release(); err != nil {
+		t.Errorf("Release after release: %v", err)
+	}
+
+	near := func(x, y uint8) bool { return x-y < 8 || y-x < 8 }
+	tests := []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{32, 32, color.RGBA{0x80, 0xff, 0x80, 0xff}}, // half transparent lime over white
+		{65, 32, color.RGBA{0xfc, 0, 0x03, 0xff}},    // left of gradient
+		{126, 32, color.RGBA{0x08, 0, 0xf7, 0xff}},   // right of gradient
+	}
+	for _, test := range tests {
+		got := dst.RGBAAt(test.x, test.y)
+		if !near(got.R, test.want.R) || !near(got.G, test.want.G) || !near(got.B, test.want.B) || !near(got.A, test.want.A) {
+			t.Errorf("pixel (%d, %d) = %v, want %v", test.x, test.y, got, test.want)
+		}
+	}
+}
+
+func TestViewport(t *testing.T) {
+	tests := []struct {
+		attr string
+		want f32.Affine
+	}{
+		{`width="48" height="48"`, f32.Affine{{2, 0, 0}, {0, 2, 0}}},
+		{`width="100%" height="100%"`, f32.Affine{{1, 0, 0}, {0, 1, 0}}},
+		{`width="200%" height="100%"`, f32.Affine{{1, 0, 12}, {0, 1, 0}}},
+		{`width="0.25in" height="18pt"`, f32.Affine{{1, 0, 0}, {0, 1, 0}}},
+		{`width="12.7mm" height="1.27cm"`, f32.Affine{{2, 0, 0}, {0, 2, 0}}},
+		{`width="3pc" height="3em"`, f32.Affine{{2, 0, 0}, {0, 2, 0}}},
+		{``, f32.Affine{{1, 0, 0}, {0, 1, 0}}},
+	}
+	for _, test := range tests {
+		doc := `<svg ` + test.attr + ` viewBox="0 0 24 24"/>`
+		dst := image.NewRGBA(image.Rect(0, 0, 8, 8))
+		n, _, err := Decode(portable.Engine(dst), strings.NewReader(doc))
+		if err != nil {
+			t.Errorf("%s: %v", test.attr, err)
+			continue
+		}
+		if got := n.FirstChild.Transform; !got.Eq(&test.want, 1e-5) {
+			t.Errorf("%s: transform %v, want %v", test.attr, got, test.want)
+		}
+	}
+}
+
+func TestNestedViewport(t *testing.T) {
+	tests := []struct {
+		attr string
+		want f32.Affine
+	}{
+		{`width="50%" height="50%"`, f32.Affine{{5, 0, 0}, {0, 5, 0}}},
+		{`width="20" height="100%"`, f32.Affine{{2, 0, 0}, {0, 2, 40}}},
+		{``, f32.Affine{{10, 0, 0}, {0, 10, 0}}},
+	}
+	for _, test := range tests {
+		doc := `<svg width="100" height="100" viewBox="0 0 100 100"><svg ` + test.attr + ` viewBox="0 0 10 10"/></svg>`
+		dst := image.NewRGBA(image.Rect(0, 0, 8, 8))
+		n, _, err := Decode(portable.Engine(dst), strings.NewReader(doc))
+		if err != nil {
+			t.Errorf("%s: %v", test.attr, err)
+			continue
+		}
+		if got := n.FirstChild.FirstChild.Transform; !got.Eq(&test.want, 1e-5) {
+			t.Errorf("%s: transform %v, want %v", test.attr, got, test.want)
+		}
+	}
+}
+
+func TestPercentLengths(t *testing.T) {
+	geom.PixelsPerPt = 1
+
+	const doc = `<svg xmlns="http://www.w3.org/2000/svg" width="48" height="24" viewBox="0 0 24 12">
+	<linearGradient id="g" gradientUnits="userSpaceOnUse" x1="50%">
+		<stop offset="0" stop-color="red"/>
+		<stop offset="1" stop-color="blue"/>
+	</linearGradient>
+	<rect width="50%" height="100%" fill="lime"/>
+	<rect x="50%" width="50%" height="100%" fill="url(#g)"/>
+</svg>`
+	dst := image.NewRGBA(image.Rect(0, 0, 48, 24))
+	e := portable.Engine(dst)
+	n, _, err := Decode(e, strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Render(n, 0)
+	near := func(x, y uint8) bool { return x-y < 32 || y-x < 32 }
+	for _, test := range []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{1, 1, color.RGBA{0, 0xff, 0, 0xff}},
+		{22, 22, color.RGBA{0, 0xff, 0, 0xff}},
+		{25, 12, color.RGBA{0xff, 0, 0, 0xff}}, // left of gradient
+		{46, 12, color.RGBA{0, 0, 0xff, 0xff}}, // right of gradient
+	} {
+		got := dst.RGBAAt(test.x, test.y)
+		if !near(got.R, test.want.R) || !near(got.G, test.want.G) || !near(got.B, test.want.B) || !near(got.A, test.want.A) {
+			t.Errorf("pixel (%d, %d) = %v, want %v", test.x, test.y, got, test.want)
+		}
+	}
+}
+
+func TestCurrentColor(t *testing.T) {
+	geom.PixelsPerPt = 1
+
+	const doc = `<svg xmlns="http://www.w3.org/2000/svg" width="24" height="8">
+	<linearGradient id="g"><stop offset="0" stop-color="currentColor" color="lime"/></linearGradient>
+	<g color="red">
+		<rect x="0" width="8" height="8" fill="currentColor"/>
+		<g color="currentColor">
+			<rect x="8" width="8" height="8" style="fill: currentcolor"/>
+		</g>
+	</g>
+	<rect x="16" width="8" height="8" fill="url(#g)"/>
+</svg>`
+	dst := image.NewRGBA(image.Rect(0, 0, 24, 8))
+	e := portable.Engine(dst)
+	n, _, err := Decode(e, strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Render(n, 0)
+	for _, test := range []struct {
+		x    int
+		want color.RGBA
+	}{
+		{4, color.RGBA{0xff, 0, 0, 0xff}},
+		{12, color.RGBA{0xff, 0, 0, 0xff}},
+		{20, color.RGBA{0, 0xff, 0, 0xff}},
+	} {
+		if got := dst.RGBAAt(test.x, 4); got != test.want {
+			t.Errorf("pixel (%d, 4) = %v, want %v", test.x, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package svg
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"golang.org/x/mobile/f32"
+)
+
+// parseTransform parses the value of a transform attribute, a list of
+// matrix, translate, scale, rotate, skewX and skewY functions.
+func parseTransform(s string) (f32.Affine, error) {
+	var a f32.Affine
+	a.Identity()
+	rest := strings.TrimSpace(s)
+	for rest != "" {
+		open := strings.Index(rest, "(")
+		close := strings.Index(rest, ")")
+		if open < 0 || close < open {
+			return a, fmt.Errorf("svg: bad transform %q", s)
+		}
+		name := strings.TrimSpace(rest[:open])
+		args, err := parseNumbers(rest[open+1 : close])
+		if err != nil {
+			return a, err
+		}
+		rest = strings.TrimLeft(rest[close+1:], " \t\r\n,")
+
+		nargs := func(n ...int) bool {
+			for _, x := range n {
+				if len(args) == x {
+					return true
+				}
+			}
+			return false
+		}
+		var t f32.Affine
+		t.Identity()
+		switch name {
+		case "matrix":
+			if !nargs(6) {
+				return a, fmt.Errorf("svg: bad transform %q", s)
+			}
+			t = f32.Affine{
+				{float32(args[0]), float32(args[2]), float32(args[4])},
+				{float32(args[1]), float32(args[3]), float32(args[5])},
+			}
+		case "translate":
+			if !nargs(1, 2) {
+				return a, fmt.Errorf("svg: bad transform %q", s)
+			}
+			args = append(args, 0)
+			t.Translate(&t, float32(args[0]), float32(args[1]))
+		case "scale":
+			if !nargs(1, 2) {
+				return a, fmt.Errorf("svg: bad transform %q", s)
+			}
+			args = append(args, args[0])
+			t.Scale(&t, float32(args[0]), float32(args[1]))
+		case "rotate":
+			if !nargs(1, 3) {
+				return a, fmt.Errorf("svg: bad transform %q", s)
+			}
+			args = append(args, 0, 0)
+			// Rotate about (cx, cy). Positive angles rotate the
+			// x-axis towards the y-axis.
+			sin, cos := math.Sincos(args[0] * math.Pi / 180)
+			cx, cy := args[1], args[2]
+			t = f32.Affine{
+				{float32(cos), float32(-sin), float32(cx - cos*cx + sin*cy)},
+				{float32(sin), float32(cos), float32(cy - sin*cx - cos*cy)},
+			}
+		case "skewX":
+			if !nargs(1) {
+				return a, fmt.Errorf("svg: bad transform %q", s)
+			}
+			t[0][1] = float32(math.Tan(args[0] * math.Pi / 180))
+		case "skewY":
+			if !nargs(1) {
+				return a, fmt.Errorf("svg: bad transform %q", s)
+			}
+			t[1][0] = float32(math.Tan(args[0] * math.Pi / 180))
+		default:
+			return a, fmt.Errorf("svg: unknown transform %q", name)
+		}
+		a.Mul(&a, &t)
+	}
+	return a, nil
+}